@@ -0,0 +1,646 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AdminHandler serves the administration API of the broker under /1/broker/. The requests are authenticated by the bearer
+// tokens of the administrators.
+type AdminHandler struct {
+	processor       *Processor
+	adminTokens     map[string]string
+	groupRepository GroupRepository // nil if the groups are not managed
+	eventBus        *EventBus       // nil if the events are not streamed
+}
+
+// eventStreamBufferSize is the number of the events buffered for a single event stream before they are dropped
+const eventStreamBufferSize = 100
+
+// eventStreamKeepAlive is the interval of the comments sent to keep the idle event stream open
+const eventStreamKeepAlive = 15 * time.Second
+
+// ErrGroupNotFound is returned by the admin API if the group does not exist
+var ErrGroupNotFound = errors.New("group not found")
+
+// AdminGroupRequest represents the request body replacing the group members
+type AdminGroupRequest struct {
+	Members []GroupMember `json:"members"`
+}
+
+// AdminGroupsResponse represents the response body of the groups listing
+type AdminGroupsResponse struct {
+	Count  int      `json:"count"`
+	Groups []*Group `json:"groups"`
+}
+
+// AdminEscalationsResponse represents the response body of the escalations listing
+type AdminEscalationsResponse struct {
+	Count       int           `json:"count"`
+	Escalations []*Escalation `json:"escalations"`
+}
+
+// AdminQueueResponse represents the response body of the queue listing
+type AdminQueueResponse struct {
+	Count    int              `json:"count"`
+	Messages []*QueuedMessage `json:"messages"`
+}
+
+// AdminDeadLettersResponse represents the response body of the dead letters listing
+type AdminDeadLettersResponse struct {
+	Count       int           `json:"count"`
+	DeadLetters []*DeadLetter `json:"dead_letters"`
+}
+
+// AdminLimits represents the application limits of a token in the limits listing
+type AdminLimits struct {
+	Token     string `json:"token"` // token alias or the redacted token
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Reset     int    `json:"reset"` // Unix time of the limits reset
+}
+
+// AdminLimitsResponse represents the response body of the limits listing
+type AdminLimitsResponse struct {
+	Count  int           `json:"count"`
+	Limits []AdminLimits `json:"limits"`
+}
+
+// AdminErrorResponse represents the response body of the failed admin API request
+type AdminErrorResponse struct {
+	Request string `json:"request"`
+	Error   string `json:"error"`
+}
+
+// NewAdminHandler creates a new admin API handler operating on the queue of the processor. The adminTokens map the administrator
+// names to their bearer tokens.
+func NewAdminHandler(processor *Processor, adminTokens map[string]string) *AdminHandler {
+	h := new(AdminHandler)
+	h.processor = processor
+	h.adminTokens = adminTokens
+	return h
+}
+
+// SetGroupRepository enables the management of the local recipient groups. Must be called before Register.
+func (h *AdminHandler) SetGroupRepository(groupRepository GroupRepository) {
+	h.groupRepository = groupRepository
+}
+
+// SetEventBus enables the streaming of the message lifecycle events published to the bus. Must be called before Register.
+func (h *AdminHandler) SetEventBus(eventBus *EventBus) {
+	h.eventBus = eventBus
+}
+
+// Register registers the admin API endpoints at the server
+func (h *AdminHandler) Register(server *Server) {
+	server.Handle("GET /1/broker/queue", h.authenticate(h.listQueue))
+	server.Handle("GET /1/broker/queue/{id}", h.authenticate(h.getQueuedMessage))
+	server.Handle("DELETE /1/broker/queue/{id}", h.authenticate(h.deleteQueuedMessage))
+	server.Handle("POST /1/broker/queue/{id}/retry", h.authenticate(h.retryQueuedMessage))
+	server.Handle("GET /1/broker/scheduled", h.authenticate(h.listScheduled))
+	server.Handle("DELETE /1/broker/scheduled/{id}", h.authenticate(h.cancelScheduledMessage))
+	server.Handle("GET /1/broker/limits", h.authenticate(h.listLimits))
+
+	// the dead letters are available only if they are stored
+	if h.processor.DeadLetterRepository != nil {
+		server.Handle("GET /1/broker/deadletters", h.authenticate(h.listDeadLetters))
+		server.Handle("GET /1/broker/deadletters/export", h.authenticate(h.exportDeadLetters))
+		server.Handle("GET /1/broker/deadletters/{id}", h.authenticate(h.getDeadLetter))
+		server.Handle("DELETE /1/broker/deadletters/{id}", h.authenticate(h.deleteDeadLetter))
+		server.Handle("POST /1/broker/deadletters/{id}/replay", h.authenticate(h.replayDeadLetter))
+	}
+
+	// the escalations are available only if they are supported
+	if h.processor.EscalationRepository != nil {
+		server.Handle("GET /1/broker/escalations", h.authenticate(h.listEscalations))
+		server.Handle("GET /1/broker/escalations/{id}", h.authenticate(h.getEscalation))
+		server.Handle("DELETE /1/broker/escalations/{id}", h.authenticate(h.cancelEscalation))
+	}
+
+	// the groups are managed only if they are supported
+	if h.groupRepository != nil {
+		server.Handle("GET /1/broker/groups", h.authenticate(h.listGroups))
+		server.Handle("GET /1/broker/groups/{name}", h.authenticate(h.getGroup))
+		server.Handle("PUT /1/broker/groups/{name}", h.authenticate(h.putGroup))
+		server.Handle("DELETE /1/broker/groups/{name}", h.authenticate(h.deleteGroup))
+	}
+
+	// the events are streamed only if they are published
+	if h.eventBus != nil {
+		server.Handle("GET /1/broker/events", h.authenticate(h.streamEvents))
+	}
+}
+
+// wraps the handler, so that it is called only with a valid administrator bearer token. The name of the administrator is passed in the context.
+func (h *AdminHandler) authenticate(handler func(ctx context.Context, w http.ResponseWriter, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := NewRequestID()
+		ctx := WithClientSubject(WithRequestID(r.Context(), request), getVerifiedClientSubject(r))
+
+		// find the administrator of the token, all the tokens are compared to keep the time constant
+		admin := ""
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for name, adminToken := range h.adminTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 && found && token != "" {
+				admin = name
+			}
+		}
+		if admin == "" {
+			GetLogger(ctx).Warn("Admin API request rejected, invalid bearer token.", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminError(ctx, w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+
+		// audit the administrator
+		ctx = WithAdmin(ctx, admin)
+		GetLogger(ctx).Info("Admin API request.", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery)
+		handler(ctx, w, r)
+	})
+}
+
+// lists the queued messages matching the filter given by the query parameters, optionally filtered by the state (queued or scheduled)
+func (h *AdminHandler) listQueue(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && state != queuedMessageStateQueued && state != queuedMessageStateScheduled {
+		writeAdminError(ctx, w, http.StatusBadRequest, fmt.Errorf("unsupported state \"%s\", expected \"%s\" or \"%s\"", state, queuedMessageStateQueued, queuedMessageStateScheduled))
+		return
+	}
+	h.writeQueue(ctx, w, r, state)
+}
+
+// lists the scheduled messages waiting for their delivery time matching the filter given by the query parameters
+func (h *AdminHandler) listScheduled(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.writeQueue(ctx, w, r, queuedMessageStateScheduled)
+}
+
+// writes the queued messages matching the filter given by the query parameters, optionally only the ones in the state
+func (h *AdminHandler) writeQueue(ctx context.Context, w http.ResponseWriter, r *http.Request, state string) {
+	filter, err := parseQueueFilter(r.URL.Query())
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+		return
+	}
+	messages, err := h.processor.MessageRepository.List()
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	response := AdminQueueResponse{Messages: []*QueuedMessage{}}
+	for _, message := range messages {
+		if filter.matches(message, now) && (state == "" || message.getState() == state) {
+			response.Messages = append(response.Messages, redactQueuedMessage(message))
+		}
+	}
+	response.Count = len(response.Messages)
+	writeAdminJSON(ctx, w, http.StatusOK, response)
+}
+
+// returns the queued message given by the id path value
+func (h *AdminHandler) getQueuedMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	message, err := h.processor.MessageRepository.Get(id)
+	if err == nil && message == nil {
+		err = ErrMessageNotFound
+	}
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(id, err), err)
+		return
+	}
+	writeAdminJSON(ctx, w, http.StatusOK, redactQueuedMessage(message))
+}
+
+// removes the queued message given by the id path value
+func (h *AdminHandler) deleteQueuedMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "deleted", h.processor.DeleteQueuedMessage)
+}
+
+// cancels the scheduled message given by the id path value
+func (h *AdminHandler) cancelScheduledMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "cancelled", h.processor.CancelScheduledMessage)
+}
+
+// schedules an immediate delivery attempt of the queued message given by the id path value
+func (h *AdminHandler) retryQueuedMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "retry scheduled", h.processor.RetryQueuedMessage)
+}
+
+// lists the dead letters matching the filter given by the query parameters
+func (h *AdminHandler) listDeadLetters(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	filter, err := parseQueueFilter(r.URL.Query())
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+		return
+	}
+	deadLetters, err := h.getFilteredDeadLetters(filter, r.URL.Query().Get("state"))
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(ctx, w, http.StatusOK, AdminDeadLettersResponse{Count: len(deadLetters), DeadLetters: deadLetters})
+}
+
+// returns the dead letters matching the filter given by the query parameters as a JSON file
+func (h *AdminHandler) exportDeadLetters(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	filter, err := parseQueueFilter(r.URL.Query())
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+		return
+	}
+	deadLetters, err := h.getFilteredDeadLetters(filter, r.URL.Query().Get("state"))
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"deadletters-%s.json\"", time.Now().UTC().Format("20060102T150405Z")))
+	writeAdminJSON(ctx, w, http.StatusOK, deadLetters)
+}
+
+// returns the redacted dead letters matching the filter and the state (if not empty)
+func (h *AdminHandler) getFilteredDeadLetters(filter queueFilter, state string) ([]*DeadLetter, error) {
+	deadLetters, err := h.processor.DeadLetterRepository.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	filtered := []*DeadLetter{}
+	for _, deadLetter := range deadLetters {
+		if filter.matches(&deadLetter.QueuedMessage, now) && (state == "" || deadLetter.State == state) {
+			filtered = append(filtered, redactDeadLetter(deadLetter))
+		}
+	}
+	return filtered, nil
+}
+
+// returns the dead letter given by the id path value
+func (h *AdminHandler) getDeadLetter(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	deadLetter, err := h.processor.DeadLetterRepository.Get(id)
+	if err == nil && deadLetter == nil {
+		err = ErrMessageNotFound
+	}
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(id, err), err)
+		return
+	}
+	writeAdminJSON(ctx, w, http.StatusOK, redactDeadLetter(deadLetter))
+}
+
+// removes the dead letter given by the id path value
+func (h *AdminHandler) deleteDeadLetter(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "deleted", func(id string) error {
+		deadLetter, err := h.processor.DeadLetterRepository.Get(id)
+		if err == nil && deadLetter == nil {
+			err = ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return h.processor.DeadLetterRepository.Remove(id)
+	})
+}
+
+// returns the dead letter given by the id path value to the queue
+func (h *AdminHandler) replayDeadLetter(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "replayed", h.processor.ReplayDeadLetter)
+}
+
+// lists the last known application limits of the tokens sorted by the token alias
+func (h *AdminHandler) listLimits(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	allLimits, err := h.processor.LimitsCounter.ListLimits()
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	response := AdminLimitsResponse{Limits: []AdminLimits{}}
+	for token, limits := range allLimits {
+		tokenLabel := getTokenMetricsLabel(h.processor.TokenVault.GetTokenAlias(token), token)
+		response.Limits = append(response.Limits, AdminLimits{Token: tokenLabel, Limit: limits.limit, Remaining: limits.remaining, Reset: limits.reset})
+	}
+	slices.SortFunc(response.Limits, func(a, b AdminLimits) int { return strings.Compare(a.Token, b.Token) })
+	response.Count = len(response.Limits)
+	writeAdminJSON(ctx, w, http.StatusOK, response)
+}
+
+// lists the escalations, optionally filtered by the state query parameter
+func (h *AdminHandler) listEscalations(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	escalations, err := h.processor.EscalationRepository.List()
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	state := r.URL.Query().Get("state")
+	response := AdminEscalationsResponse{Escalations: []*Escalation{}}
+	for _, escalation := range escalations {
+		if state == "" || escalation.State == state {
+			response.Escalations = append(response.Escalations, redactEscalation(escalation))
+		}
+	}
+	response.Count = len(response.Escalations)
+	writeAdminJSON(ctx, w, http.StatusOK, response)
+}
+
+// returns the escalation given by the id path value
+func (h *AdminHandler) getEscalation(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	escalation, err := h.processor.EscalationRepository.Get(id)
+	if err == nil && escalation == nil {
+		err = ErrEscalationNotFound
+	}
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(id, err), err)
+		return
+	}
+	writeAdminJSON(ctx, w, http.StatusOK, redactEscalation(escalation))
+}
+
+// cancels the active escalation given by the id path value
+func (h *AdminHandler) cancelEscalation(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h.applyOperation(ctx, w, r, "cancelled", h.processor.CancelEscalation)
+}
+
+// lists all the groups
+func (h *AdminHandler) listGroups(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupRepository.List()
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	response := AdminGroupsResponse{Groups: []*Group{}}
+	for _, group := range groups {
+		response.Groups = append(response.Groups, redactGroup(group))
+	}
+	response.Count = len(response.Groups)
+	writeAdminJSON(ctx, w, http.StatusOK, response)
+}
+
+// returns the group given by the name path value
+func (h *AdminHandler) getGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	group, err := h.groupRepository.Get(name)
+	if err == nil && group == nil {
+		err = ErrGroupNotFound
+	}
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(name, err), err)
+		return
+	}
+	writeAdminJSON(ctx, w, http.StatusOK, redactGroup(group))
+}
+
+// creates or replaces the group given by the name path value by the members of the request body
+func (h *AdminHandler) putGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var request AdminGroupRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, fmt.Errorf("decoding of the group failed with error %s", err.Error()))
+		return
+	}
+	group := &Group{Name: name, Members: request.Members}
+	err = validateGroup(group)
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusBadRequest, err)
+		return
+	}
+	err = h.groupRepository.Store(group)
+	if err != nil {
+		writeAdminError(ctx, w, http.StatusInternalServerError, err)
+		return
+	}
+	GetLogger(ctx).Info("Admin operation applied on the group.", "group", name, "result", "stored", "members", len(group.Members))
+	writeAdminJSON(ctx, w, http.StatusOK, redactGroup(group))
+}
+
+// removes the group given by the name path value
+func (h *AdminHandler) deleteGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	group, err := h.groupRepository.Get(name)
+	if err == nil && group == nil {
+		err = ErrGroupNotFound
+	}
+	if err == nil {
+		err = h.groupRepository.Remove(name)
+	}
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(name, err), err)
+		return
+	}
+	GetLogger(ctx).Info("Admin operation applied on the group.", "group", name, "result", "deleted")
+	writeAdminJSON(ctx, w, http.StatusOK, map[string]string{"name": name, "result": "deleted"})
+}
+
+// streams the message lifecycle events as the server-sent events until the client disconnects, optionally filtered by the
+// token_alias, user and type query parameters
+func (h *AdminHandler) streamEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAdminError(ctx, w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	query := r.URL.Query()
+	tokenAlias := query.Get("token_alias")
+	user := query.Get("user")
+	eventType := query.Get("type")
+	if eventType != "" && !slices.Contains(messageEventTypes, eventType) {
+		writeAdminError(ctx, w, http.StatusBadRequest, fmt.Errorf("invalid type parameter %s", eventType))
+		return
+	}
+
+	// subscribe before the response is started, so that no event is missed
+	events, unsubscribe := h.eventBus.Subscribe(eventStreamBufferSize)
+	defer unsubscribe()
+	GetLogger(ctx).Info("Event stream started.")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			GetLogger(ctx).Info("Event stream closed.")
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+
+		case event := <-events:
+			if tokenAlias != "" && event.TokenAlias != tokenAlias {
+				continue
+			}
+			if user != "" && h.processor.TokenVault.ResolveUser(event.user) != h.processor.TokenVault.ResolveUser(user) {
+				continue
+			}
+			if eventType != "" && event.Type != eventType {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// checks the group name and its members, the groups cannot be nested
+func validateGroup(group *Group) error {
+	if checkStoreID(group.Name) != nil {
+		return fmt.Errorf("invalid group name \"%s\"", group.Name)
+	}
+	if len(group.Members) == 0 {
+		return errors.New("the group has no members")
+	}
+	for _, member := range group.Members {
+		if member.User == "" || strings.HasPrefix(member.User, groupUserPrefix) {
+			return fmt.Errorf("invalid group member \"%s\", expected a user key or alias", member.User)
+		}
+	}
+	return nil
+}
+
+// applies the processor operation on the message given by the id path value and writes the result
+func (h *AdminHandler) applyOperation(ctx context.Context, w http.ResponseWriter, r *http.Request, result string, operation func(id string) error) {
+	id := r.PathValue("id")
+	err := operation(id)
+	if err != nil {
+		writeAdminError(ctx, w, getAdminErrorStatusCode(id, err), err)
+		return
+	}
+	GetLogger(ctx).Info("Admin operation applied on the queued message.", "message", id, "result", result)
+	writeAdminJSON(ctx, w, http.StatusOK, map[string]string{"id": id, "result": result})
+}
+
+// returns the status code of the failed admin operation on the message
+func getAdminErrorStatusCode(id string, err error) int {
+	switch {
+	case errors.Is(err, ErrMessageNotFound) || errors.Is(err, ErrGroupNotFound) || errors.Is(err, ErrEscalationNotFound) || checkStoreID(id) != nil:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queueFilter represents the filter of the queue and dead letters listing, the empty values do not filter
+type queueFilter struct {
+	tokenAlias string
+	user       string
+	parentID   string
+	minAge     time.Duration
+	maxAge     time.Duration
+}
+
+// parses the filter from the token_alias, user, min_age and max_age query parameters
+func parseQueueFilter(query url.Values) (queueFilter, error) {
+	filter := queueFilter{tokenAlias: query.Get("token_alias"), user: query.Get("user"), parentID: query.Get("parent")}
+	var err error
+	filter.minAge, err = parseAgeParameter(query.Get("min_age"))
+	if err != nil {
+		return filter, err
+	}
+	filter.maxAge, err = parseAgeParameter(query.Get("max_age"))
+	return filter, err
+}
+
+// returns true if the message matches the filter
+func (f queueFilter) matches(message *QueuedMessage, now time.Time) bool {
+	age := now.Sub(message.AcceptedAt)
+	switch {
+	case f.tokenAlias != "" && message.TokenAlias != f.tokenAlias:
+		return false
+	case f.user != "" && message.Notification.User != f.user:
+		return false
+	case f.parentID != "" && message.ParentID != f.parentID:
+		return false
+	case f.minAge != 0 && age < f.minAge:
+		return false
+	case f.maxAge != 0 && age > f.maxAge:
+		return false
+	}
+	return true
+}
+
+// parses the age filter, the empty value means no filter
+func parseAgeParameter(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age \"%s\", expected duration like \"90s\" or \"2h\"", value)
+	}
+	return age, nil
+}
+
+// returns a copy of the queued message with the secrets masked
+func redactQueuedMessage(message *QueuedMessage) *QueuedMessage {
+	redacted := *message
+	redacted.Notification = RedactNotification(message.Notification)
+	return &redacted
+}
+
+// returns a copy of the dead letter with the secrets masked
+func redactDeadLetter(deadLetter *DeadLetter) *DeadLetter {
+	redacted := *deadLetter
+	redacted.Notification = RedactNotification(deadLetter.Notification)
+	return &redacted
+}
+
+// returns a copy of the escalation with the secrets masked
+func redactEscalation(escalation *Escalation) *Escalation {
+	redacted := *escalation
+	redacted.Notification = RedactNotification(escalation.Notification)
+	redacted.AcknowledgedBy = RedactSecret(escalation.AcknowledgedBy)
+	redacted.Steps = nil
+	for _, step := range escalation.Steps {
+		step.User = RedactSecret(step.User)
+		redacted.Steps = append(redacted.Steps, step)
+	}
+	return &redacted
+}
+
+// returns a copy of the group with the user keys masked
+func redactGroup(group *Group) *Group {
+	redacted := &Group{Name: group.Name}
+	for _, member := range group.Members {
+		redacted.Members = append(redacted.Members, GroupMember{User: RedactSecret(member.User), Device: member.Device})
+	}
+	return redacted
+}
+
+// writes the value as the JSON response body
+func writeAdminJSON(ctx context.Context, w http.ResponseWriter, responseCode int, value interface{}) {
+	responseBody, err := json.Marshal(value)
+	if err != nil {
+		responseCode = http.StatusInternalServerError
+		responseBody = []byte("{}")
+	}
+	GetLogger(ctx).Info("Writing admin API response.", logKeyStatusCode, responseCode)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(responseCode)
+	w.Write(responseBody)
+}
+
+// writes the error response body
+func writeAdminError(ctx context.Context, w http.ResponseWriter, responseCode int, err error) {
+	GetLogger(ctx).Warn("Admin API request failed.", logKeyStatusCode, responseCode, logKeyError, err)
+	writeAdminJSON(ctx, w, responseCode, AdminErrorResponse{Request: GetRequestID(ctx), Error: err.Error()})
+}
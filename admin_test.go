@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// creates the server with the admin API of the processor with the empty queue and dead letters, the admin token is "secret-admin-token"
+func newTestAdminServer(t *testing.T) (*Server, *Processor) {
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.DeadLetterRepository = newTestDeadLetterRepository(t)
+	server := NewServer(0, "", "", processor)
+	adminHandler := NewAdminHandler(processor, map[string]string{"alice": "secret-admin-token"})
+	processor.EscalationRepository = newTestEscalationRepository(t)
+	adminHandler.SetGroupRepository(newTestGroupRepository(t))
+	eventBus := NewEventBus()
+	processor.EventListeners = []MessageEventListener{eventBus}
+	adminHandler.SetEventBus(eventBus)
+	adminHandler.Register(server)
+	return server, processor
+}
+
+// sends the admin API request with the given bearer token to the server and returns the recorded response
+func sendAdminRequest(server *Server, method string, target string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+	server.mux.ServeHTTP(response, request)
+	return response
+}
+
+// stores the message into the queue
+func storeTestQueuedMessage(t *testing.T, processor *Processor, id string, tokenAlias string, user string, age time.Duration) {
+	err := processor.MessageRepository.Store(newTestQueuedMessage(id, tokenAlias, user, age))
+	if err != nil {
+		t.Fatalf("Storing of the message failed with error %s.", err)
+	}
+}
+
+// stores the dead letter
+func storeTestDeadLetter(t *testing.T, processor *Processor, id string, tokenAlias string, user string, state string, age time.Duration) {
+	err := processor.DeadLetterRepository.Store(&DeadLetter{QueuedMessage: *newTestQueuedMessage(id, tokenAlias, user, age), State: state, FailedAt: time.Now(), FinalError: "status code 400"})
+	if err != nil {
+		t.Fatalf("Storing of the dead letter failed with error %s.", err)
+	}
+}
+
+// stores the scheduled message, the delivery of which has not been attempted yet
+func storeTestScheduledMessage(t *testing.T, processor *Processor, id string, tokenAlias string, user string) {
+	message := newTestQueuedMessage(id, tokenAlias, user, time.Minute)
+	message.Attempts = 0
+	message.ScheduledAt = message.NextAttemptAt
+	err := processor.MessageRepository.Store(message)
+	if err != nil {
+		t.Fatalf("Storing of the scheduled message failed with error %s.", err)
+	}
+}
+
+// returns the queued message accepted before the given time
+func newTestQueuedMessage(id string, tokenAlias string, user string, age time.Duration) *QueuedMessage {
+	return &QueuedMessage{
+		ID:            id,
+		Notification:  PushNotification{Token: "azGDORePK8gMaC0QOYAMyEEuzJnyUi", User: user, Message: "<dummy message>"},
+		TokenAlias:    tokenAlias,
+		AcceptedAt:    time.Now().Add(-age),
+		Attempts:      1,
+		NextAttemptAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestAdminShouldRequireBearerToken(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		authorization        string
+		expectedResponseCode int
+	}{
+		{"ShouldRejectMissingToken", "", 401},
+		{"ShouldRejectInvalidToken", "Bearer wrong-token", 401},
+		{"ShouldRejectOtherScheme", "Basic secret-admin-token", 401},
+		{"ShouldRejectEmptyToken", "Bearer ", 401},
+		{"ShouldAcceptAdminToken", "Bearer secret-admin-token", 200},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, _ := newTestAdminServer(t)
+
+			// WHEN
+			request := httptest.NewRequest("GET", "/1/broker/queue", nil)
+			if tc.authorization != "" {
+				request.Header.Set("Authorization", tc.authorization)
+			}
+			response := httptest.NewRecorder()
+			server.mux.ServeHTTP(response, request)
+
+			// THEN
+			if response.Code != tc.expectedResponseCode {
+				t.Errorf("Response code %d received, expected %d.", response.Code, tc.expectedResponseCode)
+			}
+		})
+	}
+}
+
+func TestAdminShouldFilterQueue(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		query                string
+		expectedResponseCode int
+		expectedIDs          string
+	}{
+		{"ShouldListAll", "", 200, "oldest,old,new,reminder"},
+		{"ShouldFilterByTokenAlias", "?token_alias=ops", 200, "oldest,new,reminder"},
+		{"ShouldFilterByUser", "?user=team", 200, "old"},
+		{"ShouldFilterByMinAge", "?min_age=30m", 200, "oldest,old"},
+		{"ShouldFilterByMaxAge", "?max_age=30m", 200, "new,reminder"},
+		{"ShouldCombineFilters", "?token_alias=ops&min_age=30m", 200, "oldest"},
+		{"ShouldFilterByQueuedState", "?state=queued", 200, "oldest,old,new"},
+		{"ShouldFilterByScheduledState", "?state=scheduled", 200, "reminder"},
+		{"ShouldRejectInvalidAge", "?min_age=yesterday", 400, ""},
+		{"ShouldRejectFailedState", "?state=failed", 400, ""},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, processor := newTestAdminServer(t)
+			storeTestQueuedMessage(t, processor, "oldest", "ops", "admin", 3*time.Hour)
+			storeTestQueuedMessage(t, processor, "old", "", "team", 2*time.Hour)
+			storeTestQueuedMessage(t, processor, "new", "ops", "admin", time.Minute)
+			storeTestScheduledMessage(t, processor, "reminder", "ops", "admin")
+
+			// WHEN
+			response := sendAdminRequest(server, "GET", "/1/broker/queue"+tc.query, "secret-admin-token")
+
+			// THEN
+			if response.Code != tc.expectedResponseCode {
+				t.Fatalf("Response code %d received, expected %d.", response.Code, tc.expectedResponseCode)
+			}
+			if tc.expectedResponseCode != 200 {
+				return
+			}
+			var queue AdminQueueResponse
+			err := json.Unmarshal(response.Body.Bytes(), &queue)
+			if err != nil {
+				t.Fatalf("Response \"%s\" failed to decode with error %s.", response.Body.String(), err)
+			}
+			var ids []string
+			for _, message := range queue.Messages {
+				ids = append(ids, message.ID)
+			}
+			if strings.Join(ids, ",") != tc.expectedIDs || queue.Count != len(ids) {
+				t.Errorf("Messages %v (count %d) listed, expected %s.", ids, queue.Count, tc.expectedIDs)
+			}
+			if strings.Contains(response.Body.String(), "azGDORePK8gMaC0QOYAMyEEuzJnyUi") {
+				t.Error("The listing contains the token.")
+			}
+		})
+	}
+}
+
+func TestAdminShouldManageQueuedMessages(t *testing.T) {
+
+	var testcases = []struct {
+		id                    string
+		method                string
+		target                string
+		expectedResponseCode  int
+		expectedQueued        bool
+		expectedDeadLetter    bool
+		expectedImmediateNext bool
+	}{
+		{"ShouldGetMessage", "GET", "/1/broker/queue/msg", 200, true, true, false},
+		{"ShouldNotGetUnknownMessage", "GET", "/1/broker/queue/unknown", 404, true, true, false},
+		{"ShouldNotGetInvalidID", "GET", "/1/broker/queue/msg.json", 404, true, true, false},
+		{"ShouldDeleteMessage", "DELETE", "/1/broker/queue/msg", 200, false, true, false},
+		{"ShouldNotDeleteUnknownMessage", "DELETE", "/1/broker/queue/unknown", 404, true, true, false},
+		{"ShouldRetryQueuedMessage", "POST", "/1/broker/queue/msg/retry", 200, true, true, true},
+		{"ShouldNotRetryDeadLetter", "POST", "/1/broker/queue/deadmsg/retry", 404, true, true, false},
+		{"ShouldGetDeadLetter", "GET", "/1/broker/deadletters/deadmsg", 200, true, true, false},
+		{"ShouldDeleteDeadLetter", "DELETE", "/1/broker/deadletters/deadmsg", 200, true, false, false},
+		{"ShouldNotDeleteUnknownDeadLetter", "DELETE", "/1/broker/deadletters/unknown", 404, true, true, false},
+		{"ShouldReplayDeadLetter", "POST", "/1/broker/deadletters/deadmsg/replay", 200, true, false, true},
+		{"ShouldNotReplayQueuedMessage", "POST", "/1/broker/deadletters/msg/replay", 404, true, true, false},
+		{"ShouldCancelScheduledMessage", "DELETE", "/1/broker/scheduled/scheduled", 200, false, true, false},
+		{"ShouldNotCancelAttemptedMessage", "DELETE", "/1/broker/scheduled/msg", 404, true, true, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, processor := newTestAdminServer(t)
+			storeTestQueuedMessage(t, processor, "msg", "ops", "admin", time.Minute)
+			storeTestDeadLetter(t, processor, "deadmsg", "ops", "admin", deadLetterStateFailed, time.Minute)
+			storeTestScheduledMessage(t, processor, "scheduled", "ops", "admin")
+			targetID := "msg"
+			if strings.Contains(tc.target, "/deadletters/") {
+				targetID = "deadmsg"
+			}
+			if strings.HasSuffix(tc.target, "/scheduled") {
+				targetID = "scheduled"
+			}
+
+			// WHEN
+			response := sendAdminRequest(server, tc.method, tc.target, "secret-admin-token")
+
+			// THEN
+			if response.Code != tc.expectedResponseCode {
+				t.Errorf("Response code %d received, expected %d. Body: %s", response.Code, tc.expectedResponseCode, response.Body.String())
+			}
+			if strings.Contains(response.Body.String(), "azGDORePK8gMaC0QOYAMyEEuzJnyUi") {
+				t.Error("The response contains the token.")
+			}
+			message, err := processor.MessageRepository.Get(targetID)
+			if err != nil {
+				t.Fatalf("Reading of the queue failed with error %s.", err)
+			}
+			deadLetter, err := processor.DeadLetterRepository.Get(targetID)
+			if err != nil {
+				t.Fatalf("Reading of the dead letters failed with error %s.", err)
+			}
+			if targetID != "deadmsg" && (message != nil) != tc.expectedQueued {
+				t.Errorf("The message is queued %t, expected %t.", message != nil, tc.expectedQueued)
+			}
+			if targetID == "deadmsg" && (deadLetter != nil) != tc.expectedDeadLetter {
+				t.Errorf("The dead letter is stored %t, expected %t.", deadLetter != nil, tc.expectedDeadLetter)
+			}
+			if tc.expectedImmediateNext && (message == nil || message.NextAttemptAt.After(time.Now())) {
+				t.Errorf("The message %v is not scheduled for the immediate attempt.", message)
+			}
+		})
+	}
+}
+
+func TestAdminShouldExportDeadLetters(t *testing.T) {
+
+	// GIVEN
+	server, processor := newTestAdminServer(t)
+	storeTestDeadLetter(t, processor, "first", "ops", "admin", deadLetterStateFailed, time.Hour)
+	storeTestDeadLetter(t, processor, "second", "backup", "admin", deadLetterStateFailed, time.Minute)
+	storeTestDeadLetter(t, processor, "third", "ops", "admin", deadLetterStateExpired, time.Minute)
+
+	// WHEN
+	response := sendAdminRequest(server, "GET", "/1/broker/deadletters/export?token_alias=ops&state=failed", "secret-admin-token")
+
+	// THEN
+	if response.Code != 200 {
+		t.Fatalf("Response code %d received, expected 200.", response.Code)
+	}
+	if !strings.HasPrefix(response.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("Content-Disposition \"%s\" received, expected attachment.", response.Header().Get("Content-Disposition"))
+	}
+	var deadLetters []*DeadLetter
+	err := json.Unmarshal(response.Body.Bytes(), &deadLetters)
+	if err != nil {
+		t.Fatalf("Response \"%s\" failed to decode with error %s.", response.Body.String(), err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].ID != "first" || deadLetters[0].FinalError != "status code 400" {
+		t.Errorf("Dead letters %v exported, expected the first one.", deadLetters)
+	}
+}
+
+func TestAdminShouldListScheduledMessages(t *testing.T) {
+
+	// GIVEN
+	server, processor := newTestAdminServer(t)
+	storeTestQueuedMessage(t, processor, "msg", "ops", "admin", time.Minute)
+	storeTestScheduledMessage(t, processor, "reminder", "ops", "admin")
+
+	// WHEN
+	response := sendAdminRequest(server, "GET", "/1/broker/scheduled", "secret-admin-token")
+
+	// THEN
+	if response.Code != 200 {
+		t.Fatalf("Response code %d received, expected 200.", response.Code)
+	}
+	var queue AdminQueueResponse
+	err := json.Unmarshal(response.Body.Bytes(), &queue)
+	if err != nil {
+		t.Fatalf("Response \"%s\" failed to decode with error %s.", response.Body.String(), err)
+	}
+	if queue.Count != 1 || queue.Messages[0].ID != "reminder" || queue.Messages[0].ScheduledAt.IsZero() {
+		t.Errorf("Messages %v listed, expected the scheduled reminder only.", queue.Messages)
+	}
+}
+
+func TestAdminShouldManageGroups(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		body                 string
+		expectedResponseCode int
+		expectedGroups       int
+	}{
+		{"ShouldStoreGroup", `{"members":[{"user":"alice-user-key"},{"user":"bob","device":"phone"}]}`, 200, 1},
+		{"ShouldRejectEmptyGroup", `{"members":[]}`, 400, 0},
+		{"ShouldRejectNestedGroup", `{"members":[{"user":"group:admins"}]}`, 400, 0},
+		{"ShouldRejectInvalidBody", `members`, 400, 0},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, _ := newTestAdminServer(t)
+			request := httptest.NewRequest("PUT", "/1/broker/groups/oncall", strings.NewReader(tc.body))
+			request.Header.Set("Authorization", "Bearer secret-admin-token")
+			response := httptest.NewRecorder()
+
+			// WHEN
+			server.mux.ServeHTTP(response, request)
+
+			// THEN
+			if response.Code != tc.expectedResponseCode {
+				t.Fatalf("Response code %d received, expected %d.", response.Code, tc.expectedResponseCode)
+			}
+			if strings.Contains(response.Body.String(), "alice-user-key") {
+				t.Errorf("Response \"%s\" contains the unredacted user key.", response.Body.String())
+			}
+			listResponse := sendAdminRequest(server, "GET", "/1/broker/groups", "secret-admin-token")
+			var groups AdminGroupsResponse
+			err := json.Unmarshal(listResponse.Body.Bytes(), &groups)
+			if err != nil {
+				t.Fatalf("Response \"%s\" failed to decode with error %s.", listResponse.Body.String(), err)
+			}
+			if groups.Count != tc.expectedGroups {
+				t.Errorf("%d groups listed, expected %d.", groups.Count, tc.expectedGroups)
+			}
+		})
+	}
+}
+
+func TestAdminShouldDeleteGroups(t *testing.T) {
+
+	// GIVEN
+	server, _ := newTestAdminServer(t)
+	request := httptest.NewRequest("PUT", "/1/broker/groups/oncall", strings.NewReader(`{"members":[{"user":"alice"}]}`))
+	request.Header.Set("Authorization", "Bearer secret-admin-token")
+	server.mux.ServeHTTP(httptest.NewRecorder(), request)
+
+	// WHEN
+	deleteResponse := sendAdminRequest(server, "DELETE", "/1/broker/groups/oncall", "secret-admin-token")
+	repeatedResponse := sendAdminRequest(server, "DELETE", "/1/broker/groups/oncall", "secret-admin-token")
+	getResponse := sendAdminRequest(server, "GET", "/1/broker/groups/oncall", "secret-admin-token")
+
+	// THEN
+	if deleteResponse.Code != 200 {
+		t.Errorf("Response code %d received for the delete, expected 200.", deleteResponse.Code)
+	}
+	if repeatedResponse.Code != 404 {
+		t.Errorf("Response code %d received for the repeated delete, expected 404.", repeatedResponse.Code)
+	}
+	if getResponse.Code != 404 {
+		t.Errorf("Response code %d received for the get, expected 404.", getResponse.Code)
+	}
+}
+
+func TestAdminShouldManageEscalations(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		state                string
+		expectedResponseCode int
+		expectedState        string
+		expectedCancelled    string
+	}{
+		{"ShouldCancelActiveEscalation", escalationStateActive, 200, escalationStateCancelled, "r1,r2"},
+		{"ShouldNotCancelAcknowledgedEscalation", escalationStateAcknowledged, 404, escalationStateAcknowledged, ""},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, processor := newTestAdminServer(t)
+			rcm := NewReceiptsCheckerMock()
+			processor.ReceiptsChecker = rcm
+			steps := []EscalationStep{{User: "alice-user-key", RequestID: "emergency", Receipt: "r1"}, {User: "bob", RequestID: "step", Receipt: "r2"}}
+			processor.EscalationRepository.Store(&Escalation{ID: "emergency", Policy: "db", Notification: PushNotification{Token: "<dummy token>", User: "alice-user-key", Message: "<db down>"}, State: tc.state, Steps: steps})
+
+			// WHEN
+			cancelResponse := sendAdminRequest(server, "DELETE", "/1/broker/escalations/emergency", "secret-admin-token")
+			getResponse := sendAdminRequest(server, "GET", "/1/broker/escalations/emergency", "secret-admin-token")
+
+			// THEN
+			if cancelResponse.Code != tc.expectedResponseCode {
+				t.Errorf("Response code %d received for the cancel, expected %d.", cancelResponse.Code, tc.expectedResponseCode)
+			}
+			var escalation Escalation
+			err := json.Unmarshal(getResponse.Body.Bytes(), &escalation)
+			if err != nil {
+				t.Fatalf("Response \"%s\" failed to decode with error %s.", getResponse.Body.String(), err)
+			}
+			if escalation.State != tc.expectedState {
+				t.Errorf("Escalation state %s returned, expected %s.", escalation.State, tc.expectedState)
+			}
+			if strings.Contains(getResponse.Body.String(), "alice-user-key") {
+				t.Errorf("Response \"%s\" contains the unredacted user key.", getResponse.Body.String())
+			}
+			if strings.Join(rcm.cancelled, ",") != tc.expectedCancelled {
+				t.Errorf("Receipts %v cancelled, expected %s.", rcm.cancelled, tc.expectedCancelled)
+			}
+		})
+	}
+}
+
+// TestAdminShouldStreamEvents tests whether the admin API streams the filtered and redacted events of the messages
+func TestAdminShouldStreamEvents(t *testing.T) {
+
+	var testcases = []struct {
+		id              string
+		query           string
+		expectedRequest string // request of the first streamed event
+		expectedType    string
+	}{
+		{"ShouldStreamAllEvents", "", "first", "accepted"},
+		{"ShouldFilterByTokenAlias", "?token_alias=monitoring", "second", "accepted"},
+		{"ShouldFilterByUserAlias", "?user=alice", "second", "accepted"},
+		{"ShouldFilterByUserKey", "?user=alice-user-key", "second", "accepted"},
+		{"ShouldFilterByType", "?type=delivered", "first", "delivered"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server, processor := newTestAdminServer(t)
+			processor.TokenVault = NewTokenVault(map[string]string{"backup": "backup-token", "monitoring": "monitoring-token"}, map[string]string{"alice": "alice-user-key"}, nil, false)
+			httpServer := httptest.NewServer(server.mux)
+			defer httpServer.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			request, _ := http.NewRequestWithContext(ctx, "GET", httpServer.URL+"/1/broker/events"+tc.query, nil)
+			request.Header.Set("Authorization", "Bearer secret-admin-token")
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatalf("Event stream request failed with error %s.", err)
+			}
+			defer response.Body.Close()
+			reader := bufio.NewReader(response.Body)
+			connected, _ := reader.ReadString('\n')
+			reader.ReadString('\n')
+
+			// WHEN
+			processor.HandleMessage(WithRequestID(context.Background(), "first"), &PushNotificationHandlingResponse{}, PushNotification{Token: "backup", User: "bob-user-key", Message: "<dummy message>"})
+			processor.HandleMessage(WithRequestID(context.Background(), "second"), &PushNotificationHandlingResponse{}, PushNotification{Token: "monitoring", User: "alice", Message: "<dummy message>"})
+			lines := make([]string, 3)
+			for i := range lines {
+				lines[i], err = reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("Reading of the event failed with error %s.", err)
+				}
+			}
+
+			// THEN
+			if response.StatusCode != 200 || response.Header.Get("Content-Type") != "text/event-stream" || connected != ": connected\n" {
+				t.Fatalf("Response code %d with content type %s and first line %s received, expected the event stream.", response.StatusCode, response.Header.Get("Content-Type"), connected)
+			}
+			if lines[1] != "event: "+tc.expectedType+"\n" {
+				t.Errorf("Event line %s received, expected the type %s.", lines[1], tc.expectedType)
+			}
+			var event MessageEvent
+			err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event)
+			if err != nil {
+				t.Fatalf("Event data %s failed to decode with error %s.", lines[2], err)
+			}
+			if lines[0] != "id: "+event.ID+"\n" || event.Request != tc.expectedRequest || event.Type != tc.expectedType {
+				t.Errorf("Event %s %v received, expected the request %s.", lines[0], event, tc.expectedRequest)
+			}
+			if strings.Contains(lines[2], "user-key") {
+				t.Errorf("Event data %s contains the unredacted user key.", lines[2])
+			}
+		})
+	}
+}
+
+// TestAdminShouldRejectInvalidEventType tests whether the admin API rejects the event stream of an unknown event type
+func TestAdminShouldRejectInvalidEventType(t *testing.T) {
+
+	// GIVEN
+	server, _ := newTestAdminServer(t)
+
+	// WHEN
+	response := sendAdminRequest(server, "GET", "/1/broker/events?type=unknown", "secret-admin-token")
+
+	// THEN
+	if response.Code != 400 {
+		t.Errorf("Response code %d received, expected 400.", response.Code)
+	}
+}
+
+// TestAdminShouldListLimits tests whether the admin API lists the limits of the tokens by their aliases or redacted tokens
+func TestAdminShouldListLimits(t *testing.T) {
+
+	// GIVEN
+	server, processor := newTestAdminServer(t)
+	processor.TokenVault = NewTokenVault(map[string]string{"backup": "backup-application-token"}, nil, nil, false)
+	processor.LimitsCounter.SetLimits("backup-application-token", &Limits{limit: 10000, remaining: 9000, reset: 1767258000})
+	processor.LimitsCounter.SetLimits("other-application-token", &Limits{limit: 7500, remaining: 10, reset: 1767258000})
+
+	// WHEN
+	response := sendAdminRequest(server, "GET", "/1/broker/limits", "secret-admin-token")
+
+	// THEN
+	var limits AdminLimitsResponse
+	err := json.Unmarshal(response.Body.Bytes(), &limits)
+	if response.Code != 200 || err != nil {
+		t.Fatalf("Response code %d with body %s received, expected 200.", response.Code, response.Body.String())
+	}
+	expectedLimits := []AdminLimits{{Token: "backup", Limit: 10000, Remaining: 9000, Reset: 1767258000}, {Token: RedactSecret("other-application-token"), Limit: 7500, Remaining: 10, Reset: 1767258000}}
+	if limits.Count != 2 || !slices.Equal(limits.Limits, expectedLimits) {
+		t.Errorf("Limits %v returned, expected %v.", limits, expectedLimits)
+	}
+}
+
+// TestAdminShouldNotServeDeadLettersWithoutStore tests whether the dead letters are not available if the processor does not store them
+func TestAdminShouldNotServeDeadLettersWithoutStore(t *testing.T) {
+
+	var testcases = []struct {
+		id     string
+		method string
+		target string
+	}{
+		{"ShouldNotList", "GET", "/1/broker/deadletters"},
+		{"ShouldNotExport", "GET", "/1/broker/deadletters/export"},
+		{"ShouldNotGet", "GET", "/1/broker/deadletters/failed"},
+		{"ShouldNotDelete", "DELETE", "/1/broker/deadletters/failed"},
+		{"ShouldNotReplay", "POST", "/1/broker/deadletters/failed/replay"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+			server := NewServer(0, "", "", processor)
+			NewAdminHandler(processor, map[string]string{"alice": "secret-admin-token"}).Register(server)
+
+			// WHEN
+			response := sendAdminRequest(server, tc.method, tc.target, "secret-admin-token")
+
+			// THEN
+			if response.Code != 404 {
+				t.Errorf("Response code %d received, expected 404.", response.Code)
+			}
+		})
+	}
+}
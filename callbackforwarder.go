@@ -0,0 +1,20 @@
+package main
+
+import "context"
+
+// AcknowledgementEvent represents the acknowledgement of the emergency message forwarded to the callback URL of the client
+type AcknowledgementEvent struct {
+	Event          string `json:"event"`           // always "acknowledged"
+	Request        string `json:"request"`         // request of the original message
+	Receipt        string `json:"receipt"`         // receipt of the acknowledged notification
+	AcknowledgedAt int64  `json:"acknowledged_at"` // Unix time of the acknowledgement
+	AcknowledgedBy string `json:"acknowledged_by"` // user key acknowledging the message
+	Title          string `json:"title,omitempty"`
+	Message        string `json:"message"`
+}
+
+// CallbackForwarder represents the sender of the acknowledgement events to the callback URLs of the clients
+type CallbackForwarder interface {
+	// ForwardCallback posts the event to the callback URL and returns error if the event was not accepted
+	ForwardCallback(ctx context.Context, callbackURL string, event *AcknowledgementEvent) error
+}
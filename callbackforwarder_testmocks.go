@@ -0,0 +1,26 @@
+package main
+
+import "context"
+
+// CallbackForwarderMock implements the CallbackForwarder interface
+type CallbackForwarderMock struct {
+	responseErr error                   // error returned by all the calls
+	events      []*AcknowledgementEvent // all the forwarded events
+	urls        []string                // callback URLs of the forwarded events
+	onForward   func()                  // called while the event is being forwarded, if set
+}
+
+// NewCallbackForwarderMock initializes the mock
+func NewCallbackForwarderMock() *CallbackForwarderMock {
+	return new(CallbackForwarderMock)
+}
+
+// ForwardCallback records the event and returns the predefined error
+func (cfm *CallbackForwarderMock) ForwardCallback(ctx context.Context, callbackURL string, event *AcknowledgementEvent) error {
+	cfm.events = append(cfm.events, event)
+	cfm.urls = append(cfm.urls, callbackURL)
+	if cfm.onForward != nil {
+		cfm.onForward()
+	}
+	return cfm.responseErr
+}
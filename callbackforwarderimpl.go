@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the headers of the forwarded callbacks and webhook events, the signature is computed over "<timestamp>.<body>"
+const (
+	callbackTimestampHeader = "X-Broker-Timestamp"
+	callbackSignatureHeader = "X-Broker-Signature"
+)
+
+// time limit of the callback request
+const callbackTimeout = 10 * time.Second
+
+// CallbackForwarderImpl implements the CallbackForwarder interface, the events are posted as JSON signed by HMAC-SHA256
+type CallbackForwarderImpl struct {
+	client *http.Client
+	secret []byte // the events are not signed if empty
+}
+
+// NewCallbackForwarderImpl creates a new callback forwarder signing the events by the secret (not signed if empty)
+func NewCallbackForwarderImpl(secret string) *CallbackForwarderImpl {
+	cf := new(CallbackForwarderImpl)
+	cf.client = &http.Client{Timeout: callbackTimeout}
+
+	// the redirects are not followed, they could lead outside the allowed callback URL prefixes
+	cf.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	cf.secret = []byte(secret)
+	return cf
+}
+
+// ForwardCallback posts the event to the callback URL and returns error if the event was not accepted (see CallbackForwarder)
+func (cf *CallbackForwarderImpl) ForwardCallback(ctx context.Context, callbackURL string, event *AcknowledgementEvent) error {
+	ctx, span := getTracer().Start(ctx, "CallbackForwarderImpl.ForwardCallback", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	err := postSignedJSON(ctx, cf.client, callbackURL, cf.secret, event)
+	if err != nil {
+		return recordSpanError(span, fmt.Errorf("the callback failed with error %s", err.Error()))
+	}
+	return nil
+}
+
+// posts the value as the JSON body signed by the secret (not signed if empty), returns error unless the request is answered by 2xx
+func postSignedJSON(ctx context.Context, client *http.Client, targetURL string, secret []byte, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding of the event failed with error %s", err.Error())
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating of the request failed with error %s", err.Error())
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackTimestampHeader, timestamp)
+	if len(secret) > 0 {
+		req.Header.Set(callbackSignatureHeader, signCallback(secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending the request failed with error %s", err.Error())
+	}
+	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int(traceKeyStatusCode, resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the request was rejected with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// returns the signature header value of the callback body sent at the timestamp
+func signCallback(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallbackForwarderShouldPostSignedEvent(t *testing.T) {
+
+	var testcases = []struct {
+		id                string
+		secret            string
+		statusCode        int
+		expectedSignature bool
+		expectedErr       bool
+	}{
+		{"ShouldSignEvent", "callback-secret", 200, true, false},
+		{"ShouldNotSignWithoutSecret", "", 204, false, false},
+		{"ShouldFailOnRejection", "callback-secret", 500, true, true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			var receivedEvent AcknowledgementEvent
+			var receivedSignature, expectedSignature string
+			service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				json.Unmarshal(body, &receivedEvent)
+				receivedSignature = r.Header.Get(callbackSignatureHeader)
+				expectedSignature = signCallback([]byte("callback-secret"), r.Header.Get(callbackTimestampHeader), body)
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer service.Close()
+			forwarder := NewCallbackForwarderImpl(tc.secret)
+			event := &AcknowledgementEvent{Event: "acknowledged", Request: "emergency", Receipt: "r1", AcknowledgedAt: 1767258000, AcknowledgedBy: "alice", Message: "<db down>"}
+
+			// WHEN
+			err := forwarder.ForwardCallback(context.Background(), service.URL+"/ack", event)
+
+			// THEN
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Forwarding returned error %v, expected error %t.", err, tc.expectedErr)
+			}
+			if receivedEvent != *event {
+				t.Errorf("Event %v received, expected %v.", receivedEvent, *event)
+			}
+			if tc.expectedSignature && receivedSignature != expectedSignature {
+				t.Errorf("Signature \"%s\" received, expected \"%s\".", receivedSignature, expectedSignature)
+			}
+			if !tc.expectedSignature && receivedSignature != "" {
+				t.Errorf("Signature \"%s\" received, expected none.", receivedSignature)
+			}
+		})
+	}
+}
+
+func TestCallbackForwarderShouldNotFollowRedirects(t *testing.T) {
+
+	// GIVEN
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/internal", http.StatusTemporaryRedirect)
+	}))
+	defer service.Close()
+	forwarder := NewCallbackForwarderImpl("")
+
+	// WHEN
+	err := forwarder.ForwardCallback(context.Background(), service.URL+"/ack", &AcknowledgementEvent{Event: "acknowledged", Request: "emergency"})
+
+	// THEN
+	if err == nil || redirected {
+		t.Errorf("Forwarding returned error %v and followed the redirect %t, expected error without following.", err, redirected)
+	}
+}
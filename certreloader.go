@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CertificateReloader keeps the server certificate loaded from the certificate and key files and swaps it for a new one
+// whenever the files change on the disk or the process receives SIGHUP
+type CertificateReloader struct {
+	certFilePath     string
+	keyFilePath      string
+	certificate      *tls.Certificate
+	certModTime      time.Time
+	keyModTime       time.Time
+	certificateMutex sync.RWMutex
+}
+
+// NewCertificateReloader creates a new certificate reloader and loads the initial certificate
+func NewCertificateReloader(certFilePath string, keyFilePath string) (*CertificateReloader, error) {
+	cr := new(CertificateReloader)
+	cr.certFilePath = certFilePath
+	cr.keyFilePath = keyFilePath
+
+	// the initial certificate must be loaded, there is nothing to fall back to
+	err := cr.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate (see tls.Config.GetCertificate)
+func (cr *CertificateReloader) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	// lock the mutex for reading
+	cr.certificateMutex.RLock()
+	defer cr.certificateMutex.RUnlock()
+
+	return cr.certificate, nil
+}
+
+// Reload loads the certificate and key files and replaces the current certificate. On failure the current certificate is kept.
+func (cr *CertificateReloader) Reload() error {
+
+	// get the modification times before loading, so that a change during the loading is detected on the next check
+	certModTime, keyModTime, err := cr.getModTimes()
+	if err != nil {
+		return err
+	}
+
+	// load the new pair
+	certificate, err := tls.LoadX509KeyPair(cr.certFilePath, cr.keyFilePath)
+	if err != nil {
+		return fmt.Errorf("loading of the certificate %s and key %s failed with error %s", cr.certFilePath, cr.keyFilePath, err.Error())
+	}
+
+	// parse the leaf certificate to be able to report the expiry
+	if len(certificate.Certificate) == 0 {
+		return errors.New("the certificate file does not contain any certificate")
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing of the certificate %s failed with error %s", cr.certFilePath, err.Error())
+	}
+	certificate.Leaf = leaf
+
+	// swap the certificate
+	cr.certificateMutex.Lock()
+	cr.certificate = &certificate
+	cr.certModTime = certModTime
+	cr.keyModTime = keyModTime
+	cr.certificateMutex.Unlock()
+
+	slog.Info("Loaded server certificate.", "file", cr.certFilePath, "subject", leaf.Subject.String(), "not_after", leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// Watch checks the certificate files for changes every interval and reloads them on change or on SIGHUP. Never returns.
+func (cr *CertificateReloader) Watch(interval time.Duration) {
+
+	// subscribe for the SIGHUP signal
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hangup:
+			slog.Info("Received SIGHUP, reloading the server certificate.")
+			cr.reloadAndLog()
+
+		case <-ticker.C:
+			if cr.filesChanged() {
+				slog.Info("Server certificate files changed, reloading the server certificate.")
+				cr.reloadAndLog()
+			}
+		}
+	}
+}
+
+// reloads the certificate and logs the failure, the current certificate stays in use in that case
+func (cr *CertificateReloader) reloadAndLog() {
+	err := cr.Reload()
+	if err != nil {
+		slog.Error("Reloading of the server certificate failed, keeping the current certificate.", logKeyError, err)
+	}
+}
+
+// returns true if any of the certificate files modification time differs from the currently loaded files
+func (cr *CertificateReloader) filesChanged() bool {
+	certModTime, keyModTime, err := cr.getModTimes()
+	if err != nil {
+		// the files might be just being replaced, try again on the next check
+		return false
+	}
+
+	// lock the mutex for reading
+	cr.certificateMutex.RLock()
+	defer cr.certificateMutex.RUnlock()
+
+	return !certModTime.Equal(cr.certModTime) || !keyModTime.Equal(cr.keyModTime)
+}
+
+// returns the modification times of the certificate and key files
+func (cr *CertificateReloader) getModTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.certFilePath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(cr.keyFilePath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// writes a new self-signed certificate with the given serial number into the certificate and key files
+func writeTestCertificate(t *testing.T, certFilePath string, keyFilePath string, serialNumber int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed with error %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("certificate generation failed with error %s", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("key marshalling failed with error %s", err)
+	}
+	err = os.WriteFile(certFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("writing of the certificate failed with error %s", err)
+	}
+	err = os.WriteFile(keyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatalf("writing of the key failed with error %s", err)
+	}
+}
+
+// returns the serial number of the certificate currently provided by the reloader
+func getReloaderSerialNumber(t *testing.T, cr *CertificateReloader) int64 {
+	certificate, err := cr.GetCertificate(nil)
+	if err != nil || certificate == nil || certificate.Leaf == nil {
+		t.Fatalf("no certificate returned, error %v", err)
+	}
+	return certificate.Leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReloaderShouldSwapCertificateOnChange(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	certFilePath := path.Join(dir, "server.cert.pem")
+	keyFilePath := path.Join(dir, "server.key.pem")
+	writeTestCertificate(t, certFilePath, keyFilePath, 1)
+	cr, err := NewCertificateReloader(certFilePath, keyFilePath)
+	if err != nil {
+		t.Fatalf("reloader creation failed with error %s", err)
+	}
+
+	// WHEN
+	writeTestCertificate(t, certFilePath, keyFilePath, 2)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFilePath, later, later)
+	changed := cr.filesChanged()
+	err = cr.Reload()
+
+	// THEN
+	if !changed {
+		t.Errorf("The change of the certificate files was not detected.")
+	}
+	if err != nil {
+		t.Errorf("Reload failed with error %s, expected no error.", err)
+	}
+	if serialNumber := getReloaderSerialNumber(t, cr); serialNumber != 2 {
+		t.Errorf("Certificate with serial number %d provided, expected 2.", serialNumber)
+	}
+	if cr.filesChanged() {
+		t.Errorf("The certificate files reported as changed after the reload.")
+	}
+}
+
+func TestCertificateReloaderShouldKeepCertificateOnInvalidFiles(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	certFilePath := path.Join(dir, "server.cert.pem")
+	keyFilePath := path.Join(dir, "server.key.pem")
+	writeTestCertificate(t, certFilePath, keyFilePath, 1)
+	cr, err := NewCertificateReloader(certFilePath, keyFilePath)
+	if err != nil {
+		t.Fatalf("reloader creation failed with error %s", err)
+	}
+
+	// WHEN
+	os.WriteFile(certFilePath, []byte("not a certificate"), 0600)
+	err = cr.Reload()
+
+	// THEN
+	if err == nil {
+		t.Errorf("Reload of the invalid certificate succeeded, expected error.")
+	}
+	if serialNumber := getReloaderSerialNumber(t, cr); serialNumber != 1 {
+		t.Errorf("Certificate with serial number %d provided, expected the original 1.", serialNumber)
+	}
+}
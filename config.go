@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+// Duration is a time.Duration read from the configuration either as a string ("90s", "1h30m") or as a number of seconds
+type Duration time.Duration
+
+// UnmarshalJSON decodes the duration from the string or number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*d = Duration(time.Duration(value * float64(time.Second)))
+		return nil
+
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration \"%s\"", value)
+		}
+		*d = Duration(duration)
+		return nil
+
+	default:
+		return fmt.Errorf("invalid duration %s, expected string or number of seconds", string(data))
+	}
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config represents the broker configuration loaded from the JSON configuration file
+type Config struct {
+	Port         int    `json:"port"`           // port of the HTTPS server
+	CertFile     string `json:"cert_file"`      // server certificate file
+	KeyFile      string `json:"key_file"`       // server private key file
+	ClientCAFile string `json:"client_ca_file"` // CA bundle verifying the client certificates, client certificates are not required if empty
+	VaultConfig
+	VaultFile                string                      `json:"vault_file"`                 // optional file with the vault values, keeps the secrets out of the main configuration
+	LogFormat                string                      `json:"log_format"`                 // format of the log output, "text" or "json"
+	LogLevel                 string                      `json:"log_level"`                  // minimal level of the logged events, "debug", "info", "warn" or "error"
+	QueueDir                 string                      `json:"queue_dir"`                  // directory of the persistent queue of the messages waiting for the delivery
+	DeadLetterDir            string                      `json:"dead_letter_dir"`            // directory of the permanently failed queued messages
+	DeadLetterNotifyToken    string                      `json:"dead_letter_notify_token"`   // token (or alias) of the notification about the new dead letters
+	DeadLetterNotifyUser     string                      `json:"dead_letter_notify_user"`    // user (or alias) notified about the new dead letters, not notified if empty
+	RetryInterval            Duration                    `json:"retry_interval"`             // period of the repeated delivery attempts of the queued messages
+	MaxRetryDelay            Duration                    `json:"max_retry_delay"`            // maximal delay between two attempts of a queued message
+	MaxQueueAge              map[string]Duration         `json:"max_queue_age"`              // priority name -> age after which the queued message expires, if not given by broker_expire
+	UpstreamOfflineThreshold Duration                    `json:"upstream_offline_threshold"` // the failing Pushover API is reported offline after this time
+	IdempotencyWindow        Duration                    `json:"idempotency_window"`         // time for which the idempotency keys of the messages are remembered, 0 disables the keys
+	DedupWindow              Duration                    `json:"dedup_window"`               // the messages of the same content within this time are suppressed, 0 disables the deduplication
+	DedupSummary             bool                        `json:"dedup_summary"`              // send the "message repeated N times" summary when the deduplication window closes
+	DigestDir                string                      `json:"digest_dir"`                 // directory of the pending digests of the low priority messages
+	DigestInterval           Duration                    `json:"digest_interval"`            // the low priority messages of a user are sent as one digest after this time, 0 disables the digests
+	QuietHours               map[string]QuietHoursConfig `json:"quiet_hours"`                // user (alias or key) -> quiet hours of the user
+	Templates                map[string]TemplateConfig   `json:"templates"`                  // template name -> message template selected by the template form field
+	Routes                   []RouteConfig               `json:"routes"`                     // rules routing the messages to the additional recipients
+	GroupDir                 string                      `json:"group_dir"`                  // directory of the local recipient groups
+	Groups                   map[string][]GroupMember    `json:"groups"`                     // group name -> members, stored into the group_dir on the start
+	EscalationDir            string                      `json:"escalation_dir"`             // directory of the escalations of the emergency messages
+	Escalations              map[string]EscalationConfig `json:"escalations"`                // policy name -> escalation policy selected by the escalation parameter
+	CallbackURLPrefixes      []string                    `json:"callback_url_prefixes"`      // the allowed broker_callback URLs, e.g. "https://inventory.internal/", the callbacks are rejected if empty
+	WebhookDir               string                      `json:"webhook_dir"`                // directory of the persistent queue of the webhook events
+	Webhooks                 map[string]WebhookConfig    `json:"webhooks"`                   // webhook name -> subscription to the message lifecycle events
+	TracingExporter          string                      `json:"tracing_exporter"`           // exporter of the OpenTelemetry spans, "otlp", "stdout" or empty to disable the tracing
+	TracingEndpoint          string                      `json:"tracing_endpoint"`           // host:port of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* environment variables apply if empty
+}
+
+// VaultConfig represents the content of the token vault (see TokenVault)
+type VaultConfig struct {
+	Tokens         map[string]string `json:"tokens"`          // token alias -> Pushover application token
+	Users          map[string]string `json:"users"`           // user alias -> Pushover user key
+	APIKeys        map[string]string `json:"api_keys"`        // broker issued API key -> token alias
+	RequireVault   bool              `json:"require_vault"`   // reject the messages with tokens or users not known to the vault
+	AdminTokens    map[string]string `json:"admin_tokens"`    // administrator name -> bearer token of the admin API, the admin API is disabled if empty
+	CallbackSecret string            `json:"callback_secret"` // key of the HMAC-SHA256 signature of the forwarded callbacks, not signed if empty
+}
+
+// QuietHoursConfig represents the quiet hours of a user in the configuration
+type QuietHoursConfig struct {
+	Start    string `json:"start"`    // start of the quiet hours, e.g. "22:00"
+	End      string `json:"end"`      // end of the quiet hours, e.g. "07:00"
+	Timezone string `json:"timezone"` // IANA time zone of the start and end, e.g. "Europe/Prague", the local time zone if empty
+	Action   string `json:"action"`   // "defer" (default) holds the messages until the end, "downgrade" delivers them with priority -1
+}
+
+// TemplateConfig represents the message template in the configuration
+type TemplateConfig struct {
+	Title    string `json:"title"`    // text/template of the title, the variables are passed as the vars.* form fields
+	Message  string `json:"message"`  // text/template of the message
+	Priority *int   `json:"priority"` // default priority, if not given by the client
+	Sound    string `json:"sound"`    // default sound, if not given by the client
+	URL      string `json:"url"`      // default URL, if not given by the client
+}
+
+// RouteConfig represents the routing rule in the configuration, the rule applies to the messages matching both the channel and
+// the minimal priority
+type RouteConfig struct {
+	Channel     string   `json:"channel"`      // channel of the message, any channel if empty
+	MinPriority *int     `json:"min_priority"` // minimal priority of the message, any priority if not given
+	Users       []string `json:"users"`        // users (keys or aliases) receiving the matching messages
+	Device      string   `json:"device"`       // device(s) of the users, all the devices if empty
+}
+
+// EscalationConfig represents the escalation policy in the configuration
+type EscalationConfig struct {
+	AckTimeout Duration `json:"ack_timeout"` // time for the acknowledgement before the next user is notified
+	Users      []string `json:"users"`       // users (keys or aliases) notified one after another after the user of the message
+}
+
+// WebhookConfig represents the webhook subscription in the configuration
+type WebhookConfig struct {
+	URL    string   `json:"url"`    // http(s) URL receiving the events
+	Events []string `json:"events"` // types of the events (accepted, queued, retried, delivered, failed, expired, suppressed or digested), all if empty
+	Secret string   `json:"secret"` // key of the HMAC-SHA256 signature of the events, not signed if empty
+}
+
+// NewDefaultConfig creates the configuration with the default values, the files are expected in the private subdirectory of the baseDir
+func NewDefaultConfig(baseDir string) *Config {
+	c := new(Config)
+	c.Port = 8499
+	c.CertFile = path.Join(baseDir, "private", "server.cert.pem")
+	c.KeyFile = path.Join(baseDir, "private", "server.key.pem")
+	c.LogFormat = "text"
+	c.LogLevel = "info"
+	c.QueueDir = path.Join(baseDir, "private", "queue")
+	c.DeadLetterDir = path.Join(baseDir, "private", "deadletters")
+	c.DigestDir = path.Join(baseDir, "private", "digests")
+	c.GroupDir = path.Join(baseDir, "private", "groups")
+	c.EscalationDir = path.Join(baseDir, "private", "escalations")
+	c.WebhookDir = path.Join(baseDir, "private", "webhooks")
+	c.RetryInterval = Duration(defaultRetryInterval)
+	c.MaxRetryDelay = Duration(defaultMaxRetryDelay)
+	c.UpstreamOfflineThreshold = Duration(defaultUpstreamOfflineThreshold)
+	c.IdempotencyWindow = Duration(defaultIdempotencyWindow)
+	return c
+}
+
+// LoadConfig reads the configuration file. The values not present in the file keep their defaults, a missing file results in the default configuration.
+// Relative file paths in the configuration are relative to the baseDir.
+func LoadConfig(filePath string, baseDir string) (*Config, error) {
+	c := NewDefaultConfig(baseDir)
+
+	// read the file
+	content, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading of the configuration file %s failed with error %s", filePath, err.Error())
+	}
+
+	// decode the values over the defaults
+	err = json.Unmarshal(content, c)
+	if err != nil {
+		return nil, fmt.Errorf("parsing of the configuration file %s failed with error %s", filePath, err.Error())
+	}
+
+	// make the file paths absolute
+	c.CertFile = resolveConfigPath(baseDir, c.CertFile)
+	c.KeyFile = resolveConfigPath(baseDir, c.KeyFile)
+	c.ClientCAFile = resolveConfigPath(baseDir, c.ClientCAFile)
+	c.VaultFile = resolveConfigPath(baseDir, c.VaultFile)
+	c.QueueDir = resolveConfigPath(baseDir, c.QueueDir)
+	c.DeadLetterDir = resolveConfigPath(baseDir, c.DeadLetterDir)
+	c.DigestDir = resolveConfigPath(baseDir, c.DigestDir)
+	c.GroupDir = resolveConfigPath(baseDir, c.GroupDir)
+	c.EscalationDir = resolveConfigPath(baseDir, c.EscalationDir)
+	c.WebhookDir = resolveConfigPath(baseDir, c.WebhookDir)
+
+	// merge the vault file
+	if c.VaultFile != "" {
+		err = c.loadVaultFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// reads the vault file and merges its values into the configuration, the values in the vault file take precedence
+func (c *Config) loadVaultFile() error {
+	content, err := os.ReadFile(c.VaultFile)
+	if err != nil {
+		return fmt.Errorf("reading of the vault file %s failed with error %s", c.VaultFile, err.Error())
+	}
+	var vault VaultConfig
+	err = json.Unmarshal(content, &vault)
+	if err != nil {
+		return fmt.Errorf("parsing of the vault file %s failed with error %s", c.VaultFile, err.Error())
+	}
+	c.Tokens = mergeStringMaps(c.Tokens, vault.Tokens)
+	c.Users = mergeStringMaps(c.Users, vault.Users)
+	c.APIKeys = mergeStringMaps(c.APIKeys, vault.APIKeys)
+	c.AdminTokens = mergeStringMaps(c.AdminTokens, vault.AdminTokens)
+	c.RequireVault = c.RequireVault || vault.RequireVault
+	if vault.CallbackSecret != "" {
+		c.CallbackSecret = vault.CallbackSecret
+	}
+	return nil
+}
+
+// GetRetryDelays returns the retry interval and the maximal delay between two attempts of the queued messages and webhooks
+func (c *Config) GetRetryDelays() (time.Duration, time.Duration, error) {
+	if c.RetryInterval <= 0 {
+		return 0, 0, fmt.Errorf("invalid retry_interval %s, expected a positive duration", time.Duration(c.RetryInterval))
+	}
+	if c.MaxRetryDelay <= 0 {
+		return 0, 0, fmt.Errorf("invalid max_retry_delay %s, expected a positive duration", time.Duration(c.MaxRetryDelay))
+	}
+	return time.Duration(c.RetryInterval), time.Duration(c.MaxRetryDelay), nil
+}
+
+// GetDeadLetterNotification returns the notification about the new dead letters, nil if the administrator is not notified
+func (c *Config) GetDeadLetterNotification() (*PushNotification, error) {
+	if c.DeadLetterNotifyUser == "" {
+		return nil, nil
+	}
+	if c.DeadLetterNotifyToken == "" {
+		return nil, errors.New("dead_letter_notify_user requires dead_letter_notify_token")
+	}
+	return &PushNotification{Token: c.DeadLetterNotifyToken, User: c.DeadLetterNotifyUser}, nil
+}
+
+// GetMaxQueueAges returns the maximal queue ages by the Pushover priority
+func (c *Config) GetMaxQueueAges() (map[int]time.Duration, error) {
+	maxQueueAges := make(map[int]time.Duration)
+	for name, age := range c.MaxQueueAge {
+		priority, found := priorityNames[name]
+		if !found {
+			return nil, fmt.Errorf("unsupported priority \"%s\" in max_queue_age, expected lowest, low, normal, high or emergency", name)
+		}
+		maxQueueAges[priority] = time.Duration(age)
+	}
+	return maxQueueAges, nil
+}
+
+// GetQuietHours returns the quiet hours by the user (alias or key)
+func (c *Config) GetQuietHours() (map[string]*QuietHours, error) {
+	quietHours := make(map[string]*QuietHours)
+	for user, quietHoursConfig := range c.QuietHours {
+		userQuietHours, err := NewQuietHours(quietHoursConfig.Start, quietHoursConfig.End, quietHoursConfig.Timezone, quietHoursConfig.Action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours of the user %s: %s", RedactSecret(user), err.Error())
+		}
+		quietHours[user] = userQuietHours
+	}
+	return quietHours, nil
+}
+
+// GetTemplates returns the parsed message templates by their names
+func (c *Config) GetTemplates() (map[string]*MessageTemplate, error) {
+	templates := make(map[string]*MessageTemplate)
+	for name, templateConfig := range c.Templates {
+		messageTemplate, err := NewMessageTemplate(name, templateConfig.Title, templateConfig.Message, templateConfig.Priority, templateConfig.Sound, templateConfig.URL)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = messageTemplate
+	}
+	return templates, nil
+}
+
+// GetRoutes returns the routing rules
+func (c *Config) GetRoutes() ([]*Route, error) {
+	var routes []*Route
+	for i, routeConfig := range c.Routes {
+		if len(routeConfig.Users) == 0 {
+			return nil, fmt.Errorf("the route %d has no users", i+1)
+		}
+		routes = append(routes, NewRoute(routeConfig.Channel, routeConfig.MinPriority, routeConfig.Users, routeConfig.Device))
+	}
+	return routes, nil
+}
+
+// GetEscalationPolicies returns the escalation policies by their names
+func (c *Config) GetEscalationPolicies() (map[string]*EscalationPolicy, error) {
+	policies := make(map[string]*EscalationPolicy)
+	for name, escalationConfig := range c.Escalations {
+		policy, err := NewEscalationPolicy(name, time.Duration(escalationConfig.AckTimeout), escalationConfig.Users)
+		if err != nil {
+			return nil, err
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
+
+// GetWebhooks returns the webhook subscriptions
+func (c *Config) GetWebhooks() ([]*Webhook, error) {
+	var webhooks []*Webhook
+	for name, webhookConfig := range c.Webhooks {
+		webhook, err := NewWebhook(name, webhookConfig.URL, webhookConfig.Events, webhookConfig.Secret)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// GetValidationRules returns the rules of the message validation of the configuration
+func (c *Config) GetValidationRules() (ValidationRules, error) {
+	for _, prefix := range c.CallbackURLPrefixes {
+		prefixURL, err := url.Parse(prefix)
+		if err != nil || (prefixURL.Scheme != "http" && prefixURL.Scheme != "https") || prefixURL.Host == "" || prefixURL.User != nil {
+			return ValidationRules{}, fmt.Errorf("invalid callback URL prefix \"%s\", expected an absolute http(s) URL", prefix)
+		}
+	}
+	return ValidationRules{CallbackURLPrefixes: c.CallbackURLPrefixes}, nil
+}
+
+// returns the map with the values of both maps, the values of the second map take precedence
+func mergeStringMaps(first map[string]string, second map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for key, value := range first {
+		merged[key] = value
+	}
+	for key, value := range second {
+		merged[key] = value
+	}
+	return merged
+}
+
+// returns the filePath relative to the baseDir, unless it is empty or absolute
+func resolveConfigPath(baseDir string, filePath string) string {
+	if filePath == "" || path.IsAbs(filePath) {
+		return filePath
+	}
+	return path.Join(baseDir, filePath)
+}
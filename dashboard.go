@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// the static files of the dashboard, the data are loaded by the browser from the admin API
+//
+//go:embed web/dashboard
+var dashboardFiles embed.FS
+
+// dashboardPath is the path the dashboard is served under
+const dashboardPath = "/dashboard/"
+
+// NewDashboardHandler creates a new handler serving the embedded web dashboard. The files contain no data, the dashboard
+// authenticates to the admin API by the administrator bearer token entered in the browser.
+func NewDashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "web/dashboard")
+	if err != nil {
+		// the embedded directory always exists
+		panic(err)
+	}
+	fileServer := http.StripPrefix(dashboardPath, http.FileServerFS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the dashboard loads only its own scripts and styles and it cannot be framed by other sites
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDashboardShouldServeEmbeddedFiles tests whether the dashboard handler serves the embedded files with the security headers
+func TestDashboardShouldServeEmbeddedFiles(t *testing.T) {
+
+	var testcases = []struct {
+		id                  string
+		target              string
+		expectedCode        int // any redirect if 300
+		expectedContentType string
+		expectedLocation    string
+	}{
+		{"ShouldServeIndex", "/dashboard/", 200, "text/html", ""},
+		{"ShouldServeScript", "/dashboard/dashboard.js", 200, "text/javascript", ""},
+		{"ShouldServeStyles", "/dashboard/dashboard.css", 200, "text/css", ""},
+		{"ShouldRedirectToIndex", "/dashboard", 300, "", "/dashboard/"},
+		{"ShouldRejectUnknownFile", "/dashboard/unknown.js", 404, "", ""},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			server := NewServer(0, "", "", NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t)))
+			server.Handle("GET "+dashboardPath, NewDashboardHandler())
+
+			// WHEN
+			response := httptest.NewRecorder()
+			server.mux.ServeHTTP(response, httptest.NewRequest("GET", tc.target, nil))
+
+			// THEN
+			if response.Code != tc.expectedCode && (tc.expectedCode != 300 || response.Code/100 != 3) {
+				t.Fatalf("Response code %d received, expected %d.", response.Code, tc.expectedCode)
+			}
+			if response.Header().Get("Location") != tc.expectedLocation {
+				t.Errorf("Location %s received, expected %s.", response.Header().Get("Location"), tc.expectedLocation)
+			}
+			if !strings.HasPrefix(response.Header().Get("Content-Type"), tc.expectedContentType) {
+				t.Errorf("Content type %s received, expected %s.", response.Header().Get("Content-Type"), tc.expectedContentType)
+			}
+			if tc.expectedCode == 200 && !strings.Contains(response.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+				t.Errorf("Content security policy %s received, expected only the own resources.", response.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "time"
+
+// the states of the dead letters
+const (
+	deadLetterStateFailed  = "failed"  // the message was rejected by the Pushover API
+	deadLetterStateExpired = "expired" // the message was not delivered before its expiration
+)
+
+// DeadLetter represents a queued message that permanently failed to be delivered or expired. The queued message keeps the results of all the attempts.
+type DeadLetter struct {
+	QueuedMessage
+	State      string    `json:"state"`       // deadLetterStateFailed or deadLetterStateExpired
+	FailedAt   time.Time `json:"failed_at"`   // time of the last attempt or of the expiration
+	FinalError string    `json:"final_error"` // result of the last attempt or the expiration reason
+}
+
+// DeadLetterRepository represents an interface of the persistent store of the dead letters
+type DeadLetterRepository interface {
+
+	// Store adds the dead letter to the store or replaces the dead letter of the same identifier
+	Store(deadLetter *DeadLetter) error
+
+	// Remove removes the dead letter, removing of a dead letter not present in the store is not an error
+	Remove(id string) error
+
+	// Get returns the dead letter or nil, if not present in the store
+	Get(id string) (*DeadLetter, error)
+
+	// List returns all the dead letters ordered by the failure time
+	List() ([]*DeadLetter, error)
+}
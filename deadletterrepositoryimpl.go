@@ -0,0 +1,51 @@
+package main
+
+import "sort"
+
+// DeadLetterRepositoryImpl implements the DeadLetterRepository interface, every dead letter is stored in a separate file in the directory
+type DeadLetterRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewDeadLetterRepositoryImpl creates a new dead letter repository in the given directory
+func NewDeadLetterRepositoryImpl(dir string) (*DeadLetterRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	dr := new(DeadLetterRepositoryImpl)
+	dr.store = store
+	return dr, nil
+}
+
+// Store adds the dead letter to the store or replaces the dead letter of the same identifier
+func (dr *DeadLetterRepositoryImpl) Store(deadLetter *DeadLetter) error {
+	return dr.store.save(deadLetter.ID, deadLetter)
+}
+
+// Remove removes the dead letter, removing of a dead letter not present in the store is not an error
+func (dr *DeadLetterRepositoryImpl) Remove(id string) error {
+	return dr.store.remove(id)
+}
+
+// Get returns the dead letter or nil, if not present in the store
+func (dr *DeadLetterRepositoryImpl) Get(id string) (*DeadLetter, error) {
+	deadLetter := new(DeadLetter)
+	exists, err := dr.store.load(id, deadLetter)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return deadLetter, nil
+}
+
+// List returns all the dead letters ordered by the failure time
+func (dr *DeadLetterRepositoryImpl) List() ([]*DeadLetter, error) {
+	deadLetters, err := loadAllJSON[DeadLetter](dr.store)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt.Before(deadLetters[j].FailedAt)
+	})
+	return deadLetters, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// creates a new dead letter repository in a temporary directory
+func newTestDeadLetterRepository(t *testing.T) *DeadLetterRepositoryImpl {
+	deadLetterRepository, err := NewDeadLetterRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Dead letter repository creation failed with error %s.", err)
+	}
+	return deadLetterRepository
+}
+
+func TestDeadLetterRepositoryShouldKeepDeadLettersWithHistory(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	deadLetterRepository, err := NewDeadLetterRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Dead letter repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	history := []AttemptResult{{At: now.Add(-time.Hour), StatusCode: 0, Error: "offline"}, {At: now, StatusCode: 400, Error: "user key is invalid"}}
+	deadLetterRepository.Store(&DeadLetter{QueuedMessage: QueuedMessage{ID: "b", Attempts: 2, History: history}, FailedAt: now, FinalError: "user key is invalid"})
+	deadLetterRepository.Store(&DeadLetter{QueuedMessage: QueuedMessage{ID: "a"}, FailedAt: now.Add(-time.Minute)})
+	deadLetterRepository.Store(&DeadLetter{QueuedMessage: QueuedMessage{ID: "c"}, FailedAt: now})
+	deadLetterRepository.Remove("c")
+
+	// WHEN
+	reopenedRepository, err := NewDeadLetterRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Dead letter repository reopening failed with error %s.", err)
+	}
+	deadLetters, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing failed with error %s.", err)
+	}
+	if len(deadLetters) != 2 || deadLetters[0].ID != "a" || deadLetters[1].ID != "b" {
+		t.Fatalf("Listed %d dead letters, expected a and b in the failure order.", len(deadLetters))
+	}
+	if len(deadLetters[1].History) != 2 || deadLetters[1].History[1].StatusCode != 400 || deadLetters[1].FinalError != "user key is invalid" {
+		t.Errorf("Dead letter %v does not keep the attempt history and final error.", deadLetters[1])
+	}
+	removed, err := reopenedRepository.Get("c")
+	if removed != nil || err != nil {
+		t.Errorf("Get of the removed dead letter returned %v and error %v, expected nil.", removed, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// duplicatesWindow represents the messages of the same content received since the first one
+type duplicatesWindow struct {
+	openedAt   time.Time
+	message    PushNotification // the first message of the window (with the aliases)
+	suppressed int              // number of the suppressed duplicates
+}
+
+// Deduplicator suppresses the repeated messages of the same content (token, user, title and message) received within the window
+// since the first one, e.g. from a flapping monitoring system. Optionally a single summary message is sent when the window closes.
+type Deduplicator struct {
+	window       time.Duration
+	onSummary    func(summary PushNotification) // called with the summary message when a window with duplicates closes, nil if not summarized
+	windows      map[string]*duplicatesWindow
+	windowsMutex sync.Mutex
+}
+
+// NewDeduplicator creates a new deduplicator. If onSummary is not nil, it is called with the summary message for every closed window
+// with the suppressed duplicates.
+func NewDeduplicator(window time.Duration, onSummary func(summary PushNotification)) *Deduplicator {
+	d := new(Deduplicator)
+	d.window = window
+	d.onSummary = onSummary
+	d.windows = make(map[string]*duplicatesWindow)
+	return d
+}
+
+// IsDuplicate returns true if the message of the same content was received within the window, the duplicate is counted.
+// Otherwise the message opens a new window. The resolved message identifies the content, the original message (with the aliases)
+// is used for the summary.
+func (d *Deduplicator) IsDuplicate(resolvedMessage PushNotification, message PushNotification, now time.Time) bool {
+
+	// lock the mutex
+	d.windowsMutex.Lock()
+	defer d.windowsMutex.Unlock()
+
+	// forget the closed windows, unless they are summarized by their timers
+	key := getContentKey(resolvedMessage)
+	if d.onSummary == nil {
+		d.removeClosed(now)
+	}
+
+	// count the duplicate of the open window
+	window, exists := d.windows[key]
+	if exists && now.Sub(window.openedAt) < d.window {
+		window.suppressed++
+		return true
+	}
+
+	// open a new window
+	window = &duplicatesWindow{openedAt: now, message: message}
+	d.windows[key] = window
+	if d.onSummary != nil {
+		time.AfterFunc(d.window, func() { d.close(key, window) })
+	}
+	return false
+}
+
+// closes the window and sends its summary if there were any duplicates
+func (d *Deduplicator) close(key string, window *duplicatesWindow) {
+
+	// lock the mutex, the window might have been replaced already
+	d.windowsMutex.Lock()
+	if d.windows[key] == window {
+		delete(d.windows, key)
+	}
+	suppressed := window.suppressed
+	d.windowsMutex.Unlock()
+
+	if suppressed > 0 {
+		d.onSummary(getDuplicatesSummary(window.message, suppressed))
+	}
+}
+
+// removes the windows opened before the window duration, the mutex has to be locked
+func (d *Deduplicator) removeClosed(now time.Time) {
+	for key, window := range d.windows {
+		if now.Sub(window.openedAt) >= d.window {
+			delete(d.windows, key)
+		}
+	}
+}
+
+// returns the hash of the token, user, title and message of the notification
+func getContentKey(message PushNotification) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{message.Token, message.User, message.Title, message.Message}, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// returns the summary of the suppressed duplicates of the message, the summary is sent to the same user with the same title and priority.
+// The summary is truncated to the Pushover limit.
+func getDuplicatesSummary(message PushNotification, suppressed int) PushNotification {
+	summary := message
+	summary.Message = truncateMessage(fmt.Sprintf("Message repeated %d times: %s", suppressed, message.Message), pushoverMaxMessageLength)
+	return summary
+}
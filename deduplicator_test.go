@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorShouldSuppressDuplicatesWithinWindow(t *testing.T) {
+
+	var testcases = []struct {
+		id                string
+		second            PushNotification
+		secondAfter       time.Duration
+		expectedDuplicate bool
+	}{
+		{"ShouldSuppressSameContent", PushNotification{Token: "T", User: "U", Title: "Disk", Message: "full"}, time.Second, true},
+		{"ShouldNotSuppressAfterWindow", PushNotification{Token: "T", User: "U", Title: "Disk", Message: "full"}, time.Minute, false},
+		{"ShouldNotSuppressOtherMessage", PushNotification{Token: "T", User: "U", Title: "Disk", Message: "ok"}, time.Second, false},
+		{"ShouldNotSuppressOtherTitle", PushNotification{Token: "T", User: "U", Title: "CPU", Message: "full"}, time.Second, false},
+		{"ShouldNotSuppressOtherUser", PushNotification{Token: "T", User: "V", Title: "Disk", Message: "full"}, time.Second, false},
+		{"ShouldNotSuppressOtherToken", PushNotification{Token: "S", User: "U", Title: "Disk", Message: "full"}, time.Second, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			deduplicator := NewDeduplicator(time.Minute, nil)
+			first := PushNotification{Token: "T", User: "U", Title: "Disk", Message: "full"}
+			now := time.Now()
+			if deduplicator.IsDuplicate(first, first, now) {
+				t.Fatal("The first message was reported as a duplicate.")
+			}
+
+			// WHEN
+			duplicate := deduplicator.IsDuplicate(tc.second, tc.second, now.Add(tc.secondAfter))
+
+			// THEN
+			if duplicate != tc.expectedDuplicate {
+				t.Errorf("The message was reported as a duplicate %t, expected %t.", duplicate, tc.expectedDuplicate)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorShouldSummarizeClosedWindow(t *testing.T) {
+
+	// GIVEN
+	var summaries []PushNotification
+	var summariesMutex sync.Mutex
+	deduplicator := NewDeduplicator(50*time.Millisecond, func(summary PushNotification) {
+		summariesMutex.Lock()
+		defer summariesMutex.Unlock()
+		summaries = append(summaries, summary)
+	})
+	flapping := PushNotification{Token: "T", User: "U", Title: "Disk", Message: "full", Priority: priorityHigh}
+	single := PushNotification{Token: "T", User: "U", Message: "single"}
+
+	// WHEN
+	now := time.Now()
+	deduplicator.IsDuplicate(single, single, now)
+	for i := 0; i < 4; i++ {
+		deduplicator.IsDuplicate(flapping, flapping, now)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// THEN
+	summariesMutex.Lock()
+	defer summariesMutex.Unlock()
+	if len(summaries) != 1 {
+		t.Fatalf("%d summaries sent, expected 1.", len(summaries))
+	}
+	expected := PushNotification{Token: "T", User: "U", Title: "Disk", Message: "Message repeated 3 times: full", Priority: priorityHigh}
+	if summaries[0] != expected {
+		t.Errorf("Summary %v sent, expected %v.", summaries[0], expected)
+	}
+}
+
+func TestDeduplicatorShouldTruncateSummary(t *testing.T) {
+
+	// GIVEN
+	message := PushNotification{Token: "T", User: "U", Message: strings.Repeat("x", pushoverMaxMessageLength)}
+
+	// WHEN
+	summary := getDuplicatesSummary(message, 2)
+
+	// THEN
+	characters := []rune(summary.Message)
+	if len(characters) != pushoverMaxMessageLength || !strings.HasPrefix(summary.Message, "Message repeated 2 times: x") || !strings.HasSuffix(summary.Message, "…") {
+		t.Errorf("Summary of %d characters \"%s\" returned, expected the truncated summary of %d characters.", len(characters), summary.Message, pushoverMaxMessageLength)
+	}
+}
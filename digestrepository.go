@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// DigestItem represents a message accumulated in the digest
+type DigestItem struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Title      string    `json:"title,omitempty"`
+	Message    string    `json:"message"`
+	Priority   int       `json:"priority"`
+}
+
+// Digest represents the low priority messages of a user accumulated to be sent as one combined notification
+type Digest struct {
+	ID       string       `json:"id"`        // hash of the resolved token and user
+	Token    string       `json:"token"`     // token (or alias) of the first message
+	User     string       `json:"user"`      // user (or alias) of the first message
+	OpenedAt time.Time    `json:"opened_at"` // time of the first message
+	SendAt   time.Time    `json:"send_at"`   // time of sending the combined notification
+	Items    []DigestItem `json:"items"`
+}
+
+// DigestRepository represents an interface of the persistent store of the pending digests
+type DigestRepository interface {
+
+	// Store adds the digest to the store or replaces the digest of the same identifier
+	Store(digest *Digest) error
+
+	// Remove removes the digest, removing of a digest not present in the store is not an error
+	Remove(id string) error
+
+	// Get returns the digest or nil, if not present in the store
+	Get(id string) (*Digest, error)
+
+	// List returns all the digests ordered by the sending time
+	List() ([]*Digest, error)
+}
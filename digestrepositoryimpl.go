@@ -0,0 +1,51 @@
+package main
+
+import "sort"
+
+// DigestRepositoryImpl implements the DigestRepository interface, every digest is stored in a separate file in the directory
+type DigestRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewDigestRepositoryImpl creates a new digest repository in the given directory
+func NewDigestRepositoryImpl(dir string) (*DigestRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	dr := new(DigestRepositoryImpl)
+	dr.store = store
+	return dr, nil
+}
+
+// Store adds the digest to the store or replaces the digest of the same identifier
+func (dr *DigestRepositoryImpl) Store(digest *Digest) error {
+	return dr.store.save(digest.ID, digest)
+}
+
+// Remove removes the digest, removing of a digest not present in the store is not an error
+func (dr *DigestRepositoryImpl) Remove(id string) error {
+	return dr.store.remove(id)
+}
+
+// Get returns the digest or nil, if not present in the store
+func (dr *DigestRepositoryImpl) Get(id string) (*Digest, error) {
+	digest := new(Digest)
+	exists, err := dr.store.load(id, digest)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return digest, nil
+}
+
+// List returns all the digests ordered by the sending time
+func (dr *DigestRepositoryImpl) List() ([]*Digest, error) {
+	digests, err := loadAllJSON[Digest](dr.store)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(digests, func(i, j int) bool {
+		return digests[i].SendAt.Before(digests[j].SendAt)
+	})
+	return digests, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// creates a new digest repository in a temporary directory
+func newTestDigestRepository(t *testing.T) *DigestRepositoryImpl {
+	digestRepository, err := NewDigestRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Digest repository creation failed with error %s.", err)
+	}
+	return digestRepository
+}
+
+func TestDigestRepositoryShouldKeepDigestsAfterReopening(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	digestRepository, err := NewDigestRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Digest repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	items := []DigestItem{{ReceivedAt: now, Title: "backup", Message: "finished", Priority: priorityLow}}
+	digestRepository.Store(&Digest{ID: "b", Token: "backup", User: "martin", SendAt: now, Items: items})
+	digestRepository.Store(&Digest{ID: "a", SendAt: now.Add(-time.Minute)})
+	digestRepository.Store(&Digest{ID: "c", SendAt: now})
+	digestRepository.Remove("c")
+
+	// WHEN
+	reopenedRepository, err := NewDigestRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Digest repository reopening failed with error %s.", err)
+	}
+	digests, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing of the digests failed with error %s.", err)
+	}
+	if len(digests) != 2 || digests[0].ID != "a" || digests[1].ID != "b" {
+		t.Fatalf("Digests %v listed, expected a and b.", digests)
+	}
+	if len(digests[1].Items) != 1 || digests[1].Items[0].Message != "finished" || !digests[1].Items[0].ReceivedAt.Equal(now) || digests[1].User != "martin" {
+		t.Errorf("Digest %v reloaded, expected the items %v.", digests[1], items)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// EscalationPolicy represents the chain of the users notified one after another until the emergency message is acknowledged
+type EscalationPolicy struct {
+	name       string
+	ackTimeout time.Duration // time for the acknowledgement before the next user is notified
+	users      []string      // users (keys or aliases) notified after the user of the message, in the order of the chain
+}
+
+// NewEscalationPolicy creates a new escalation policy notifying the users (keys or aliases) one after another, whenever the message
+// is not acknowledged within the ackTimeout
+func NewEscalationPolicy(name string, ackTimeout time.Duration, users []string) (*EscalationPolicy, error) {
+	if ackTimeout <= 0 {
+		return nil, fmt.Errorf("the escalation policy %s has no ack_timeout", name)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("the escalation policy %s has no users", name)
+	}
+	for _, user := range users {
+		if user == "" {
+			return nil, fmt.Errorf("the escalation policy %s has an empty user", name)
+		}
+	}
+	ep := new(EscalationPolicy)
+	ep.name = name
+	ep.ackTimeout = ackTimeout
+	ep.users = users
+	return ep, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import "time"
+
+// the states of the escalations
+const (
+	escalationStateActive       = "active"       // waiting for the acknowledgement of the notified users
+	escalationStateAcknowledged = "acknowledged" // acknowledged by one of the notified users
+	escalationStateExhausted    = "exhausted"    // not acknowledged by any user of the chain in time
+	escalationStateCancelled    = "cancelled"    // cancelled by the administrator
+)
+
+// EscalationStep represents the emergency message sent to one user of the escalation chain
+type EscalationStep struct {
+	User      string    `json:"user"`              // user (or alias) notified by the step
+	RequestID string    `json:"request_id"`        // request of the step message
+	Receipt   string    `json:"receipt,omitempty"` // receipt of the delivered message, empty until the message is delivered
+	SentAt    time.Time `json:"sent_at"`
+	Expired   bool      `json:"expired,omitempty"` // the notifications of the step stopped
+	Error     string    `json:"error,omitempty"`   // failure of the step delivery, the next user is notified
+}
+
+// Escalation represents the emergency message escalated to the next users of the policy until it is acknowledged. The escalation
+// without the policy only tracks the acknowledgement of the message, e.g. for the callback.
+type Escalation struct {
+	ID                    string           `json:"id"`     // request of the original message
+	Policy                string           `json:"policy"` // name of the escalation policy
+	TokenAlias            string           `json:"token_alias,omitempty"`
+	Notification          PushNotification `json:"notification"` // the original message (with aliases), the steps send it to the next users
+	State                 string           `json:"state"`
+	Steps                 []EscalationStep `json:"steps"`
+	StartedAt             time.Time        `json:"started_at"`
+	EscalateAt            time.Time        `json:"escalate_at"` // the next user is notified if the message is not acknowledged until this time
+	AcknowledgedAt        time.Time        `json:"acknowledged_at,omitzero"`
+	AcknowledgedBy        string           `json:"acknowledged_by,omitempty"`      // user key acknowledging the message
+	AcknowledgedReceipt   string           `json:"acknowledged_receipt,omitempty"` // receipt of the acknowledged step
+	UpdatedAt             time.Time        `json:"updated_at"`                     // time of the last change of the state
+	Callback              string           `json:"callback,omitempty"`             // internal URL receiving the acknowledgement event, not forwarded if empty
+	CallbackAttempts      int              `json:"callback_attempts,omitempty"`
+	CallbackNextAttemptAt time.Time        `json:"callback_next_attempt_at,omitzero"`
+	CallbackDeliveredAt   time.Time        `json:"callback_delivered_at,omitzero"`
+	CallbackError         string           `json:"callback_error,omitempty"` // failure of the last callback attempt
+}
+
+// isCallbackPending returns true if the acknowledgement should be forwarded to the callback URL and the attempts are not exhausted
+func (e *Escalation) isCallbackPending() bool {
+	return e.State == escalationStateAcknowledged && e.Callback != "" && e.CallbackDeliveredAt.IsZero() && e.CallbackAttempts < maxCallbackAttempts
+}
+
+// EscalationRepository represents an interface of the persistent store of the escalations
+type EscalationRepository interface {
+
+	// Store adds the escalation to the store or replaces the escalation of the same identifier
+	Store(escalation *Escalation) error
+
+	// Remove removes the escalation, removing of an escalation not present in the store is not an error
+	Remove(id string) error
+
+	// Get returns the escalation or nil, if not present in the store
+	Get(id string) (*Escalation, error)
+
+	// List returns all the escalations ordered by the start time
+	List() ([]*Escalation, error)
+}
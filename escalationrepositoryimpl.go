@@ -0,0 +1,51 @@
+package main
+
+import "sort"
+
+// EscalationRepositoryImpl implements the EscalationRepository interface, every escalation is stored in a separate file in the directory
+type EscalationRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewEscalationRepositoryImpl creates a new escalation repository in the given directory
+func NewEscalationRepositoryImpl(dir string) (*EscalationRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	er := new(EscalationRepositoryImpl)
+	er.store = store
+	return er, nil
+}
+
+// Store adds the escalation to the store or replaces the escalation of the same identifier
+func (er *EscalationRepositoryImpl) Store(escalation *Escalation) error {
+	return er.store.save(escalation.ID, escalation)
+}
+
+// Remove removes the escalation, removing of an escalation not present in the store is not an error
+func (er *EscalationRepositoryImpl) Remove(id string) error {
+	return er.store.remove(id)
+}
+
+// Get returns the escalation or nil, if not present in the store
+func (er *EscalationRepositoryImpl) Get(id string) (*Escalation, error) {
+	escalation := new(Escalation)
+	exists, err := er.store.load(id, escalation)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return escalation, nil
+}
+
+// List returns all the escalations ordered by the start time
+func (er *EscalationRepositoryImpl) List() ([]*Escalation, error) {
+	escalations, err := loadAllJSON[Escalation](er.store)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(escalations, func(i, j int) bool {
+		return escalations[i].StartedAt.Before(escalations[j].StartedAt)
+	})
+	return escalations, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// creates a new escalation repository in a temporary directory
+func newTestEscalationRepository(t *testing.T) *EscalationRepositoryImpl {
+	escalationRepository, err := NewEscalationRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Escalation repository creation failed with error %s.", err)
+	}
+	return escalationRepository
+}
+
+func TestEscalationRepositoryShouldKeepEscalationsAfterReopening(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	escalationRepository, err := NewEscalationRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Escalation repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	steps := []EscalationStep{{User: "alice", RequestID: "b", Receipt: "r1", SentAt: now}}
+	escalationRepository.Store(&Escalation{ID: "b", Policy: "db", State: escalationStateActive, Steps: steps, StartedAt: now})
+	escalationRepository.Store(&Escalation{ID: "a", StartedAt: now.Add(-time.Minute)})
+	escalationRepository.Store(&Escalation{ID: "c", StartedAt: now})
+	escalationRepository.Remove("c")
+
+	// WHEN
+	reopenedRepository, err := NewEscalationRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Escalation repository reopening failed with error %s.", err)
+	}
+	escalations, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing of the escalations failed with error %s.", err)
+	}
+	if len(escalations) != 2 || escalations[0].ID != "a" || escalations[1].ID != "b" {
+		t.Fatalf("Escalations %v listed, expected a and b.", escalations)
+	}
+	if len(escalations[1].Steps) != 1 || escalations[1].Steps[0].Receipt != "r1" || !escalations[1].Steps[0].SentAt.Equal(now) || escalations[1].State != escalationStateActive {
+		t.Errorf("Escalation %v reloaded, expected the steps %v.", escalations[1], steps)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// EventBus distributes the message lifecycle events published by the Processor to the subscribers, e.g. to the event streams
+// of the admin API. A slow subscriber loses the events instead of blocking the processing.
+type EventBus struct {
+	mutex       sync.Mutex
+	subscribers map[chan *MessageEvent]struct{}
+}
+
+// NewEventBus creates a new event bus without subscribers
+func NewEventBus() *EventBus {
+	eb := new(EventBus)
+	eb.subscribers = make(map[chan *MessageEvent]struct{})
+	return eb
+}
+
+// HandleEvent publishes the event to all the subscribers (see MessageEventListener), the subscribers must not modify the event
+func (eb *EventBus) HandleEvent(event *MessageEvent) {
+
+	// lock the mutex
+	eb.mutex.Lock()
+	defer eb.mutex.Unlock()
+
+	for subscriber := range eb.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// the subscriber does not keep up
+			streamEventsDropped.Inc()
+		}
+	}
+}
+
+// Subscribe returns the channel receiving the published events buffered up to the bufferSize and the function cancelling
+// the subscription
+func (eb *EventBus) Subscribe(bufferSize int) (<-chan *MessageEvent, func()) {
+
+	// lock the mutex
+	eb.mutex.Lock()
+	defer eb.mutex.Unlock()
+
+	subscriber := make(chan *MessageEvent, bufferSize)
+	eb.subscribers[subscriber] = struct{}{}
+	return subscriber, func() {
+		eb.mutex.Lock()
+		defer eb.mutex.Unlock()
+		delete(eb.subscribers, subscriber)
+	}
+}
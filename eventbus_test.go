@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+// TestEventBusShouldPublishToSubscribers tests whether the event bus publishes the events to the subscribers until they unsubscribe
+func TestEventBusShouldPublishToSubscribers(t *testing.T) {
+
+	// GIVEN
+	eventBus := NewEventBus()
+	first, unsubscribeFirst := eventBus.Subscribe(10)
+	second, unsubscribeSecond := eventBus.Subscribe(10)
+	defer unsubscribeSecond()
+
+	// WHEN
+	eventBus.HandleEvent(&MessageEvent{ID: "1", Type: messageEventAccepted})
+	unsubscribeFirst()
+	eventBus.HandleEvent(&MessageEvent{ID: "2", Type: messageEventDelivered})
+
+	// THEN
+	if len(first) != 1 || (<-first).ID != "1" {
+		t.Errorf("First subscriber received unexpected events, expected only the event 1.")
+	}
+	if len(second) != 2 || (<-second).ID != "1" || (<-second).ID != "2" {
+		t.Errorf("Second subscriber received unexpected events, expected the events 1 and 2.")
+	}
+}
+
+// TestEventBusShouldDropEventsOfSlowSubscribers tests whether the event bus drops the events instead of blocking on the full subscriber
+func TestEventBusShouldDropEventsOfSlowSubscribers(t *testing.T) {
+
+	// GIVEN
+	eventBus := NewEventBus()
+	events, unsubscribe := eventBus.Subscribe(1)
+	defer unsubscribe()
+
+	// WHEN
+	eventBus.HandleEvent(&MessageEvent{ID: "1"})
+	eventBus.HandleEvent(&MessageEvent{ID: "2"})
+
+	// THEN
+	if len(events) != 1 || (<-events).ID != "1" {
+		t.Errorf("Subscriber received unexpected events, expected only the event 1.")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// jsonFileStore persists the records as JSON files (one file per record) in a directory. The files are replaced atomically,
+// so that a crash never leaves a partially written record.
+type jsonFileStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// creates the store in the given directory, the directory is created if it does not exist
+func newJSONFileStore(dir string) (*jsonFileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("creation of the store directory %s failed with error %s", dir, err.Error())
+	}
+	fs := new(jsonFileStore)
+	fs.dir = dir
+	return fs, nil
+}
+
+// checks the record identifier, so that it cannot refer to a file outside the store
+func checkStoreID(id string) error {
+	if id == "" || strings.ContainsAny(id, "/\\.") {
+		return fmt.Errorf("invalid record identifier \"%s\"", id)
+	}
+	return nil
+}
+
+// returns the path of the file of the record
+func (fs *jsonFileStore) filePath(id string) string {
+	return path.Join(fs.dir, id+".json")
+}
+
+// stores the record, replaces the previous value if present
+func (fs *jsonFileStore) save(id string, value interface{}) error {
+	err := checkStoreID(id)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding of the record %s failed with error %s", id, err.Error())
+	}
+
+	// lock the mutex
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	// write into a temporary file and replace the record by renaming it
+	tempFilePath := path.Join(fs.dir, id+".tmp")
+	err = os.WriteFile(tempFilePath, content, 0600)
+	if err != nil {
+		return fmt.Errorf("writing of the record %s failed with error %s", id, err.Error())
+	}
+	err = os.Rename(tempFilePath, fs.filePath(id))
+	if err != nil {
+		os.Remove(tempFilePath)
+		return fmt.Errorf("replacing of the record %s failed with error %s", id, err.Error())
+	}
+	return nil
+}
+
+// loads the record into the value, returns false if the record does not exist. The record that cannot be decoded is moved aside
+// as <id>.corrupt, so that it does not fail the later listings.
+func (fs *jsonFileStore) load(id string, value interface{}) (bool, error) {
+	err := checkStoreID(id)
+	if err != nil {
+		return false, err
+	}
+
+	// lock the mutex
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	content, err := os.ReadFile(fs.filePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading of the record %s failed with error %s", id, err.Error())
+	}
+	err = json.Unmarshal(content, value)
+	if err != nil {
+		quarantineErr := os.Rename(fs.filePath(id), path.Join(fs.dir, id+".corrupt"))
+		if quarantineErr != nil {
+			return false, fmt.Errorf("decoding of the record %s failed with error %s, moving it aside failed with error %s", id, err.Error(), quarantineErr.Error())
+		}
+		return false, fmt.Errorf("decoding of the record %s failed with error %s, the record was moved aside", id, err.Error())
+	}
+	return true, nil
+}
+
+// removes the record, removing of a non existing record is not an error
+func (fs *jsonFileStore) remove(id string) error {
+	err := checkStoreID(id)
+	if err != nil {
+		return err
+	}
+
+	// lock the mutex
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err = os.Remove(fs.filePath(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing of the record %s failed with error %s", id, err.Error())
+	}
+	return nil
+}
+
+// checks that a file can be written into the store directory
+func (fs *jsonFileStore) checkWritable() error {
+
+	// lock the mutex
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	probeFilePath := path.Join(fs.dir, ".probe.tmp")
+	err := os.WriteFile(probeFilePath, []byte("probe"), 0600)
+	if err != nil {
+		return fmt.Errorf("the store directory %s is not writable, error %s", fs.dir, err.Error())
+	}
+	return os.Remove(probeFilePath)
+}
+
+// returns the sorted identifiers of all the records
+func (fs *jsonFileStore) ids() ([]string, error) {
+
+	// lock the mutex
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing of the store directory %s failed with error %s", fs.dir, err.Error())
+	}
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// loadAllJSON loads all the records of the store, the records removed while loading and the records that cannot be loaded are skipped
+func loadAllJSON[T any](fs *jsonFileStore) ([]*T, error) {
+	ids, err := fs.ids()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*T, 0, len(ids))
+	for _, id := range ids {
+		record := new(T)
+		exists, err := fs.load(id, record)
+		if err != nil {
+			slog.Error("Loading of the record failed, the record is skipped.", "store", fs.dir, logKeyError, err)
+			continue
+		}
+		if exists {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+// groupUserPrefix is the prefix of the message user addressing the local group, e.g. group:ops
+const groupUserPrefix = "group:"
+
+// GroupMember represents a recipient of the group messages
+type GroupMember struct {
+	User   string `json:"user"`             // user key or alias
+	Device string `json:"device,omitempty"` // device(s) of the user, all the devices if empty
+}
+
+// Group represents the named list of the recipients, the messages addressed to the group are sent to every member separately
+type Group struct {
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+// GroupRepository represents an interface of the persistent store of the local recipient groups
+type GroupRepository interface {
+
+	// Store adds the group to the store or replaces the group of the same name
+	Store(group *Group) error
+
+	// Remove removes the group, removing of a group not present in the store is not an error
+	Remove(name string) error
+
+	// Get returns the group or nil, if not present in the store
+	Get(name string) (*Group, error)
+
+	// List returns all the groups ordered by the name
+	List() ([]*Group, error)
+}
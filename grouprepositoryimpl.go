@@ -0,0 +1,42 @@
+package main
+
+// GroupRepositoryImpl implements the GroupRepository interface, every group is stored in a separate file in the directory
+type GroupRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewGroupRepositoryImpl creates a new group repository in the given directory
+func NewGroupRepositoryImpl(dir string) (*GroupRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	gr := new(GroupRepositoryImpl)
+	gr.store = store
+	return gr, nil
+}
+
+// Store adds the group to the store or replaces the group of the same name
+func (gr *GroupRepositoryImpl) Store(group *Group) error {
+	return gr.store.save(group.Name, group)
+}
+
+// Remove removes the group, removing of a group not present in the store is not an error
+func (gr *GroupRepositoryImpl) Remove(name string) error {
+	return gr.store.remove(name)
+}
+
+// Get returns the group or nil, if not present in the store
+func (gr *GroupRepositoryImpl) Get(name string) (*Group, error) {
+	group := new(Group)
+	exists, err := gr.store.load(name, group)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return group, nil
+}
+
+// List returns all the groups ordered by the name (the store lists the records sorted by their identifiers)
+func (gr *GroupRepositoryImpl) List() ([]*Group, error) {
+	return loadAllJSON[Group](gr.store)
+}
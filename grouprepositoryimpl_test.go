@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+// creates a new group repository in a temporary directory
+func newTestGroupRepository(t *testing.T) *GroupRepositoryImpl {
+	groupRepository, err := NewGroupRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Group repository creation failed with error %s.", err)
+	}
+	return groupRepository
+}
+
+func TestGroupRepositoryShouldKeepGroupsAfterReopening(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	groupRepository, err := NewGroupRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Group repository creation failed with error %s.", err)
+	}
+	groupRepository.Store(&Group{Name: "ops", Members: []GroupMember{{User: "alice", Device: "phone"}, {User: "bob"}}})
+	groupRepository.Store(&Group{Name: "dev", Members: []GroupMember{{User: "carol"}}})
+	groupRepository.Store(&Group{Name: "old", Members: []GroupMember{{User: "dave"}}})
+	groupRepository.Remove("old")
+
+	// WHEN
+	reopenedRepository, err := NewGroupRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Group repository reopening failed with error %s.", err)
+	}
+	groups, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing of the groups failed with error %s.", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "dev" || groups[1].Name != "ops" {
+		t.Fatalf("Groups %v listed, expected dev and ops.", groups)
+	}
+	if len(groups[1].Members) != 2 || groups[1].Members[0] != (GroupMember{User: "alice", Device: "phone"}) {
+		t.Errorf("Members %v reloaded, expected alice and bob.", groups[1].Members)
+	}
+}
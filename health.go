@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// default time after which the failing Pushover API is reported as offline
+const defaultUpstreamOfflineThreshold = time.Hour
+
+// the upstream states reported by the health endpoints
+const (
+	upstreamStatusUnknown  = "unknown"  // no delivery attempted yet
+	upstreamStatusOK       = "ok"       // the last attempt reached the Pushover API
+	upstreamStatusDegraded = "degraded" // the last attempt failed, but not for longer than the threshold
+	upstreamStatusOffline  = "offline"  // the Pushover API has not been reachable for longer than the threshold
+)
+
+// HealthReport represents the response body of the health endpoints
+type HealthReport struct {
+	Status   string            `json:"status"` // "ok" or "failed"
+	Checks   map[string]string `json:"checks"` // check name -> "ok" or the failure description
+	Upstream UpstreamReport    `json:"upstream"`
+}
+
+// UpstreamReport represents the reachability of the Pushover API in the health report
+type UpstreamReport struct {
+	Status         string     `json:"status"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt  *time.Time `json:"last_failure_at,omitempty"`
+	OfflineSeconds int64      `json:"offline_seconds,omitempty"`
+}
+
+// HealthHandler serves the health (/healthz) and readiness (/readyz) endpoints. The upstream reachability is only reported,
+// the broker stays healthy while the Pushover API is offline.
+type HealthHandler struct {
+	messageRepository        MessageRepository
+	processor                *Processor
+	server                   *Server
+	upstreamOfflineThreshold time.Duration
+	startedAt                time.Time
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(messageRepository MessageRepository, processor *Processor, server *Server, upstreamOfflineThreshold time.Duration) *HealthHandler {
+	h := new(HealthHandler)
+	h.messageRepository = messageRepository
+	h.processor = processor
+	h.server = server
+	h.upstreamOfflineThreshold = upstreamOfflineThreshold
+	h.startedAt = time.Now()
+	return h
+}
+
+// ServeHealth reports whether the process is alive and the queue store writable
+func (h *HealthHandler) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	checks["queue_store"] = getCheckResult(h.messageRepository.CheckWritable())
+	h.writeReport(w, checks)
+}
+
+// ServeReadiness reports whether the server listens and the processor loop is running
+func (h *HealthHandler) ServeReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	checks["listener"] = getStateCheckResult(h.server.IsListening(), "the server does not listen")
+	checks["processor"] = getStateCheckResult(h.processor.IsRunning(), "the processor loop is not running")
+	h.writeReport(w, checks)
+}
+
+// writes the report of the checks, the status code is 503 (Service Unavailable) if any of the checks failed
+func (h *HealthHandler) writeReport(w http.ResponseWriter, checks map[string]string) {
+	report := HealthReport{Status: "ok", Checks: checks, Upstream: h.getUpstreamReport(time.Now())}
+	responseCode := http.StatusOK
+	for _, result := range checks {
+		if result != "ok" {
+			report.Status = "failed"
+			responseCode = http.StatusServiceUnavailable
+		}
+	}
+	responseBody, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(responseCode)
+	w.Write(responseBody)
+}
+
+// returns the reachability of the Pushover API
+func (h *HealthHandler) getUpstreamReport(now time.Time) UpstreamReport {
+	upstreamStatus := h.processor.GetUpstreamStatus()
+	var report UpstreamReport
+	if !upstreamStatus.LastSuccessAt.IsZero() {
+		report.LastSuccessAt = &upstreamStatus.LastSuccessAt
+	}
+	if !upstreamStatus.LastFailureAt.IsZero() {
+		report.LastFailureAt = &upstreamStatus.LastFailureAt
+	}
+
+	switch {
+	case report.LastSuccessAt == nil && report.LastFailureAt == nil:
+		report.Status = upstreamStatusUnknown
+
+	case report.LastFailureAt == nil || upstreamStatus.LastSuccessAt.After(upstreamStatus.LastFailureAt):
+		report.Status = upstreamStatusOK
+
+	default:
+		// offline since the last success (or since the start if there was none)
+		offlineSince := upstreamStatus.LastSuccessAt
+		if offlineSince.IsZero() {
+			offlineSince = h.startedAt
+		}
+		offlineFor := now.Sub(offlineSince)
+		report.OfflineSeconds = int64(offlineFor.Seconds())
+		report.Status = upstreamStatusDegraded
+		if offlineFor >= h.upstreamOfflineThreshold {
+			report.Status = upstreamStatusOffline
+		}
+	}
+	return report
+}
+
+// returns the check result of the error
+func getCheckResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// returns the check result of the state
+func getStateCheckResult(state bool, failure string) string {
+	if !state {
+		return failure
+	}
+	return "ok"
+}
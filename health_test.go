@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// calls the health handler method and decodes the report
+func getHealthReport(t *testing.T, serve func(w *httptest.ResponseRecorder)) (int, HealthReport) {
+	recorder := httptest.NewRecorder()
+	serve(recorder)
+	var report HealthReport
+	err := json.Unmarshal(recorder.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatalf("Health report \"%s\" failed to decode with error %s.", recorder.Body.String(), err)
+	}
+	return recorder.Code, report
+}
+
+func TestHealthShouldFailOnNotWritableQueue(t *testing.T) {
+
+	// GIVEN
+	queueDir := path.Join(t.TempDir(), "queue")
+	messageRepository, err := NewMessageRepositoryImpl(queueDir)
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), messageRepository)
+	healthHandler := NewHealthHandler(messageRepository, processor, NewServer(8504, "", "", processor), time.Hour)
+
+	// WHEN
+	healthyCode, healthyReport := getHealthReport(t, func(w *httptest.ResponseRecorder) {
+		healthHandler.ServeHealth(w, httptest.NewRequest("GET", "/healthz", nil))
+	})
+	os.RemoveAll(queueDir)
+	failedCode, failedReport := getHealthReport(t, func(w *httptest.ResponseRecorder) {
+		healthHandler.ServeHealth(w, httptest.NewRequest("GET", "/healthz", nil))
+	})
+
+	// THEN
+	if healthyCode != 200 || healthyReport.Status != "ok" {
+		t.Errorf("Health with writable queue returned status code %d and status %s, expected 200 and ok.", healthyCode, healthyReport.Status)
+	}
+	if failedCode != 503 || failedReport.Status != "failed" || failedReport.Checks["queue_store"] == "ok" {
+		t.Errorf("Health with removed queue returned status code %d and report %v, expected 503 and failed queue_store check.", failedCode, failedReport)
+	}
+}
+
+func TestReadinessShouldRequireListenerAndProcessor(t *testing.T) {
+
+	// GIVEN
+	wd, _ := os.Getwd()
+	messageRepository := newTestMessageRepository(t)
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), messageRepository)
+	server := NewServer(8504, path.Join(wd, "private", "server.cert.pem"), path.Join(wd, "private", "server.key.pem"), processor)
+	healthHandler := NewHealthHandler(messageRepository, processor, server, time.Hour)
+
+	// WHEN
+	notReadyCode, notReadyReport := getHealthReport(t, func(w *httptest.ResponseRecorder) {
+		healthHandler.ServeReadiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	})
+	go processor.Run()
+	defer processor.Stop()
+	go server.Run()
+	defer server.Shutdown(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	readyCode, readyReport := getHealthReport(t, func(w *httptest.ResponseRecorder) {
+		healthHandler.ServeReadiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	})
+
+	// THEN
+	if notReadyCode != 503 || notReadyReport.Checks["listener"] == "ok" || notReadyReport.Checks["processor"] == "ok" {
+		t.Errorf("Readiness before start returned status code %d and report %v, expected 503 and failed checks.", notReadyCode, notReadyReport)
+	}
+	if readyCode != 200 || readyReport.Status != "ok" {
+		t.Errorf("Readiness after start returned status code %d and report %v, expected 200 and ok.", readyCode, readyReport)
+	}
+}
+
+func TestUpstreamReport(t *testing.T) {
+
+	now := time.Now()
+	var testcases = []struct {
+		id              string
+		lastSuccessAt   time.Time
+		lastFailureAt   time.Time
+		expectedStatus  string
+		expectedOffline int64
+	}{
+		{"ShouldReportUnknownWithoutAttempts", time.Time{}, time.Time{}, upstreamStatusUnknown, 0},
+		{"ShouldReportOKAfterSuccess", now.Add(-time.Minute), now.Add(-time.Hour), upstreamStatusOK, 0},
+		{"ShouldReportDegradedAfterRecentFailure", now.Add(-10 * time.Minute), now.Add(-time.Minute), upstreamStatusDegraded, 600},
+		{"ShouldReportOfflineAfterLongFailure", now.Add(-2 * time.Hour), now.Add(-time.Minute), upstreamStatusOffline, 7200},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+			processor.upstreamStatus = UpstreamStatus{LastSuccessAt: tc.lastSuccessAt, LastFailureAt: tc.lastFailureAt}
+			healthHandler := NewHealthHandler(processor.MessageRepository, processor, nil, time.Hour)
+
+			// WHEN
+			report := healthHandler.getUpstreamReport(now)
+
+			// THEN
+			if report.Status != tc.expectedStatus || report.OfflineSeconds != tc.expectedOffline {
+				t.Errorf("Upstream status %s offline for %d seconds, expected %s and %d.", report.Status, report.OfflineSeconds, tc.expectedStatus, tc.expectedOffline)
+			}
+		})
+	}
+}
+
+func TestProcessorShouldRecordUpstreamResults(t *testing.T) {
+
+	// GIVEN
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+
+	// WHEN
+	processor.recordUpstreamResult(nil, 400)
+	afterRejection := processor.GetUpstreamStatus()
+	processor.recordUpstreamResult(errors.New("offline"), 0)
+	afterFailure := processor.GetUpstreamStatus()
+
+	// THEN
+	if afterRejection.LastSuccessAt.IsZero() || !afterRejection.LastFailureAt.IsZero() {
+		t.Errorf("The rejection by the Pushover API was not recorded as reachable upstream.")
+	}
+	if afterFailure.LastFailureAt.IsZero() || afterFailure.LastSuccessAt != afterRejection.LastSuccessAt {
+		t.Errorf("The connection failure was not recorded as unreachable upstream.")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// default time for which the idempotency keys are remembered
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// ErrIdempotencyKeyInProgress is returned if the original request with the idempotency key is still being handled
+var ErrIdempotencyKeyInProgress = errors.New("the request with the same idempotency key is still being handled")
+
+// IdempotentResponse represents the response remembered for the idempotency key
+type IdempotentResponse struct {
+	RequestID        string    // identifier of the original request
+	ResponseCode     int       // HTTP response code of the original request
+	Limits           *Limits   // limits returned to the original request
+	JSONResponseBody string    // JSON response body of the original request
+	StoredAt         time.Time // time of the original response
+}
+
+// IdempotencyStore remembers the responses of the requests by the client supplied idempotency keys
+type IdempotencyStore interface {
+	// Begin reserves the key for the request. Returns the remembered response if the key was already used (nil if the key is new)
+	// or ErrIdempotencyKeyInProgress if the request with the same key is still being handled.
+	Begin(key string, requestID string, now time.Time) (*IdempotentResponse, error)
+	// Complete remembers the response of the request that reserved the key
+	Complete(key string, response IdempotentResponse)
+	// Release forgets the key reserved by a request that did not complete, so that it can be repeated
+	Release(key string)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyEntry is the remembered key, the response is nil while the original request is being handled
+type idempotencyEntry struct {
+	reservedAt time.Time
+	response   *IdempotentResponse
+}
+
+// IdempotencyStoreImpl implements the IdempotencyStore interface in memory, the keys are forgotten after the window
+type IdempotencyStoreImpl struct {
+	window       time.Duration
+	entries      map[string]*idempotencyEntry
+	entriesMutex sync.Mutex
+}
+
+// NewIdempotencyStoreImpl creates a new idempotency store remembering the keys for the given window
+func NewIdempotencyStoreImpl(window time.Duration) *IdempotencyStoreImpl {
+	s := new(IdempotencyStoreImpl)
+	s.window = window
+	s.entries = make(map[string]*idempotencyEntry)
+	return s
+}
+
+// Begin reserves the key for the request (see IdempotencyStore)
+func (s *IdempotencyStoreImpl) Begin(key string, requestID string, now time.Time) (*IdempotentResponse, error) {
+
+	// lock the mutex
+	s.entriesMutex.Lock()
+	defer s.entriesMutex.Unlock()
+
+	// forget the keys older than the window
+	s.removeExpired(now)
+
+	// if the key is known, return its response
+	entry, exists := s.entries[key]
+	if exists {
+		if entry.response == nil {
+			return nil, ErrIdempotencyKeyInProgress
+		}
+		return entry.response, nil
+	}
+
+	// reserve the new key
+	s.entries[key] = &idempotencyEntry{reservedAt: now}
+	return nil, nil
+}
+
+// Complete remembers the response of the key (see IdempotencyStore)
+func (s *IdempotencyStoreImpl) Complete(key string, response IdempotentResponse) {
+
+	// lock the mutex
+	s.entriesMutex.Lock()
+	defer s.entriesMutex.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &idempotencyEntry{reservedAt: response.StoredAt}
+		s.entries[key] = entry
+	}
+	entry.response = &response
+}
+
+// Release forgets the key (see IdempotencyStore)
+func (s *IdempotencyStoreImpl) Release(key string) {
+
+	// lock the mutex
+	s.entriesMutex.Lock()
+	defer s.entriesMutex.Unlock()
+
+	delete(s.entries, key)
+}
+
+// removes the keys reserved before the window, the mutex has to be locked
+func (s *IdempotencyStoreImpl) removeExpired(now time.Time) {
+	for key, entry := range s.entries {
+		if now.Sub(entry.reservedAt) >= s.window {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStoreShouldReturnRememberedResponse(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		completed            bool
+		released             bool
+		repeatedAfter        time.Duration
+		expectedResponseCode int // 0 if no response is expected
+		expectedErr          error
+	}{
+		{"ShouldReturnCompletedResponse", true, false, time.Minute, 202, nil},
+		{"ShouldRejectRequestInProgress", false, false, time.Minute, 0, ErrIdempotencyKeyInProgress},
+		{"ShouldForgetReleasedKey", false, true, time.Minute, 0, nil},
+		{"ShouldForgetKeyAfterWindow", true, false, time.Hour, 0, nil},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			store := NewIdempotencyStoreImpl(time.Hour)
+			now := time.Now()
+			response, err := store.Begin("token/key", "original", now)
+			if response != nil || err != nil {
+				t.Fatalf("The new key returned response %v and error %v, expected none.", response, err)
+			}
+			if tc.completed {
+				store.Complete("token/key", IdempotentResponse{RequestID: "original", ResponseCode: 202, StoredAt: now})
+			}
+			if tc.released {
+				store.Release("token/key")
+			}
+
+			// WHEN
+			response, err = store.Begin("token/key", "repeated", now.Add(tc.repeatedAfter))
+
+			// THEN
+			if err != tc.expectedErr {
+				t.Errorf("Error %v returned, expected %v.", err, tc.expectedErr)
+			}
+			if tc.expectedResponseCode == 0 && response != nil {
+				t.Errorf("Response %v returned, expected none.", response)
+			}
+			if tc.expectedResponseCode != 0 && (response == nil || response.ResponseCode != tc.expectedResponseCode || response.RequestID != "original") {
+				t.Errorf("Response %v returned, expected the original response %d.", response, tc.expectedResponseCode)
+			}
+		})
+	}
+}
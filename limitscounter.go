@@ -11,4 +11,7 @@ type LimitsCounter interface {
 
 	// GetLimits returns the current limits or nil, if not known yet
 	GetLimits(accountToken string) (*Limits, error)
+
+	// ListLimits returns the copies of the current limits of all the known accounts
+	ListLimits() (map[string]Limits, error)
 }
@@ -71,6 +71,21 @@ func (l *LimitsCounterImpl) GetLimits(accountToken string) (*Limits, error) {
 	return limits, nil
 }
 
+// ListLimits returns the copies of the current limits of all the known accounts
+func (l *LimitsCounterImpl) ListLimits() (map[string]Limits, error) {
+
+	// lock the mutex
+	l.limitsCacheMutex.Lock()
+	defer l.limitsCacheMutex.Unlock()
+
+	// copy the limits, so that they are not changed by the later decrements
+	allLimits := make(map[string]Limits, len(l.limitsCache))
+	for accountToken, limits := range l.limitsCache {
+		allLimits[accountToken] = *limits
+	}
+	return allLimits, nil
+}
+
 // NewLimitsCounterImpl creates a new limits counter instance
 func NewLimitsCounterImpl() *LimitsCounterImpl {
 	lc := new(LimitsCounterImpl)
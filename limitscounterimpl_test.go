@@ -76,3 +76,25 @@ func TestLimitsCounterShouldGiveDecrementedValuesOnCachedAccount(t *testing.T) {
 	}
 
 }
+
+func TestLimitsCounterShouldListCopiesOfCachedAccounts(t *testing.T) {
+
+	// GIVEN
+	limitsCounterImpl := NewLimitsCounterImpl()
+	limitsCounterImpl.SetLimits("accountA", &Limits{limit: 1000, remaining: 500, reset: 123456789})
+	limitsCounterImpl.SetLimits("accountB", &Limits{limit: 2000, remaining: 10, reset: 123456789})
+
+	// WHEN
+	allLimits, err := limitsCounterImpl.ListLimits()
+	limitsCounterImpl.DecrementLimits("accountA")
+
+	// THEN
+	if err != nil {
+		t.Errorf("limits listing failed with error %s, expected no error", err)
+		return
+	}
+	if len(allLimits) != 2 || allLimits["accountA"].remaining != 500 || allLimits["accountB"].limit != 2000 {
+		t.Errorf("Limits %v returned, expected the unchanged limits of both accounts.", allLimits)
+	}
+
+}
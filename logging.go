@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// the names of the common structured log attributes
+const (
+	logKeyRequestID       = "request_id"
+	logKeyParentRequestID = "parent_request_id"
+	logKeyClient          = "client"
+	logKeyTokenAlias      = "token_alias"
+	logKeyAttempt         = "attempt"
+	logKeyStatusCode      = "status_code"
+	logKeyError           = "error"
+	logKeyAdmin           = "admin"
+)
+
+// NewLogger creates the structured logger writing into w in the given format ("text" or "json") with the given minimal level
+// ("debug", "info", "warn" or "error")
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+
+	// parse the level
+	var logLevel slog.Level
+	err := logLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported log level \"%s\"", level)
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	// create the handler of the requested format
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported log format \"%s\", expected \"text\" or \"json\"", format)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewLoggerShouldRejectInvalidSettings(t *testing.T) {
+
+	var testcases = []struct {
+		id     string
+		format string
+		level  string
+	}{
+		{"ShouldRejectUnknownFormat", "xml", "info"},
+		{"ShouldRejectUnknownLevel", "text", "verbose"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// WHEN
+			_, err := NewLogger(&bytes.Buffer{}, tc.format, tc.level)
+
+			// THEN
+			if err == nil {
+				t.Errorf("Logger with format \"%s\" and level \"%s\" created, expected error.", tc.format, tc.level)
+			}
+		})
+	}
+}
+
+func TestJSONLoggerShouldWriteRequestFields(t *testing.T) {
+
+	// GIVEN
+	var output bytes.Buffer
+	logger, err := NewLogger(&output, "json", "info")
+	if err != nil {
+		t.Fatalf("Logger creation failed with error %s.", err)
+	}
+	ctx := WithClientSubject(WithRequestID(context.Background(), "<request id>"), "CN=backup-script")
+	defaultLogger := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(defaultLogger)
+
+	// WHEN
+	GetLogger(ctx).Debug("Not logged.")
+	GetLogger(ctx).Info("Logged.", logKeyStatusCode, 202)
+
+	// THEN
+	var record map[string]interface{}
+	err = json.Unmarshal(output.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Log output \"%s\" is not a single JSON record, error %s.", output.String(), err)
+	}
+	if record["msg"] != "Logged." || record[logKeyRequestID] != "<request id>" || record[logKeyClient] != "CN=backup-script" || record[logKeyStatusCode] != float64(202) {
+		t.Errorf("Log record %v does not contain the expected fields.", record)
+	}
+}
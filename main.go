@@ -1,21 +1,77 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is the time given to the active requests to finish when the broker is stopped by a signal
+const shutdownTimeout = 10 * time.Second
+
 //import (
 //	"github.com/martinjansa/pushoverbroker"
 //)
 
 func main() {
-	// get the certificate files path
-	certFilePath := path.Join(path.Dir(os.Args[0]), "private", "server.cert.pem")
-	keyFilePath := path.Join(path.Dir(os.Args[0]), "private", "server.key.pem")
+	// the configuration and certificate files are by default located relatively to the executable
+	baseDir := path.Dir(os.Args[0])
+	configFilePath := flag.String("config", path.Join(baseDir, "private", "broker.json"), "path to the JSON configuration file")
+	flag.Parse()
+
+	// load the configuration
+	config, err := LoadConfig(*configFilePath, baseDir)
+	if err != nil {
+		slog.Error("Loading of the configuration failed.", logKeyError, err)
+		os.Exit(1)
+	}
+
+	// initialize the logging
+	logger, err := NewLogger(os.Stderr, config.LogFormat, config.LogLevel)
+	if err != nil {
+		slog.Error("Initialization of the logging failed.", logKeyError, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// initialize the tracing
+	shutdownTracing, err := InitTracing(context.Background(), config.TracingExporter, config.TracingEndpoint)
+	if err != nil {
+		slog.Error("Initialization of the tracing failed.", logKeyError, err)
+		os.Exit(1)
+	}
 
 	// initialize the server
 	pushoverConnector := NewPushoverConnector()
-	broker := NewPushoverBroker(8499, certFilePath, keyFilePath, pushoverConnector)
-	broker.Run()
+	broker, err := NewPushoverBroker(config, pushoverConnector)
+	if err == nil {
+		// stop the broker gracefully on SIGINT or SIGTERM
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+			received := <-signals
+			slog.Info("Stopping the broker.", "signal", received.String())
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			broker.Shutdown(ctx)
+		}()
+		err = broker.Run()
+	}
+
+	// flush the spans recorded so far
+	if errors.Is(err, http.ErrServerClosed) {
+		slog.Info("The broker stopped.")
+		shutdownTracing(context.Background())
+		os.Exit(0)
+	}
+	slog.Error("The broker stopped.", logKeyError, err)
+	shutdownTracing(context.Background())
+	os.Exit(1)
 }
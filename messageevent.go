@@ -0,0 +1,41 @@
+package main
+
+import "time"
+
+// the types of the message lifecycle events
+const (
+	messageEventAccepted   = "accepted"   // the message was accepted by the broker
+	messageEventQueued     = "queued"     // the message was stored into the queue after a temporary failure or for the scheduled delivery
+	messageEventRetried    = "retried"    // the delivery of the queued message is attempted again
+	messageEventDelivered  = "delivered"  // the message was delivered to the Pushover API
+	messageEventFailed     = "failed"     // the message was rejected by the Pushover API or by the limits
+	messageEventExpired    = "expired"    // the queued message expired before the delivery
+	messageEventSuppressed = "suppressed" // the message was not delivered as a duplicate of a recent message
+	messageEventDigested   = "digested"   // the message was added to the digest of the user, the digest is delivered as a new message
+)
+
+// messageEventTypes are all the types of the message lifecycle events
+var messageEventTypes = []string{messageEventAccepted, messageEventQueued, messageEventRetried, messageEventDelivered, messageEventFailed, messageEventExpired, messageEventSuppressed, messageEventDigested}
+
+// MessageEvent represents a change of the message state emitted by the Processor. The event does not carry the secrets nor the
+// content of the message, the user is redacted.
+type MessageEvent struct {
+	ID            string    `json:"id"` // unique identifier of the event
+	Type          string    `json:"type"`
+	Request       string    `json:"request"`                  // request of the message
+	ParentRequest string    `json:"parent_request,omitempty"` // request of the routed message, if the message is one of its recipients
+	TokenAlias    string    `json:"token_alias,omitempty"`
+	User          string    `json:"user,omitempty"` // redacted user (or alias) of the message
+	user          string    // user (or alias) of the message for the filtering, not published
+	Priority      int       `json:"priority"`
+	Attempt       int       `json:"attempt,omitempty"`     // number of the delivery attempt
+	StatusCode    int       `json:"status_code,omitempty"` // status code of the Pushover API or of the broker response
+	Error         string    `json:"error,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+// MessageEventListener represents a receiver of the message lifecycle events
+type MessageEventListener interface {
+	// HandleEvent receives the event, it is called synchronously by the processing and must not block
+	HandleEvent(event *MessageEvent)
+}
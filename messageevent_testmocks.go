@@ -0,0 +1,27 @@
+package main
+
+import "strings"
+
+// MessageEventListenerMock implements the MessageEventListener interface
+type MessageEventListenerMock struct {
+	events []MessageEvent // all the received events
+}
+
+// NewMessageEventListenerMock initializes the mock
+func NewMessageEventListenerMock() *MessageEventListenerMock {
+	return new(MessageEventListenerMock)
+}
+
+// HandleEvent records the event
+func (elm *MessageEventListenerMock) HandleEvent(event *MessageEvent) {
+	elm.events = append(elm.events, *event)
+}
+
+// GetEventTypes returns the comma separated types of the received events
+func (elm *MessageEventListenerMock) GetEventTypes() string {
+	var types []string
+	for _, event := range elm.events {
+		types = append(types, event.Type)
+	}
+	return strings.Join(types, ",")
+}
@@ -0,0 +1,71 @@
+package main
+
+import "time"
+
+// the states of the queued messages
+const (
+	queuedMessageStateQueued    = "queued"    // waiting for the repeated delivery attempt
+	queuedMessageStateScheduled = "scheduled" // waiting for the scheduled delivery time, the delivery has not been attempted yet
+)
+
+// AttemptResult represents the result of a failed delivery attempt
+type AttemptResult struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code"` // status code of the Pushover API response, 0 if the API could not be reached
+	Error      string    `json:"error"`
+}
+
+// QueuedMessage represents a push notification accepted by the broker and waiting for the delivery to the Pushover API
+type QueuedMessage struct {
+	ID            string            `json:"id"`                      // request identifier assigned on the acceptance
+	ParentID      string            `json:"parent_id,omitempty"`     // identifier of the request the message was routed from, empty if not routed
+	Notification  PushNotification  `json:"notification"`            // notification as received from the client (aliases are resolved on the delivery)
+	TokenAlias    string            `json:"token_alias"`             // alias of the token, empty if the client used the real token
+	AcceptedAt    time.Time         `json:"accepted_at"`             // time of the acceptance by the broker
+	ScheduledAt   time.Time         `json:"scheduled_at,omitzero"`   // time of the scheduled delivery (send_at), zero if delivered immediately
+	Attempts      int               `json:"attempts"`                // number of the delivery attempts made so far
+	NextAttemptAt time.Time         `json:"next_attempt_at"`         // the message is not delivered before this time
+	ExpiresAt     time.Time         `json:"expires_at,omitzero"`     // the message is not delivered after this time, zero if it does not expire
+	LastError     string            `json:"last_error,omitempty"`    // result of the last failed attempt
+	History       []AttemptResult   `json:"history,omitempty"`       // results of all the failed attempts
+	TraceContext  map[string]string `json:"trace_context,omitempty"` // W3C trace context of the request accepting the message
+}
+
+// recordFailedAttempt counts the failed delivery attempt and appends its result to the history
+func (q *QueuedMessage) recordFailedAttempt(at time.Time, statusCode int, lastError string) {
+	q.Attempts++
+	q.LastError = lastError
+	q.History = append(q.History, AttemptResult{At: at, StatusCode: statusCode, Error: lastError})
+}
+
+// isPendingSchedule returns true if the message is scheduled and its delivery has not been attempted yet
+func (q *QueuedMessage) isPendingSchedule() bool {
+	return !q.ScheduledAt.IsZero() && q.Attempts == 0
+}
+
+// getState returns the state of the queued message
+func (q *QueuedMessage) getState() string {
+	if q.isPendingSchedule() {
+		return queuedMessageStateScheduled
+	}
+	return queuedMessageStateQueued
+}
+
+// MessageRepository represents an interface of the persistent queue of the messages waiting for the delivery
+type MessageRepository interface {
+
+	// Store adds the message to the queue or updates the already queued message
+	Store(message *QueuedMessage) error
+
+	// Remove removes the message from the queue, removing of a message not present in the queue is not an error
+	Remove(id string) error
+
+	// Get returns the queued message or nil, if not present in the queue
+	Get(id string) (*QueuedMessage, error)
+
+	// List returns all the queued messages in the delivery order, i.e. ordered by the priority (highest first) and the acceptance time
+	List() ([]*QueuedMessage, error)
+
+	// CheckWritable returns error if the queue cannot be modified
+	CheckWritable() error
+}
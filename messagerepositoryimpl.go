@@ -0,0 +1,59 @@
+package main
+
+import "sort"
+
+// MessageRepositoryImpl implements the MessageRepository interface, every queued message is stored in a separate file in the queue directory
+type MessageRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewMessageRepositoryImpl creates a new message repository in the given directory. The messages already present in the directory stay queued.
+func NewMessageRepositoryImpl(dir string) (*MessageRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	mr := new(MessageRepositoryImpl)
+	mr.store = store
+	return mr, nil
+}
+
+// Store adds the message to the queue or updates the already queued message
+func (mr *MessageRepositoryImpl) Store(message *QueuedMessage) error {
+	return mr.store.save(message.ID, message)
+}
+
+// Remove removes the message from the queue, removing of a message not present in the queue is not an error
+func (mr *MessageRepositoryImpl) Remove(id string) error {
+	return mr.store.remove(id)
+}
+
+// Get returns the queued message or nil, if not present in the queue
+func (mr *MessageRepositoryImpl) Get(id string) (*QueuedMessage, error) {
+	message := new(QueuedMessage)
+	exists, err := mr.store.load(id, message)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return message, nil
+}
+
+// List returns all the queued messages in the delivery order, i.e. ordered by the priority (highest first) and the acceptance time
+func (mr *MessageRepositoryImpl) List() ([]*QueuedMessage, error) {
+	messages, err := loadAllJSON[QueuedMessage](mr.store)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].Notification.Priority != messages[j].Notification.Priority {
+			return messages[i].Notification.Priority > messages[j].Notification.Priority
+		}
+		return messages[i].AcceptedAt.Before(messages[j].AcceptedAt)
+	})
+	return messages, nil
+}
+
+// CheckWritable returns error if the queue cannot be modified
+func (mr *MessageRepositoryImpl) CheckWritable() error {
+	return mr.store.checkWritable()
+}
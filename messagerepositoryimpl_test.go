@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageRepositoryShouldKeepMessagesAcrossInstances(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	messageRepository, err := NewMessageRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	messageRepository.Store(&QueuedMessage{ID: "b", Notification: PushNotification{Token: "<token>", User: "<user>", Message: "second"}, AcceptedAt: now})
+	messageRepository.Store(&QueuedMessage{ID: "a", Notification: PushNotification{Token: "<token>", User: "<user>", Message: "first"}, AcceptedAt: now.Add(-time.Minute)})
+	messageRepository.Store(&QueuedMessage{ID: "c", Notification: PushNotification{Token: "<token>", User: "<user>", Message: "removed"}, AcceptedAt: now})
+	messageRepository.Remove("c")
+
+	// WHEN
+	reopenedRepository, err := NewMessageRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Message repository reopening failed with error %s.", err)
+	}
+	messages, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing failed with error %s.", err)
+	}
+	if len(messages) != 2 || messages[0].Notification.Message != "first" || messages[1].Notification.Message != "second" {
+		t.Errorf("Listed %d messages, expected the first and second message in the acceptance order.", len(messages))
+	}
+	removed, err := reopenedRepository.Get("c")
+	if removed != nil || err != nil {
+		t.Errorf("Get of the removed message returned %v and error %v, expected nil.", removed, err)
+	}
+}
+
+func TestMessageRepositoryShouldRejectInvalidIdentifiers(t *testing.T) {
+
+	// GIVEN
+	messageRepository, err := NewMessageRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+
+	// WHEN
+	_, err = messageRepository.Get("../config")
+
+	// THEN
+	if err == nil {
+		t.Errorf("Get with the identifier outside the repository succeeded, expected error.")
+	}
+}
+
+func TestMessageRepositoryShouldListByPriorityAndAcceptance(t *testing.T) {
+
+	// GIVEN
+	messageRepository, err := NewMessageRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	messageRepository.Store(&QueuedMessage{ID: "lowest", Notification: PushNotification{Priority: priorityLowest}, AcceptedAt: now.Add(-time.Hour)})
+	messageRepository.Store(&QueuedMessage{ID: "normallater", Notification: PushNotification{Priority: priorityNormal}, AcceptedAt: now})
+	messageRepository.Store(&QueuedMessage{ID: "normal", Notification: PushNotification{Priority: priorityNormal}, AcceptedAt: now.Add(-time.Minute)})
+	messageRepository.Store(&QueuedMessage{ID: "emergency", Notification: PushNotification{Priority: priorityEmergency}, AcceptedAt: now})
+
+	// WHEN
+	messages, err := messageRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing failed with error %s.", err)
+	}
+	var ids []string
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	if strings.Join(ids, ",") != "emergency,normal,normallater,lowest" {
+		t.Errorf("Messages listed in the order %v, expected emergency,normal,normallater,lowest.", ids)
+	}
+}
+
+func TestMessageRepositoryShouldSkipCorruptMessages(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	messageRepository, err := NewMessageRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	messageRepository.Store(&QueuedMessage{ID: "a", Notification: PushNotification{Token: "<token>", User: "<user>", Message: "first"}, AcceptedAt: now.Add(-time.Minute)})
+	messageRepository.Store(&QueuedMessage{ID: "c", Notification: PushNotification{Token: "<token>", User: "<user>", Message: "second"}, AcceptedAt: now})
+	os.WriteFile(path.Join(dir, "b.json"), []byte("{\"id\": \"b\", \"notifica"), 0600)
+
+	// WHEN
+	messages, err := messageRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing failed with error %s.", err)
+	}
+	if len(messages) != 2 || messages[0].ID != "a" || messages[1].ID != "c" {
+		t.Errorf("Listed %d messages, expected the first and second message without the corrupt one.", len(messages))
+	}
+	if _, err := os.Stat(path.Join(dir, "b.corrupt")); err != nil {
+		t.Errorf("The corrupt message was not moved aside, error %s.", err)
+	}
+	messages, err = messageRepository.List()
+	if err != nil || len(messages) != 2 {
+		t.Errorf("Repeated listing returned %d messages and error %v, expected 2 messages.", len(messages), err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// templateField is the name of the form field selecting the message template
+const templateField = "template"
+
+// templateVarsPrefix is the prefix of the form fields passing the template variables, e.g. vars.host
+const templateVarsPrefix = "vars."
+
+// MessageTemplate renders the title and message of the notification from the variables passed by the client and provides
+// the default priority, sound and URL
+type MessageTemplate struct {
+	name     string
+	title    *template.Template // nil if the template does not define the title
+	message  *template.Template // nil if the template does not define the message
+	priority *int               // nil if the template does not define the default priority
+	sound    string
+	url      string
+}
+
+// NewMessageTemplate parses the message template, the title and message are text/template templates of the variables
+func NewMessageTemplate(name string, title string, message string, priority *int, sound string, url string) (*MessageTemplate, error) {
+	mt := new(MessageTemplate)
+	mt.name = name
+	var err error
+	mt.title, err = parseTemplateText(name+".title", title)
+	if err != nil {
+		return nil, err
+	}
+	mt.message, err = parseTemplateText(name+".message", message)
+	if err != nil {
+		return nil, err
+	}
+	mt.priority = priority
+	mt.sound = sound
+	mt.url = url
+	return mt, nil
+}
+
+// Render fills the notification decoded from the form by the rendered title and message and by the defaults not given by the form.
+// The template variables are taken from the vars.* form fields.
+func (mt *MessageTemplate) Render(pn PushNotification, form url.Values) (PushNotification, error) {
+
+	// collect the variables
+	vars := make(map[string]string)
+	for name, values := range form {
+		if strings.HasPrefix(name, templateVarsPrefix) && len(values) > 0 {
+			vars[strings.TrimPrefix(name, templateVarsPrefix)] = values[0]
+		}
+	}
+
+	// render the texts
+	var err error
+	if mt.title != nil {
+		pn.Title, err = executeTemplate(mt.title, vars)
+		if err != nil {
+			return pn, err
+		}
+	}
+	if mt.message != nil {
+		pn.Message, err = executeTemplate(mt.message, vars)
+		if err != nil {
+			return pn, err
+		}
+	}
+
+	// apply the defaults
+	if mt.priority != nil && !form.Has("priority") {
+		pn.Priority = *mt.priority
+	}
+	if pn.Sound == "" {
+		pn.Sound = mt.sound
+	}
+	if pn.URL == "" {
+		pn.URL = mt.url
+	}
+	return pn, nil
+}
+
+// parses the template text, returns nil for the empty text. The missing variables are reported as errors.
+func parseTemplateText(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing of the template %s failed with error %s", name, err.Error())
+	}
+	return parsed, nil
+}
+
+// returns the template rendered with the variables
+func executeTemplate(parsed *template.Template, vars map[string]string) (string, error) {
+	var rendered strings.Builder
+	err := parsed.Execute(&rendered, vars)
+	if err != nil {
+		return "", fmt.Errorf("rendering of the template %s failed with error %s", parsed.Name(), err.Error())
+	}
+	return rendered.String(), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMessageTemplateShouldRender(t *testing.T) {
+
+	highPriority := priorityHigh
+
+	var testcases = []struct {
+		id              string
+		form            url.Values
+		expectedMessage PushNotification
+		expectedErr     bool
+	}{
+		{
+			"ShouldRenderVariablesAndDefaults",
+			url.Values{"vars.host": {"nas"}, "vars.size": {"12 GB"}},
+			PushNotification{Token: "T", User: "U", Title: "Backup of nas", Message: "Backup finished, 12 GB written.", Priority: priorityHigh, Sound: "cashregister", URL: "https://backup.example.com"},
+			false,
+		},
+		{
+			"ShouldKeepClientValues",
+			url.Values{"vars.host": {"nas"}, "vars.size": {"1 GB"}, "priority": {"0"}, "sound": {"none"}},
+			PushNotification{Token: "T", User: "U", Title: "Backup of nas", Message: "Backup finished, 1 GB written.", Priority: priorityNormal, Sound: "none", URL: "https://backup.example.com"},
+			false,
+		},
+		{
+			"ShouldRejectMissingVariable",
+			url.Values{"vars.host": {"nas"}},
+			PushNotification{},
+			true,
+		},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			messageTemplate, err := NewMessageTemplate("backup", "Backup of {{.host}}", "Backup finished, {{.size}} written.", &highPriority, "cashregister", "https://backup.example.com")
+			if err != nil {
+				t.Fatalf("Parsing of the template failed with error %s.", err)
+			}
+			decoded := PushNotification{Token: "T", User: "U", Sound: tc.form.Get("sound")}
+			if tc.form.Has("priority") {
+				decoded.Priority = priorityNormal
+			}
+
+			// WHEN
+			rendered, err := messageTemplate.Render(decoded, tc.form)
+
+			// THEN
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Rendering returned error %v, expected error %t.", err, tc.expectedErr)
+			}
+			if !tc.expectedErr && rendered != tc.expectedMessage {
+				t.Errorf("Message %v rendered, expected %v.", rendered, tc.expectedMessage)
+			}
+		})
+	}
+}
+
+func TestMessageTemplateShouldRejectInvalidTemplate(t *testing.T) {
+
+	// WHEN
+	_, err := NewMessageTemplate("broken", "{{.host", "", nil, "", "")
+
+	// THEN
+	if err == nil {
+		t.Error("The invalid template was parsed, expected error.")
+	}
+}
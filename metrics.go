@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// the broker metrics exposed on /metrics
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_received_total",
+		Help: "Number of the messages received by the processor.",
+	})
+	messagesDelivered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_delivered_total",
+		Help: "Number of the messages successfully delivered to the Pushover API.",
+	})
+	messagesQueued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_queued_total",
+		Help: "Number of the messages accepted to the queue after a temporary delivery failure.",
+	})
+	messagesScheduled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_scheduled_total",
+		Help: "Number of the messages accepted to the queue for the scheduled delivery.",
+	})
+	messagesRetried = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_retried_total",
+		Help: "Number of the repeated delivery attempts of the queued messages.",
+	})
+	messagesFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_failed_total",
+		Help: "Number of the messages permanently failed to be delivered.",
+	})
+	messagesExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_expired_total",
+		Help: "Number of the queued messages expired before the delivery.",
+	})
+	idempotentReplays = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_idempotent_replays_total",
+		Help: "Number of the repeated requests answered by the remembered response of their idempotency key.",
+	})
+	messagesSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_suppressed_total",
+		Help: "Number of the duplicate messages suppressed within the deduplication window.",
+	})
+	messagesDigested = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_digested_total",
+		Help: "Number of the low priority messages accumulated into the digests.",
+	})
+	escalationsStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_escalations_started_total",
+		Help: "Number of the escalations started by the delivered emergency messages.",
+	})
+	escalationSteps = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_escalation_steps_total",
+		Help: "Number of the emergency messages escalated to the next user of the chain.",
+	})
+	escalationsAcknowledged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_escalations_acknowledged_total",
+		Help: "Number of the escalated messages acknowledged by a notified user.",
+	})
+	escalationsExhausted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_escalations_exhausted_total",
+		Help: "Number of the escalated messages not acknowledged by any user of the chain.",
+	})
+	callbacksForwarded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_callbacks_forwarded_total",
+		Help: "Number of the acknowledgements forwarded to the callback URLs.",
+	})
+	callbacksFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_callbacks_failed_total",
+		Help: "Number of the acknowledgements not forwarded to the callback URLs after all the attempts.",
+	})
+	webhookEventsDelivered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_webhook_events_delivered_total",
+		Help: "Number of the message lifecycle events delivered to the webhooks.",
+	})
+	webhookEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_webhook_events_dropped_total",
+		Help: "Number of the message lifecycle events dropped after all the delivery attempts to the webhook failed.",
+	})
+	streamEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_stream_events_dropped_total",
+		Help: "Number of the message lifecycle events dropped by the event streams not keeping up.",
+	})
+	messagesRejectedByLimits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pushoverbroker_messages_rejected_by_limits_total",
+		Help: "Number of the messages rejected because the application limits were exhausted.",
+	})
+	pushoverAPILatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pushoverbroker_pushover_api_request_duration_seconds",
+		Help:    "Duration of the Pushover API requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"status_code"})
+	pushoverLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pushoverbroker_pushover_last_success_timestamp_seconds",
+		Help: "Unix time of the last request answered by the Pushover API.",
+	})
+	limitsRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pushoverbroker_limits_remaining",
+		Help: "Number of the messages remaining in the application limits.",
+	}, []string{"token_alias"})
+)
+
+// queueCollector reports the queue depth, the age of the oldest queued message and the number of the dead letters from the repositories
+// on every scrape
+type queueCollector struct {
+	messageRepository    MessageRepository
+	deadLetterRepository DeadLetterRepository
+	queueDepthDesc       *prometheus.Desc
+	oldestQueuedAgeDesc  *prometheus.Desc
+	deadLettersDesc      *prometheus.Desc
+}
+
+// newQueueCollector creates the collector of the queue metrics, the collector has to be registered
+func newQueueCollector(messageRepository MessageRepository, deadLetterRepository DeadLetterRepository) *queueCollector {
+	qc := new(queueCollector)
+	qc.messageRepository = messageRepository
+	qc.deadLetterRepository = deadLetterRepository
+	qc.queueDepthDesc = prometheus.NewDesc("pushoverbroker_queue_depth", "Number of the messages waiting in the queue.", nil, nil)
+	qc.oldestQueuedAgeDesc = prometheus.NewDesc("pushoverbroker_queue_oldest_age_seconds", "Age of the oldest message waiting in the queue.", nil, nil)
+	qc.deadLettersDesc = prometheus.NewDesc("pushoverbroker_dead_letters", "Number of the permanently failed messages in the dead letters.", nil, nil)
+	return qc
+}
+
+// Describe sends the descriptors of the queue metrics (see prometheus.Collector)
+func (qc *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- qc.queueDepthDesc
+	ch <- qc.oldestQueuedAgeDesc
+	ch <- qc.deadLettersDesc
+}
+
+// Collect reads the queue and sends the current values of the queue metrics (see prometheus.Collector)
+func (qc *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	messages, err := qc.messageRepository.List()
+	if err != nil {
+		slog.Error("Listing of the queue for the metrics failed.", logKeyError, err)
+		return
+	}
+
+	// the messages are ordered by the priority, the oldest one can be anywhere
+	oldestQueuedAge := 0.0
+	for _, message := range messages {
+		oldestQueuedAge = max(oldestQueuedAge, time.Since(message.AcceptedAt).Seconds())
+	}
+	ch <- prometheus.MustNewConstMetric(qc.queueDepthDesc, prometheus.GaugeValue, float64(len(messages)))
+	ch <- prometheus.MustNewConstMetric(qc.oldestQueuedAgeDesc, prometheus.GaugeValue, oldestQueuedAge)
+
+	// the dead letters are reported only if they are stored
+	if qc.deadLetterRepository == nil {
+		return
+	}
+	deadLetters, err := qc.deadLetterRepository.List()
+	if err != nil {
+		slog.Error("Listing of the dead letters for the metrics failed.", logKeyError, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(qc.deadLettersDesc, prometheus.GaugeValue, float64(len(deadLetters)))
+}
+
+// returns the label identifying the token in the metrics, the alias if known, the redacted token otherwise
+func getTokenMetricsLabel(tokenAlias string, token string) string {
+	if tokenAlias != "" {
+		return tokenAlias
+	}
+	return RedactSecret(token)
+}
@@ -1,93 +1,1416 @@
 package main
 
-import "log"
-import "net/http"
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// default period of processing the queue
+const defaultRetryInterval = 30 * time.Second
+
+// default maximal delay between two delivery attempts of a queued message
+const defaultMaxRetryDelay = time.Hour
+
+// maximal length of the Pushover message in characters
+const pushoverMaxMessageLength = 1024
+
+// time for which the finished escalations are kept for their status
+const escalationRetention = 24 * time.Hour
+
+// maximal number of the attempts to forward the acknowledgement to the callback URL
+const maxCallbackAttempts = 10
+
+// deliveryResult represents the outcome of a delivery attempt
+type deliveryResult int
+
+const (
+	deliverySucceeded        deliveryResult = iota // the message was accepted by the Pushover API
+	deliveryTemporaryFailure                       // the delivery should be repeated later
+	deliveryPermanentFailure                       // the message was rejected by the Pushover API, repeating would not help
+)
+
+// UpstreamStatus represents the reachability of the Pushover API as observed by the delivery attempts
+type UpstreamStatus struct {
+	LastSuccessAt time.Time // time of the last attempt answered by the Pushover API, zero if none yet
+	LastFailureAt time.Time // time of the last attempt that failed to reach the Pushover API, zero if none yet
+}
 
 // Processor handles the incomming messages, is responsible for the queing, persinstence and repeated attempts to deliver
 type Processor struct {
 	PushNotificationsSender PushNotificationsSender
 	LimitsCounter           LimitsCounter
+	TokenVault              *TokenVault
+	MessageRepository       MessageRepository
+	DeadLetterRepository    DeadLetterRepository         // store of the permanently failed queued messages, the messages are dropped if nil
+	DeadLetterNotification  *PushNotification            // token and user notified about the new dead letters, nil if not notified
+	RetryInterval           time.Duration                // period of processing the queue and the delay before the first repeated attempt
+	MaxRetryDelay           time.Duration                // maximal delay between two attempts, the delay doubles with every attempt up to this value
+	MaxQueueAge             map[int]time.Duration        // priority -> age after which the queued message expires (unless given by the message), no expiry if not present
+	Deduplicator            *Deduplicator                // suppresses the duplicate messages, nil if the duplicates are delivered
+	DigestRepository        DigestRepository             // store of the pending digests of the low priority messages, the messages are not digested if nil
+	DigestInterval          time.Duration                // time of accumulating the low priority messages of a user before the digest is sent
+	QuietHours              map[string]*QuietHours       // user (alias or key) -> quiet hours of the user, the users not present have no quiet hours
+	ReceiptsChecker         ReceiptsChecker              // polls and cancels the receipts of the emergency messages, the messages are not escalated if nil
+	EscalationRepository    EscalationRepository         // store of the escalations of the emergency messages, the messages are not escalated if nil
+	EscalationPolicies      map[string]*EscalationPolicy // name -> escalation policy selected by the escalation parameter of the message
+	CallbackForwarder       CallbackForwarder            // forwards the acknowledgements to the callback URLs of the clients, the callbacks are rejected if nil
+	EventListeners          []MessageEventListener       // receive the lifecycle events of the messages
+	wakeUp                  chan struct{}
+	stop                    chan struct{}
+	running                 atomic.Bool
+	upstreamStatus          UpstreamStatus
+	upstreamStatusMutex     sync.Mutex
+	queueMutex              sync.Mutex    // serializes the delivery attempts and the administrative changes of the queued messages
+	deadLetterNotifications []*DeadLetter // dead letters to be notified to the administrator after the queue lock is released
+	digestMutex             sync.Mutex    // serializes the changes of the pending digests
+	escalationMutex         sync.Mutex    // serializes the changes of the escalations
 }
 
 // NewProcessor creates a new instance of the Processor
-func NewProcessor(PushNotificationsSender PushNotificationsSender, LimitsCounter LimitsCounter) *Processor {
+func NewProcessor(PushNotificationsSender PushNotificationsSender, LimitsCounter LimitsCounter, MessageRepository MessageRepository) *Processor {
 	p := new(Processor)
 	p.PushNotificationsSender = PushNotificationsSender
 	p.LimitsCounter = LimitsCounter
+	p.TokenVault = NewTokenVault(nil, nil, nil, false)
+	p.MessageRepository = MessageRepository
+	p.RetryInterval = defaultRetryInterval
+	p.MaxRetryDelay = defaultMaxRetryDelay
+	p.wakeUp = make(chan struct{}, 1)
+	p.stop = make(chan struct{})
 	return p
 }
 
+// classifies the result of the PushNotificationsSender call
+func classifyDeliveryResult(responseErr error, responseCode int) deliveryResult {
+
+	// if the posting failed we assume the sender works fine (should be checked by the production tests), but connection cannot be made temporarily
+	if responseErr != nil {
+		return deliveryTemporaryFailure
+	}
+
+	switch {
+	case responseCode >= 100 && responseCode < 300: // success codes
+		return deliverySucceeded
+
+	case
+		responseCode == 429,                       // Too Many Requests
+		responseCode >= 500 && responseCode < 600: // server errors, e.g. Bad Gateway, Service Unavailable or Network Timeout
+		return deliveryTemporaryFailure
+
+	default: // all other failures
+		return deliveryPermanentFailure
+	}
+}
+
 // HandleMessage receives a message to be processed (see IncommingPushNotificationMessageHandler interface)
-func (p *Processor) HandleMessage(response *PushNotificationHandlingResponse, message PushNotification) error {
+func (p *Processor) HandleMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error {
+
+	messagesReceived.Inc()
+
+	// replace the aliases by the real token and user key
+	resolvedMessage, tokenAlias, err := p.TokenVault.Resolve(message)
+
+	// audit the client sending the message (empty if the client certificates are not required)
+	requestID := GetRequestID(ctx)
+	ctx, span := getTracer().Start(ctx, "Processor.HandleMessage", trace.WithAttributes(attribute.String(traceKeyRequestID, requestID), attribute.String(traceKeyTokenAlias, tokenAlias)))
+	defer span.End()
+	logger := GetLogger(ctx).With(logKeyTokenAlias, tokenAlias)
+	logger.Info("Processing message.", "notification", message.DumpToString())
+
+	// if the aliases could not be resolved
+	if err != nil {
+		logger.Warn("Resolving of the token and user aliases failed.", logKeyError, err)
+		recordSpanError(span, err)
+		messagesFailed.Inc()
+		response.responseCode = http.StatusBadRequest
+		response.limits = nil
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"%s\"] }", requestID, err.Error())
+		return nil
+	}
+
+	// the escalated message has to select a known policy
+	if message.Escalation != "" && p.getEscalationPolicy(message.Escalation) == nil {
+		logger.Warn("Unknown escalation policy.", "escalation", message.Escalation)
+		messagesFailed.Inc()
+		response.responseCode = http.StatusBadRequest
+		response.limits = nil
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"unknown escalation policy %s\"] }", requestID, message.Escalation)
+		return nil
+	}
+	if message.BrokerCallback != "" && (!p.isTrackingReceipts() || p.CallbackForwarder == nil) {
+		logger.Warn("Callback requested, but the callbacks are not supported.")
+		messagesFailed.Inc()
+		response.responseCode = http.StatusBadRequest
+		response.limits = nil
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"broker_callback is not supported\"] }", requestID)
+		return nil
+	}
+
+	p.emitEvent(&MessageEvent{Type: messageEventAccepted, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority})
+
+	// the message is delivered now, unless it is scheduled to the future
+	now := time.Now()
+	deliverAt, _ := message.GetSendAt()
+	if deliverAt.Before(now) {
+		deliverAt = now
+	}
+
+	// the non-emergency messages delivered during the quiet hours of the user are deferred until their end or downgraded
+	downgraded := false
+	if quietHours := p.getQuietHours(message, resolvedMessage); quietHours != nil && message.Priority < priorityEmergency {
+		if quietUntil := quietHours.GetEnd(deliverAt); !quietUntil.IsZero() {
+			if quietHours.action == quietHoursActionDowngrade {
+				logger.Info("Message downgraded during the quiet hours of the user.", "quiet_until", quietUntil)
+				downgraded = message.Priority > priorityLow
+				message.Priority = min(message.Priority, priorityLow)
+				resolvedMessage.Priority = message.Priority
+			} else {
+				// the deferred message is displayed with the time it was meant to be delivered
+				logger.Info("Message deferred until the end of the quiet hours of the user.", "quiet_until", quietUntil)
+				if message.Timestamp == 0 {
+					message.Timestamp = deliverAt.Unix()
+				}
+				return p.scheduleMessage(ctx, logger, response, message, tokenAlias, requestID, quietUntil)
+			}
+		}
+	}
+
+	// the message scheduled to the future waits in the queue until its delivery time
+	if deliverAt.After(now) {
+		return p.scheduleMessage(ctx, logger, response, message, tokenAlias, requestID, deliverAt)
+	}
+
+	// the duplicate is accepted, but not delivered
+	if p.Deduplicator != nil && p.Deduplicator.IsDuplicate(resolvedMessage, message, time.Now()) {
+		logger.Info("Duplicate message suppressed.")
+		messagesSuppressed.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventSuppressed, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority})
+		response.responseCode = http.StatusOK
+		response.limits, _ = p.LimitsCounter.GetLimits(resolvedMessage.GetToken())
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 1, \"request\": \"%s\" }", requestID)
+		return nil
+	}
+
+	// the low priority messages are accumulated into the digest of the user, the messages downgraded by the quiet hours are delivered
+	// immediately
+	if p.DigestRepository != nil && message.Priority < priorityNormal && !downgraded {
+		err = p.addToDigest(logger, response, message, resolvedMessage, requestID)
+		if err == nil {
+			p.emitEvent(&MessageEvent{Type: messageEventDigested, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority})
+		}
+		return err
+	}
+
+	err = p.deliverMessage(ctx, logger, response, message, resolvedMessage, tokenAlias, requestID)
+
+	// the escalation starts when the emergency message is delivered, the queued message is tracked on its delivery
+	if err == nil && requiresReceiptTracking(message) && response.responseCode == http.StatusOK {
+		p.trackEscalation(logger, message, tokenAlias, requestID, GetParentRequestID(ctx), response.jsonResponseBody)
+	}
+	return err
+}
+
+// adds the message into the pending digest of the user and generates the 200 (OK) response, the digest is opened by the first message
+func (p *Processor) addToDigest(logger *slog.Logger, response *PushNotificationHandlingResponse, message PushNotification, resolvedMessage PushNotification, requestID string) error {
+
+	// lock the mutex
+	p.digestMutex.Lock()
+	defer p.digestMutex.Unlock()
+
+	// the digest is identified by the resolved values, so that the aliases and real values share it
+	digestID := getContentKey(PushNotification{Token: resolvedMessage.Token, User: resolvedMessage.User})
+	digest, err := p.DigestRepository.Get(digestID)
+	if err != nil {
+		logger.Error("Reading of the digest failed.", logKeyError, err)
+		return err
+	}
+	now := time.Now()
+	if digest == nil {
+		digest = &Digest{ID: digestID, Token: message.Token, User: message.User, OpenedAt: now, SendAt: now.Add(p.DigestInterval)}
+	}
+	digest.Items = append(digest.Items, DigestItem{ReceivedAt: now, Title: message.Title, Message: message.Message, Priority: message.Priority})
+	err = p.DigestRepository.Store(digest)
+	if err != nil {
+		logger.Error("Storing of the digest failed.", logKeyError, err)
+		return err
+	}
+	messagesDigested.Inc()
+
+	response.responseCode = http.StatusOK
+	response.limits, _ = p.LimitsCounter.GetLimits(resolvedMessage.GetToken())
+	response.jsonResponseBody = fmt.Sprintf("{\"status\": 1, \"request\": \"%s\" }", requestID)
+	logger.Info("Message added to the digest.", "digest_items", len(digest.Items), "send_at", digest.SendAt)
+	return nil
+}
+
+// sends the digests, whose sending time passed, as the combined notifications. The digest is removed after its notification
+// was delivered or queued. The digests are sent without holding the lock, so that the messages are added meanwhile.
+func (p *Processor) processDigests() {
+	if p.DigestRepository == nil {
+		return
+	}
+
+	// lock the mutex only for the listing
+	p.digestMutex.Lock()
+	digests, err := p.DigestRepository.List()
+	p.digestMutex.Unlock()
+	if err != nil {
+		slog.Error("Listing of the digests failed.", logKeyError, err)
+		return
+	}
+	now := time.Now()
+	for _, digest := range digests {
+		if digest.SendAt.After(now) {
+			break
+		}
+
+		// deliver the combined notification as a new message
+		requestID := NewRequestID()
+		ctx := WithRequestID(context.Background(), requestID)
+		ctx, span := getTracer().Start(ctx, "Processor.processDigests", trace.WithAttributes(attribute.String(traceKeyRequestID, requestID)))
+		notification := getDigestNotification(digest)
+		resolvedNotification, tokenAlias, err := p.TokenVault.Resolve(notification)
+		logger := GetLogger(ctx).With(logKeyTokenAlias, tokenAlias, "digest_items", len(digest.Items))
+		if err != nil {
+			// the digest cannot be ever sent
+			logger.Error("Resolving of the digest aliases failed, the digest is dropped.", logKeyError, recordSpanError(span, err))
+		} else {
+			logger.Info("Sending the digest.", "notification", notification.DumpToString())
+			var response = PushNotificationHandlingResponse{}
+			err = p.deliverMessage(ctx, logger, &response, notification, resolvedNotification, tokenAlias, requestID)
+			if err != nil {
+				logger.Error("Delivery of the digest failed, the digest is kept.", logKeyError, err)
+				span.End()
+				continue
+			}
+		}
+		span.End()
+		p.removeSentDigest(logger, digest)
+	}
+}
+
+// removes the sent items from the digest. The items added while the digest was being sent are kept as a new digest opened by the
+// first of them.
+func (p *Processor) removeSentDigest(logger *slog.Logger, sentDigest *Digest) {
+
+	// lock the mutex
+	p.digestMutex.Lock()
+	defer p.digestMutex.Unlock()
+
+	digest, err := p.DigestRepository.Get(sentDigest.ID)
+	if err != nil {
+		logger.Error("Reading of the sent digest failed.", logKeyError, err)
+		return
+	}
+	if digest == nil {
+		return
+	}
+	if len(digest.Items) <= len(sentDigest.Items) {
+		err = p.DigestRepository.Remove(digest.ID)
+		if err != nil {
+			logger.Error("Removing of the sent digest failed.", logKeyError, err)
+		}
+		return
+	}
+	digest.Items = digest.Items[len(sentDigest.Items):]
+	digest.OpenedAt = digest.Items[0].ReceivedAt
+	digest.SendAt = digest.OpenedAt.Add(p.DigestInterval)
+	err = p.DigestRepository.Store(digest)
+	if err != nil {
+		logger.Error("Storing of the digest of the remaining messages failed.", logKeyError, err)
+		return
+	}
+	logger.Info("Messages added while sending the digest kept for the next digest.", "digest_items", len(digest.Items), "send_at", digest.SendAt)
+}
+
+// returns the combined notification of the digest items, the notification has the highest priority of the items
+func getDigestNotification(digest *Digest) PushNotification {
+	notification := PushNotification{Token: digest.Token, User: digest.User, Priority: priorityLowest}
+	notification.Title = fmt.Sprintf("%d notifications", len(digest.Items))
+	var lines []string
+	for _, item := range digest.Items {
+		line := item.Message
+		if item.Title != "" {
+			line = item.Title + ": " + item.Message
+		}
+		lines = append(lines, line)
+		notification.Priority = max(notification.Priority, item.Priority)
+	}
+	notification.Message = truncateMessage(strings.Join(lines, "\n"), pushoverMaxMessageLength)
+	return notification
+}
+
+// returns the message truncated to the maximal number of characters, the truncation is marked by the ellipsis
+func truncateMessage(message string, maxLength int) string {
+	characters := []rune(message)
+	if len(characters) <= maxLength {
+		return message
+	}
+	return string(characters[:maxLength-1]) + "…"
+}
+
+// attempts to deliver the resolved message, the original message (with aliases) is queued if the delivery fails temporarily
+func (p *Processor) deliverMessage(ctx context.Context, logger *slog.Logger, response *PushNotificationHandlingResponse, message PushNotification, resolvedMessage PushNotification, tokenAlias string, requestID string) error {
 
 	// simple forward of the received message to the Pushover connector and return the result
-	responseErr := p.PushNotificationsSender.PostPushNotificationMessage(response, message)
+	responseErr := p.PushNotificationsSender.PostPushNotificationMessage(ctx, response, resolvedMessage)
+	p.recordUpstreamResult(responseErr, response.responseCode)
+	logger = logger.With(logKeyAttempt, 1)
 
-	acceptRequestToQueue := false
+	switch classifyDeliveryResult(responseErr, response.responseCode) {
+	case deliverySucceeded:
+		logger.Info("Message delivered to the Pushover API.", logKeyStatusCode, response.responseCode)
+		messagesDelivered.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventDelivered, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority, Attempt: 1, StatusCode: response.responseCode})
 
-	// if the call succeeded
-	if responseErr == nil {
+		// store the currnt limits into the cache
+		p.setLimits(resolvedMessage.GetToken(), tokenAlias, response.limits)
+		return nil
+
+	case deliveryPermanentFailure:
+		logger.Warn("Message rejected by the Pushover API.", logKeyStatusCode, response.responseCode)
+		messagesFailed.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventFailed, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority, Attempt: 1, StatusCode: response.responseCode})
+
+		// always generate a status=0 response
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\" }", requestID)
+		return nil
+	}
+
+	// the message should be accepted to queue
+	lastError := fmt.Sprintf("status code %d", response.responseCode)
+	if responseErr != nil {
+		logger.Warn("PushNotificationsSender.PostPushNotificationMessage failed.", logKeyError, responseErr)
+		lastError = responseErr.Error()
+	}
 
-		// if the response represents a temporary error and we should enqueue the message and try later
+	// decrement the limits for the current message
+	err := p.LimitsCounter.DecrementLimits(resolvedMessage.GetToken())
+	response.limits, _ = p.LimitsCounter.GetLimits(resolvedMessage.GetToken())
+	p.updateLimitsMetrics(tokenAlias, resolvedMessage.GetToken(), response.limits)
+
+	// if failed
+	if err != nil {
+		// return the not permited reponse
+		logger.Warn("Message rejected due to the exhausted limits.", logKeyError, err)
+		messagesRejectedByLimits.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventFailed, Request: requestID, ParentRequest: GetParentRequestID(ctx), TokenAlias: tokenAlias, user: message.User, Priority: message.Priority, StatusCode: http.StatusForbidden, Error: err.Error()})
+		response.responseCode = http.StatusForbidden
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"%s\"] }", requestID, err.Error())
+		return nil
+	}
+
+	// store the original message (with aliases) into the queue, it will be resolved again on the next attempt
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+	return p.queueMessage(ctx, logger, response, message, tokenAlias, requestID, lastError)
+}
+
+// returns true if the receipts of the emergency messages can be tracked
+func (p *Processor) isTrackingReceipts() bool {
+	return p.EscalationRepository != nil && p.ReceiptsChecker != nil
+}
+
+// returns the escalation policy of the given name, nil if the policy is not known or the escalations are not supported
+func (p *Processor) getEscalationPolicy(name string) *EscalationPolicy {
+	if !p.isTrackingReceipts() {
+		return nil
+	}
+	return p.EscalationPolicies[name]
+}
+
+// returns true if the acknowledgement of the delivered message should be tracked, i.e. it is escalated or forwarded to the callback
+func requiresReceiptTracking(message PushNotification) bool {
+	return message.Escalation != "" || message.BrokerCallback != ""
+}
+
+// records the receipt of the delivered emergency message into its escalation. The message is either a step of the escalation
+// given by the parent request, or it starts a new escalation.
+func (p *Processor) trackEscalation(logger *slog.Logger, message PushNotification, tokenAlias string, requestID string, parentID string, responseBody string) {
+	if !p.isTrackingReceipts() {
+		logger.Warn("The receipts are not tracked, the message is not escalated.")
+		return
+	}
+	var policy *EscalationPolicy
+	if message.Escalation != "" {
+		policy = p.getEscalationPolicy(message.Escalation)
+		if policy == nil {
+			logger.Warn("Unknown escalation policy, the message is not escalated.", "escalation", message.Escalation)
+			return
+		}
+	}
+	receipt := getReceiptFromResponse(responseBody)
+	if parentID != "" {
+		escalation := p.storeEscalationStepReceipt(logger, parentID, requestID, receipt)
+		if escalation != nil {
+
+			// the step delivered after the escalation finished is not needed any more
+			if escalation.State != escalationStateActive {
+				p.cancelEscalationReceipts(context.Background(), logger, escalation)
+				p.storeEscalationChanges(logger, escalation)
+			}
+			return
+		}
+	}
+
+	now := time.Now()
+	escalation := &Escalation{
+		ID:           requestID,
+		Policy:       message.Escalation,
+		TokenAlias:   tokenAlias,
+		Notification: message,
+		State:        escalationStateActive,
+		Steps:        []EscalationStep{{User: message.User, RequestID: requestID, Receipt: receipt, SentAt: now}},
+		StartedAt:    now,
+		UpdatedAt:    now,
+		Callback:     message.BrokerCallback,
+	}
+	if policy != nil {
+		escalation.EscalateAt = now.Add(policy.ackTimeout)
+	}
+
+	// lock the mutex
+	p.escalationMutex.Lock()
+	err := p.EscalationRepository.Store(escalation)
+	p.escalationMutex.Unlock()
+	if err != nil {
+		logger.Error("Storing of the escalation failed, the message is not escalated.", logKeyError, err)
+		return
+	}
+	escalationsStarted.Inc()
+	logger.Info("Tracking of the acknowledgement started.", "escalation", escalation.Policy, "escalate_at", escalation.EscalateAt, "callback", escalation.Callback != "")
+}
+
+// records the receipt of the delivered step of the escalation. Returns the updated escalation, nil if the escalation or its step
+// does not exist.
+func (p *Processor) storeEscalationStepReceipt(logger *slog.Logger, id string, requestID string, receipt string) *Escalation {
+
+	// lock the mutex
+	p.escalationMutex.Lock()
+	defer p.escalationMutex.Unlock()
+
+	escalation, err := p.EscalationRepository.Get(id)
+	if err != nil {
+		logger.Error("Reading of the escalation failed.", logKeyError, err)
+		return nil
+	}
+	for i := 0; escalation != nil && i < len(escalation.Steps); i++ {
+		if escalation.Steps[i].RequestID != requestID {
+			continue
+		}
+		escalation.Steps[i].Receipt = receipt
+		err = p.EscalationRepository.Store(escalation)
+		if err != nil {
+			logger.Error("Storing of the escalation failed.", logKeyError, err)
+		}
+		logger.Info("Escalation step delivered.", "escalation", escalation.ID, "step", i+1)
+		return escalation
+	}
+	return nil
+}
+
+// stores the escalation changed without holding the lock, e.g. after polling its receipts. The changes made meanwhile are kept:
+// the receipts of the steps delivered from the queue, the cancelled notifications and the cancellation of the escalation. Returns
+// true if the escalation was cancelled meanwhile and some of its steps still notify the users.
+func (p *Processor) storeEscalationChanges(logger *slog.Logger, escalation *Escalation) bool {
+
+	// lock the mutex
+	p.escalationMutex.Lock()
+	defer p.escalationMutex.Unlock()
+
+	current, err := p.EscalationRepository.Get(escalation.ID)
+	if err != nil {
+		logger.Error("Reading of the escalation failed.", logKeyError, err)
+		return false
+	}
+	if current == nil {
+		// the escalation was removed meanwhile
+		return false
+	}
+	for i := 0; i < len(current.Steps) && i < len(escalation.Steps); i++ {
+		if escalation.Steps[i].Receipt == "" {
+			escalation.Steps[i].Receipt = current.Steps[i].Receipt
+		}
+		escalation.Steps[i].Expired = escalation.Steps[i].Expired || current.Steps[i].Expired
+	}
+	notifying := false
+	if current.State == escalationStateCancelled && escalation.State != escalationStateCancelled {
+		escalation.State = current.State
+		escalation.UpdatedAt = current.UpdatedAt
+		for _, step := range escalation.Steps {
+			notifying = notifying || (step.Receipt != "" && !step.Expired)
+		}
+	}
+	err = p.EscalationRepository.Store(escalation)
+	if err != nil {
+		logger.Error("Storing of the escalation failed.", logKeyError, err)
+	}
+	return notifying
+}
+
+// polls the receipts of the active escalations, finishes the acknowledged ones and notifies the next users of the escalations not
+// acknowledged in time. The finished escalations are removed after the retention time. The receipts are polled and the steps and
+// callbacks are sent without holding the lock, so that the messages are tracked and the escalations are cancelled meanwhile.
+func (p *Processor) processEscalations() {
+	if !p.isTrackingReceipts() {
+		return
+	}
+
+	// lock the mutex only for the listing
+	p.escalationMutex.Lock()
+	escalations, err := p.EscalationRepository.List()
+	p.escalationMutex.Unlock()
+	if err != nil {
+		slog.Error("Listing of the escalations failed.", logKeyError, err)
+		return
+	}
+	now := time.Now()
+	for _, escalation := range escalations {
+		logger := slog.With(logKeyRequestID, escalation.ID, logKeyTokenAlias, escalation.TokenAlias, "escalation", escalation.Policy)
+		if escalation.State != escalationStateActive {
+			if escalation.isCallbackPending() {
+				if !now.Before(escalation.CallbackNextAttemptAt) {
+					p.forwardCallback(logger, escalation, now)
+					p.storeEscalationChanges(logger, escalation)
+				}
+				continue
+			}
+			if now.Sub(escalation.UpdatedAt) > escalationRetention {
+				p.escalationMutex.Lock()
+				err = p.EscalationRepository.Remove(escalation.ID)
+				p.escalationMutex.Unlock()
+				if err != nil {
+					logger.Error("Removing of the finished escalation failed.", logKeyError, err)
+				}
+			}
+			continue
+		}
+
+		p.updateEscalation(logger, escalation, now)
+		if escalation.isCallbackPending() {
+			p.forwardCallback(logger, escalation, now)
+		}
+
+		// the step sent while the escalation was being cancelled is stopped as well
+		if p.storeEscalationChanges(logger, escalation) {
+			p.cancelEscalationReceipts(context.Background(), logger, escalation)
+			p.storeEscalationChanges(logger, escalation)
+		}
+	}
+}
+
+// checks whether any notified user acknowledged the escalated message and notifies the next user of the chain if the message
+// was not acknowledged in time
+func (p *Processor) updateEscalation(logger *slog.Logger, escalation *Escalation, now time.Time) {
+	ctx, span := getTracer().Start(WithRequestID(context.Background(), escalation.ID), "Processor.updateEscalation", trace.WithAttributes(attribute.String(traceKeyRequestID, escalation.ID)))
+	defer span.End()
+
+	// resolve the aliases again, the vault might have changed
+	resolvedMessage, _, err := p.TokenVault.Resolve(escalation.Notification)
+	if err != nil {
+		logger.Error("Resolving of the escalation aliases failed, the escalation is stopped.", logKeyError, recordSpanError(span, err))
+		escalation.State = escalationStateExhausted
+		escalation.UpdatedAt = now
+		return
+	}
+
+	// any of the notified users may acknowledge the message
+	for i := range escalation.Steps {
+		step := &escalation.Steps[i]
+		if step.Receipt == "" || step.Expired {
+			continue
+		}
+		receipt, err := p.ReceiptsChecker.GetReceipt(ctx, resolvedMessage.Token, step.Receipt)
+		if err != nil {
+			logger.Warn("Polling of the receipt failed.", "step", i+1, logKeyError, err)
+			continue
+		}
+		if receipt.Acknowledged {
+			step.Expired = true
+			escalation.State = escalationStateAcknowledged
+			escalation.AcknowledgedAt = receipt.AcknowledgedAt
+			escalation.AcknowledgedBy = receipt.AcknowledgedBy
+			escalation.AcknowledgedReceipt = step.Receipt
+			escalation.UpdatedAt = now
+			escalationsAcknowledged.Inc()
+			logger.Info("Escalated message acknowledged.", "step", i+1, "acknowledged_by", RedactSecret(receipt.AcknowledgedBy))
+			p.cancelEscalationReceipts(ctx, logger, escalation)
+			return
+		}
+		step.Expired = receipt.Expired
+	}
+
+	// without the policy the message is tracked until all its notifications stop
+	if escalation.Policy == "" {
+		for _, step := range escalation.Steps {
+			if step.Receipt != "" && !step.Expired {
+				return
+			}
+		}
+		escalation.State = escalationStateExhausted
+		escalation.UpdatedAt = now
+		logger.Warn("Emergency message expired without the acknowledgement.")
+		return
+	}
+	if now.Before(escalation.EscalateAt) {
+		return
+	}
+
+	// the user of the message is followed by the users of the policy
+	policy := p.getEscalationPolicy(escalation.Policy)
+	next := len(escalation.Steps) - 1
+	if policy == nil || next >= len(policy.users) {
+		escalation.State = escalationStateExhausted
+		escalation.UpdatedAt = now
+		escalationsExhausted.Inc()
+		logger.Warn("Escalated message not acknowledged by any user of the chain.", "steps", len(escalation.Steps))
+		return
+	}
+	p.sendEscalationStep(ctx, logger, escalation, policy, policy.users[next], now)
+}
+
+// sends the escalated message to the next user of the chain, the message failing temporarily is queued as a step of the escalation
+func (p *Processor) sendEscalationStep(ctx context.Context, logger *slog.Logger, escalation *Escalation, policy *EscalationPolicy, user string, now time.Time) {
+	requestID := NewRequestID()
+	ctx = WithParentRequestID(WithRequestID(ctx, requestID), escalation.ID)
+	step := EscalationStep{User: user, RequestID: requestID, SentAt: now}
+
+	// the step is delivered immediately even if the original message was scheduled
+	message := escalation.Notification
+	message.User = user
+	message.Device = ""
+	message.SendAt = ""
+	resolvedMessage, tokenAlias, err := p.TokenVault.Resolve(message)
+	if err == nil {
+		logger.Info("Escalating the message to the next user.", "step", len(escalation.Steps)+1, "step_request_id", requestID)
+		var response = PushNotificationHandlingResponse{}
+		err = p.deliverMessage(ctx, logger.With("step_request_id", requestID), &response, message, resolvedMessage, tokenAlias, requestID)
 		switch {
-		case response.responseCode >= 100 && response.responseCode < 300: // success codes
-			// store the currnt limits into the cache
-			p.LimitsCounter.SetLimits(message.GetToken(), response.limits)
-			break
+		case err != nil:
+		case response.responseCode == http.StatusOK:
+			step.Receipt = getReceiptFromResponse(response.jsonResponseBody)
+		case response.responseCode != http.StatusAccepted:
+			err = fmt.Errorf("status code %d", response.responseCode)
+		}
+	}
+	escalation.EscalateAt = now.Add(policy.ackTimeout)
+	if err != nil {
+		// the next user is notified on the next processing
+		logger.Warn("Escalation step failed.", "step", len(escalation.Steps)+1, logKeyError, err)
+		step.Error = err.Error()
+		escalation.EscalateAt = now
+	}
+	escalation.Steps = append(escalation.Steps, step)
+	escalation.UpdatedAt = now
+	escalationSteps.Inc()
+}
 
-		case
-			response.responseCode == 500, // Internal Server Error
-			response.responseCode == 504, // Gateway Timeout
-			response.responseCode == 598, // Network Read Timeout
-			response.responseCode == 599: // Network Timeout
-			acceptRequestToQueue = true
-			break
+// posts the acknowledgement event of the escalation to its callback URL, the failed attempt is repeated with the doubling delay
+func (p *Processor) forwardCallback(logger *slog.Logger, escalation *Escalation, now time.Time) {
+	ctx, span := getTracer().Start(WithRequestID(context.Background(), escalation.ID), "Processor.forwardCallback", trace.WithAttributes(attribute.String(traceKeyRequestID, escalation.ID)))
+	defer span.End()
 
-		default: // all other failures
-			// always generate a status=0 response
-			response.jsonResponseBody = "{\"status\": 0 }"
-			break
+	event := &AcknowledgementEvent{
+		Event:          "acknowledged",
+		Request:        escalation.ID,
+		Receipt:        escalation.AcknowledgedReceipt,
+		AcknowledgedAt: escalation.AcknowledgedAt.Unix(),
+		AcknowledgedBy: escalation.AcknowledgedBy,
+		Title:          escalation.Notification.Title,
+		Message:        escalation.Notification.Message,
+	}
+	escalation.CallbackAttempts++
+	err := p.CallbackForwarder.ForwardCallback(ctx, escalation.Callback, event)
+	if err == nil {
+		escalation.CallbackDeliveredAt = now
+		escalation.CallbackError = ""
+		callbacksForwarded.Inc()
+		logger.Info("Acknowledgement forwarded to the callback.", logKeyAttempt, escalation.CallbackAttempts)
+		return
+	}
+	recordSpanError(span, err)
+	escalation.CallbackError = err.Error()
+	escalation.CallbackNextAttemptAt = now.Add(p.getRetryDelay(escalation.CallbackAttempts))
+	if escalation.CallbackAttempts >= maxCallbackAttempts {
+		callbacksFailed.Inc()
+		logger.Error("Forwarding of the acknowledgement to the callback failed permanently.", logKeyAttempt, escalation.CallbackAttempts, logKeyError, err)
+		return
+	}
+	logger.Warn("Forwarding of the acknowledgement to the callback failed temporarily.", logKeyAttempt, escalation.CallbackAttempts, logKeyError, err, "next_attempt_at", escalation.CallbackNextAttemptAt)
+}
+
+// stops the notifications of all the steps of the escalation, the failures are only logged
+func (p *Processor) cancelEscalationReceipts(ctx context.Context, logger *slog.Logger, escalation *Escalation) {
+	resolvedMessage, _, err := p.TokenVault.Resolve(escalation.Notification)
+	if err != nil {
+		logger.Error("Resolving of the escalation aliases failed, the receipts are not cancelled.", logKeyError, err)
+		return
+	}
+	for i := range escalation.Steps {
+		step := &escalation.Steps[i]
+		if step.Receipt == "" || step.Expired {
+			continue
+		}
+		err = p.ReceiptsChecker.CancelReceipt(ctx, resolvedMessage.Token, step.Receipt)
+		if err != nil {
+			logger.Warn("Cancelling of the receipt failed.", "step", i+1, logKeyError, err)
+			continue
+		}
+		step.Expired = true
+	}
+}
 
+// returns the receipt of the emergency message from the Pushover API response body, empty if not present
+func getReceiptFromResponse(responseBody string) string {
+	var response struct {
+		Receipt string `json:"receipt"`
+	}
+	json.Unmarshal([]byte(responseBody), &response)
+	return response.Receipt
+}
+
+// returns the quiet hours of the message user, nil if the user has none. The quiet hours configured for the alias apply also
+// to the messages sent with the user key and vice versa.
+func (p *Processor) getQuietHours(message PushNotification, resolvedMessage PushNotification) *QuietHours {
+	if quietHours, found := p.QuietHours[message.User]; found {
+		return quietHours
+	}
+	for user, quietHours := range p.QuietHours {
+		if p.TokenVault.ResolveUser(user) == resolvedMessage.User {
+			return quietHours
 		}
+	}
+	return nil
+}
+
+// stores the scheduled message (with aliases) into the queue and generates the 202 (Accepted) response. The message is delivered
+// by the queue processing at the scheduled time, it is displayed with the scheduled time unless the client passed the timestamp.
+func (p *Processor) scheduleMessage(ctx context.Context, logger *slog.Logger, response *PushNotificationHandlingResponse, message PushNotification, tokenAlias string, requestID string, sendAt time.Time) error {
+	ctx, span := getTracer().Start(ctx, "Processor.scheduleMessage")
+	defer span.End()
+
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+	if message.Timestamp == 0 {
+		message.Timestamp = sendAt.Unix()
+	}
+	queuedMessage := &QueuedMessage{
+		ID:            requestID,
+		ParentID:      GetParentRequestID(ctx),
+		Notification:  message,
+		TokenAlias:    tokenAlias,
+		AcceptedAt:    time.Now(),
+		ScheduledAt:   sendAt,
+		NextAttemptAt: sendAt,
+		ExpiresAt:     p.getExpirationTime(message, sendAt),
+		TraceContext:  injectTraceContext(ctx),
+	}
+	err := p.MessageRepository.Store(queuedMessage)
+	if err != nil {
+		logger.Error("Storing of the scheduled message into the queue failed.", logKeyError, err)
+		return recordSpanError(span, err)
+	}
+	messagesScheduled.Inc()
+	p.emitEvent(&MessageEvent{Type: messageEventQueued, Request: requestID, ParentRequest: queuedMessage.ParentID, TokenAlias: tokenAlias, user: message.User, Priority: message.Priority})
+
+	// return HTTP error 202 (Accepted)
+	response.responseCode = http.StatusAccepted
+	response.limits, _ = p.LimitsCounter.GetLimits(message.GetToken())
+	response.jsonResponseBody = fmt.Sprintf("{\"status\": 1, \"request\": \"%s\" }", requestID)
+	logger.Info("Message scheduled.", logKeyStatusCode, response.responseCode, "send_at", sendAt)
+	return nil
+}
+
+// stores the message (with aliases) into the queue and generates the 202 (Accepted) response
+func (p *Processor) queueMessage(ctx context.Context, logger *slog.Logger, response *PushNotificationHandlingResponse, message PushNotification, tokenAlias string, requestID string, lastError string) error {
+	ctx, span := getTracer().Start(ctx, "Processor.queueMessage")
+	defer span.End()
+
+	// the message is displayed with the time of the acceptance, not of the later delivery
+	now := time.Now()
+	if message.Timestamp == 0 {
+		message.Timestamp = now.Unix()
+	}
 
+	// keep the trace context, so that the later attempts can be linked to the request
+	queuedMessage := &QueuedMessage{
+		ID:            requestID,
+		ParentID:      GetParentRequestID(ctx),
+		Notification:  message,
+		TokenAlias:    tokenAlias,
+		AcceptedAt:    now,
+		NextAttemptAt: now.Add(p.getRetryDelay(1)),
+		ExpiresAt:     p.getExpirationTime(message, now),
+		TraceContext:  injectTraceContext(ctx),
+	}
+	queuedMessage.recordFailedAttempt(now, response.responseCode, lastError)
+	err := p.MessageRepository.Store(queuedMessage)
+	if err != nil {
+		logger.Error("Storing of the message into the queue failed.", logKeyError, err)
+		return recordSpanError(span, err)
+	}
+	messagesQueued.Inc()
+	p.emitEvent(&MessageEvent{Type: messageEventQueued, Request: requestID, ParentRequest: queuedMessage.ParentID, TokenAlias: tokenAlias, user: message.User, Priority: message.Priority, Attempt: 1, StatusCode: response.responseCode, Error: lastError})
+
+	// return HTTP error 202 (Accepted)
+	response.responseCode = http.StatusAccepted
+	response.jsonResponseBody = fmt.Sprintf("{\"status\": 1, \"request\": \"%s\" }", requestID)
+	logger.Info("Message accepted to the queue.", logKeyStatusCode, response.responseCode)
+	return nil
+}
+
+// SendDuplicatesSummary delivers the summary of the suppressed duplicates (see Deduplicator), the summary is not deduplicated
+func (p *Processor) SendDuplicatesSummary(summary PushNotification) {
+	requestID := NewRequestID()
+	ctx := WithRequestID(context.Background(), requestID)
+	ctx, span := getTracer().Start(ctx, "Processor.SendDuplicatesSummary", trace.WithAttributes(attribute.String(traceKeyRequestID, requestID)))
+	defer span.End()
+
+	// resolve the aliases again, the vault might have changed
+	resolvedSummary, tokenAlias, err := p.TokenVault.Resolve(summary)
+	logger := GetLogger(ctx).With(logKeyTokenAlias, tokenAlias)
+	if err != nil {
+		logger.Error("Resolving of the duplicates summary aliases failed.", logKeyError, recordSpanError(span, err))
+		return
+	}
+	logger.Info("Sending the summary of the suppressed duplicates.", "notification", summary.DumpToString())
+	var response = PushNotificationHandlingResponse{}
+	err = p.deliverMessage(ctx, logger, &response, summary, resolvedSummary, tokenAlias, requestID)
+	if err != nil {
+		logger.Error("Delivery of the duplicates summary failed.", logKeyError, err)
+	}
+}
+
+// Run starts the message processing loop, the queue is processed every RetryInterval. Returns after Stop is called.
+func (p *Processor) Run() {
+	slog.Info("Starting the queue processing.", "retry_interval", p.RetryInterval.String())
+	p.running.Store(true)
+	defer p.running.Store(false)
+
+	for {
+		// process the queued messages left from the previous run first, the due digests and escalations are sent (or queued) before
+		p.processDigests()
+		p.processEscalations()
+		nextAttemptAt := p.processQueue()
+
+		// wait for the retry interval or until the next attempt of a queued message (e.g. a scheduled one), whichever comes first
+		delay := p.RetryInterval
+		if !nextAttemptAt.IsZero() {
+			delay = min(delay, time.Until(nextAttemptAt))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-p.wakeUp:
+			timer.Stop()
+		}
+	}
+}
+
+// Stop stops the message processing loop
+func (p *Processor) Stop() {
+	close(p.stop)
+}
+
+// IsRunning returns true if the message processing loop is running
+func (p *Processor) IsRunning() bool {
+	return p.running.Load()
+}
+
+// GetUpstreamStatus returns the observed reachability of the Pushover API
+func (p *Processor) GetUpstreamStatus() UpstreamStatus {
+
+	// lock the mutex
+	p.upstreamStatusMutex.Lock()
+	defer p.upstreamStatusMutex.Unlock()
+
+	return p.upstreamStatus
+}
+
+// records the result of the Pushover API call, any response except for the server errors means the API is reachable
+func (p *Processor) recordUpstreamResult(responseErr error, responseCode int) {
+
+	// lock the mutex
+	p.upstreamStatusMutex.Lock()
+	defer p.upstreamStatusMutex.Unlock()
+
+	now := time.Now()
+	if responseErr == nil && responseCode > 0 && responseCode < 500 {
+		p.upstreamStatus.LastSuccessAt = now
+		pushoverLastSuccess.Set(float64(now.Unix()))
 	} else {
+		p.upstreamStatus.LastFailureAt = now
+	}
+}
 
-		// if the posting failed we assume the sender works fine (should be checked by the production tests), but connection cannot be made temporarily
-		log.Printf("PushNotificationsSender.PostPushNotificationMessage failed with error %s.", responseErr.Error())
+// WakeUp requests an immediate processing of the queue
+func (p *Processor) WakeUp() {
+	select {
+	case p.wakeUp <- struct{}{}:
+	default:
+		// the processing has been already requested
+	}
+}
 
-		acceptRequestToQueue = true
+// attempts to deliver all the queued messages, whose next attempt time passed, in the order by the priority and acceptance time.
+// The messages of the same priority are delivered to each user in the acceptance order, a message waiting for its next attempt
+// holds the later messages of the same user and priority, the scheduled messages do not hold the others until their delivery time.
+// Returns the earliest next attempt time of the messages not due yet, zero if there is none.
+func (p *Processor) processQueue() time.Time {
+	messages, err := p.MessageRepository.List()
+	if err != nil {
+		slog.Error("Listing of the queue failed.", logKeyError, err)
+		return time.Time{}
 	}
 
-	// if the message should be accepted to queue
-	if acceptRequestToQueue {
+	now := time.Now()
+	var nextAttemptAt time.Time
+	heldUsers := make(map[string]bool)
+	for _, queuedMessage := range messages {
+		userKey := fmt.Sprintf("%d/%s", queuedMessage.Notification.Priority, queuedMessage.Notification.User)
+		if heldUsers[userKey] {
+			continue
+		}
+
+		// if the Pushover API is not reachable, there is no point in trying the remaining messages
+		delivered, reachable := p.deliverDueMessage(queuedMessage.ID)
+		if !reachable {
+			break
+		}
+		if delivered {
+			continue
+		}
+		notDue := queuedMessage.NextAttemptAt.After(now)
+		if notDue && (nextAttemptAt.IsZero() || queuedMessage.NextAttemptAt.Before(nextAttemptAt)) {
+			nextAttemptAt = queuedMessage.NextAttemptAt
+		}
+		if !notDue || !queuedMessage.isPendingSchedule() {
+			heldUsers[userKey] = true
+		}
+	}
+	return nextAttemptAt
+}
 
-		// decrement the limits for the current message
-		err := p.LimitsCounter.DecrementLimits(message.GetToken())
+// attempts to deliver the queued message if its next attempt time passed. The message is reloaded under the queue lock, because
+// the administrator might have changed it since the listing. Returns whether the message left the queue and whether the Pushover
+// API could be reached.
+func (p *Processor) deliverDueMessage(id string) (dequeued bool, reachable bool) {
 
-		// if succeeded
-		if err == nil {
+	// lock the mutex, the notifications about the dead letters are sent after unlocking it
+	defer p.sendDeadLetterNotifications()
+	p.queueMutex.Lock()
+	defer p.queueMutex.Unlock()
 
-			// TODO: queing of the message and trying later should be done here!
+	queuedMessage, err := p.MessageRepository.Get(id)
+	if err != nil {
+		slog.Error("Reading of the queued message failed.", logKeyRequestID, id, logKeyError, err)
+		return false, true
+	}
+	if queuedMessage == nil {
+		return false, true
+	}
 
-			// return HTTP error 202 (Accepted)
-			responseErr = nil
-			response.responseCode = http.StatusAccepted
-			response.limits, _ = p.LimitsCounter.GetLimits(message.GetToken())
-			response.jsonResponseBody = "{\"status\": 1 }"
+	// the expired message is not delivered even if its attempt is not due yet
+	now := time.Now()
+	if !queuedMessage.ExpiresAt.IsZero() && !now.Before(queuedMessage.ExpiresAt) {
+		logger := slog.With(logKeyRequestID, queuedMessage.ID, logKeyTokenAlias, queuedMessage.TokenAlias)
+		messagesExpired.Inc()
+		p.moveToDeadLetters(logger, queuedMessage, deadLetterStateExpired, fmt.Sprintf("expired at %s", queuedMessage.ExpiresAt.Format(time.RFC3339)))
+		return true, true
+	}
+	if queuedMessage.NextAttemptAt.After(now) {
+		return false, true
+	}
+	return p.deliverQueuedMessage(queuedMessage)
+}
 
-		} else {
-			// return the not permited reponse
-			response.responseCode = http.StatusForbidden
-			response.limits, _ = p.LimitsCounter.GetLimits(message.GetToken())
-			response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"errors\": [\"%s\"] }", err.Error())
+// returns the time after which the message should not be delivered, zero if the message does not expire. The expiration given by the
+// message takes precedence over the maximal queue age of its priority.
+func (p *Processor) getExpirationTime(message PushNotification, acceptedAt time.Time) time.Time {
+	if message.BrokerExpire > 0 {
+		return acceptedAt.Add(time.Duration(message.BrokerExpire) * time.Second)
+	}
+	if maxQueueAge, found := p.MaxQueueAge[message.Priority]; found && maxQueueAge > 0 {
+		return acceptedAt.Add(maxQueueAge)
+	}
+	return time.Time{}
+}
+
+// attempts to deliver the queued message and updates the queue. Returns whether the message left the queue and whether the Pushover
+// API could be reached.
+func (p *Processor) deliverQueuedMessage(queuedMessage *QueuedMessage) (dequeued bool, reachable bool) {
+	attempt := queuedMessage.Attempts + 1
+	logger := slog.With(logKeyRequestID, queuedMessage.ID, logKeyTokenAlias, queuedMessage.TokenAlias, logKeyAttempt, attempt)
+
+	// every attempt is a new trace linked to the trace of the request accepting the message
+	ctx, span := getTracer().Start(context.Background(), "Processor.deliverQueuedMessage",
+		trace.WithLinks(trace.Link{SpanContext: extractSpanContext(queuedMessage.TraceContext)}),
+		trace.WithAttributes(attribute.String(traceKeyRequestID, queuedMessage.ID), attribute.String(traceKeyTokenAlias, queuedMessage.TokenAlias), attribute.Int(traceKeyAttempt, attempt)))
+	defer span.End()
+	ctx = WithRequestID(ctx, queuedMessage.ID)
+	if queuedMessage.ParentID != "" {
+		ctx = WithParentRequestID(ctx, queuedMessage.ParentID)
+	}
+
+	// resolve the aliases, the vault might have changed since the acceptance
+	resolvedMessage, _, err := p.TokenVault.Resolve(queuedMessage.Notification)
+	if err != nil {
+		logger.Error("Resolving of the token and user aliases of the queued message failed, the message failed permanently.", logKeyError, err)
+		recordSpanError(span, err)
+		messagesFailed.Inc()
+		queuedMessage.recordFailedAttempt(time.Now(), 0, err.Error())
+		p.moveToDeadLetters(logger, queuedMessage, deadLetterStateFailed, err.Error())
+		return true, true
+	}
+
+	// the quiet hours of the user apply also to the retries and to the scheduled messages coming due
+	if quietHours := p.getQuietHours(queuedMessage.Notification, resolvedMessage); quietHours != nil && queuedMessage.Notification.Priority < priorityEmergency {
+		if quietUntil := quietHours.GetEnd(time.Now()); !quietUntil.IsZero() {
+			if quietHours.action == quietHoursActionDowngrade {
+				logger.Info("Queued message downgraded during the quiet hours of the user.", "quiet_until", quietUntil)
+				queuedMessage.Notification.Priority = min(queuedMessage.Notification.Priority, priorityLow)
+				resolvedMessage.Priority = queuedMessage.Notification.Priority
+			} else {
+				// the message keeps its timestamp, so it is displayed with the time it was meant to be delivered
+				logger.Info("Queued message deferred until the end of the quiet hours of the user.", "quiet_until", quietUntil)
+				queuedMessage.NextAttemptAt = quietUntil
+				err = p.MessageRepository.Store(queuedMessage)
+				if err != nil {
+					logger.Error("Updating of the queued message failed.", logKeyError, err)
+				}
+				return false, true
+			}
+		}
+	}
+
+	// repeat the delivery (or deliver the scheduled message for the first time)
+	if queuedMessage.Attempts > 0 {
+		messagesRetried.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventRetried, Request: queuedMessage.ID, ParentRequest: queuedMessage.ParentID, TokenAlias: queuedMessage.TokenAlias, user: queuedMessage.Notification.User, Priority: queuedMessage.Notification.Priority, Attempt: attempt})
+	}
+	var response = PushNotificationHandlingResponse{}
+	responseErr := p.PushNotificationsSender.PostPushNotificationMessage(ctx, &response, resolvedMessage)
+	p.recordUpstreamResult(responseErr, response.responseCode)
+
+	switch classifyDeliveryResult(responseErr, response.responseCode) {
+	case deliverySucceeded:
+		logger.Info("Queued message delivered to the Pushover API.", logKeyStatusCode, response.responseCode)
+		messagesDelivered.Inc()
+		p.emitEvent(&MessageEvent{Type: messageEventDelivered, Request: queuedMessage.ID, ParentRequest: queuedMessage.ParentID, TokenAlias: queuedMessage.TokenAlias, user: queuedMessage.Notification.User, Priority: queuedMessage.Notification.Priority, Attempt: attempt, StatusCode: response.responseCode})
+		p.setLimits(resolvedMessage.GetToken(), queuedMessage.TokenAlias, response.limits)
+		p.removeQueuedMessage(logger, queuedMessage)
+		if requiresReceiptTracking(queuedMessage.Notification) {
+			p.trackEscalation(logger, queuedMessage.Notification, queuedMessage.TokenAlias, queuedMessage.ID, queuedMessage.ParentID, response.jsonResponseBody)
 		}
+		return true, true
+
+	case deliveryPermanentFailure:
+		span.SetStatus(codes.Error, "the queued message was rejected by the Pushover API")
+		logger.Error("Queued message rejected by the Pushover API, the message failed permanently.", logKeyStatusCode, response.responseCode, "body", response.jsonResponseBody)
+		finalError := fmt.Sprintf("status code %d, response %s", response.responseCode, response.jsonResponseBody)
+		messagesFailed.Inc()
+		queuedMessage.recordFailedAttempt(time.Now(), response.responseCode, finalError)
+		p.moveToDeadLetters(logger, queuedMessage, deadLetterStateFailed, finalError)
+		return true, true
 	}
 
-	return responseErr
+	// keep the message in the queue and schedule the next attempt
+	lastError := fmt.Sprintf("status code %d", response.responseCode)
+	if responseErr != nil {
+		lastError = responseErr.Error()
+	}
+	now := time.Now()
+	queuedMessage.recordFailedAttempt(now, response.responseCode, lastError)
+	queuedMessage.NextAttemptAt = now.Add(p.getRetryDelay(attempt))
+	span.SetStatus(codes.Error, queuedMessage.LastError)
+	logger.Warn("Delivery of the queued message failed temporarily.", logKeyStatusCode, response.responseCode, logKeyError, queuedMessage.LastError, "next_attempt_at", queuedMessage.NextAttemptAt)
+	err = p.MessageRepository.Store(queuedMessage)
+	if err != nil {
+		logger.Error("Updating of the queued message failed.", logKeyError, err)
+	}
+	return false, responseErr == nil
 }
 
-// Run starts the message processing loop
-func (p *Processor) Run() {
-	log.Print("Not Process::Run has not been implemented yet")
+// moves the permanently failed or expired message from the queue to the dead letters, the administrator is notified after the queue
+// lock is released. If the dead letter cannot be stored, the message stays in the queue, so that it is not lost. The queue lock has
+// to be held.
+func (p *Processor) moveToDeadLetters(logger *slog.Logger, queuedMessage *QueuedMessage, state string, finalError string) {
+	now := time.Now()
+	if p.DeadLetterRepository == nil {
+		logger.Warn("No dead letter store, dropping the failed message.")
+		p.removeQueuedMessage(logger, queuedMessage)
+		p.emitDeadLetterEvent(queuedMessage, state, finalError)
+		return
+	}
+
+	deadLetter := &DeadLetter{QueuedMessage: *queuedMessage, State: state, FailedAt: now, FinalError: finalError}
+	err := p.DeadLetterRepository.Store(deadLetter)
+	if err != nil {
+		logger.Error("Storing of the dead letter failed, keeping the message in the queue.", logKeyError, err)
+		queuedMessage.NextAttemptAt = now.Add(p.getRetryDelay(queuedMessage.Attempts))
+		err = p.MessageRepository.Store(queuedMessage)
+		if err != nil {
+			logger.Error("Updating of the queued message failed.", logKeyError, err)
+		}
+		return
+	}
+	p.removeQueuedMessage(logger, queuedMessage)
+	logger.Warn("Message moved to the dead letters.", "state", state, "final_error", finalError)
+	p.emitDeadLetterEvent(queuedMessage, state, finalError)
+	if p.DeadLetterNotification != nil {
+		p.deadLetterNotifications = append(p.deadLetterNotifications, deadLetter)
+	}
+}
+
+// sends the notifications about the new dead letters to the administrator, the queue lock must not be held
+func (p *Processor) sendDeadLetterNotifications() {
+
+	// lock the mutex only to take the pending notifications
+	p.queueMutex.Lock()
+	deadLetters := p.deadLetterNotifications
+	p.deadLetterNotifications = nil
+	p.queueMutex.Unlock()
+
+	for _, deadLetter := range deadLetters {
+		logger := slog.With(logKeyRequestID, deadLetter.ID, logKeyTokenAlias, deadLetter.TokenAlias)
+		p.notifyDeadLetter(WithRequestID(context.Background(), deadLetter.ID), logger, deadLetter)
+	}
+}
+
+// sends the notification about the dead letter to the administrator, the notification is not queued on failure
+func (p *Processor) notifyDeadLetter(ctx context.Context, logger *slog.Logger, deadLetter *DeadLetter) {
+	notification := *p.DeadLetterNotification
+	notification.Message = fmt.Sprintf("Message %s (token %s) %s after %d attempts: %s", deadLetter.ID, getTokenMetricsLabel(deadLetter.TokenAlias, deadLetter.Notification.Token), deadLetter.State, deadLetter.Attempts, deadLetter.FinalError)
+	resolvedNotification, _, err := p.TokenVault.Resolve(notification)
+	if err != nil {
+		logger.Error("Resolving of the dead letter notification aliases failed.", logKeyError, err)
+		return
+	}
+	var response = PushNotificationHandlingResponse{}
+	err = p.PushNotificationsSender.PostPushNotificationMessage(ctx, &response, resolvedNotification)
+	if err != nil || classifyDeliveryResult(err, response.responseCode) != deliverySucceeded {
+		logger.Error("Sending of the dead letter notification failed.", logKeyStatusCode, response.responseCode, logKeyError, err)
+	}
+}
+
+// emits the failed or expired event of the message leaving the queue in the dead letter state
+func (p *Processor) emitDeadLetterEvent(queuedMessage *QueuedMessage, state string, finalError string) {
+	event := &MessageEvent{Type: messageEventExpired, Request: queuedMessage.ID, ParentRequest: queuedMessage.ParentID, TokenAlias: queuedMessage.TokenAlias, user: queuedMessage.Notification.User, Priority: queuedMessage.Notification.Priority, Attempt: queuedMessage.Attempts, Error: finalError}
+	if state == deadLetterStateFailed {
+		event.Type = messageEventFailed
+		if len(queuedMessage.History) > 0 {
+			event.StatusCode = queuedMessage.History[len(queuedMessage.History)-1].StatusCode
+		}
+	}
+	p.emitEvent(event)
+}
+
+// sends the lifecycle event of the message to all the listeners
+func (p *Processor) emitEvent(event *MessageEvent) {
+	if len(p.EventListeners) == 0 {
+		return
+	}
+	event.ID = NewRequestID()
+	event.At = time.Now()
+	event.User = RedactSecret(event.user)
+	for _, listener := range p.EventListeners {
+		listener.HandleEvent(event)
+	}
+}
+
+// removes the message from the queue and logs the failure
+func (p *Processor) removeQueuedMessage(logger *slog.Logger, queuedMessage *QueuedMessage) {
+	err := p.MessageRepository.Remove(queuedMessage.ID)
+	if err != nil {
+		logger.Error("Removing of the message from the queue failed.", logKeyError, err)
+	}
+}
+
+// returns the delay before the next attempt after the given number of the attempts
+func (p *Processor) getRetryDelay(attempts int) time.Duration {
+	return getDoublingDelay(p.RetryInterval, p.MaxRetryDelay, attempts)
+}
+
+// returns the interval doubled with every attempt after the first one up to the maximal delay
+func getDoublingDelay(interval time.Duration, maxDelay time.Duration, attempts int) time.Duration {
+	delay := interval
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// stores the limits obtained from the Pushover API into the cache and the metrics
+func (p *Processor) setLimits(token string, tokenAlias string, limits *Limits) {
+	if limits == nil {
+		return
+	}
+	p.LimitsCounter.SetLimits(token, limits)
+	p.updateLimitsMetrics(tokenAlias, token, limits)
+}
+
+// updates the remaining limits metrics of the token
+func (p *Processor) updateLimitsMetrics(tokenAlias string, token string, limits *Limits) {
+	if limits != nil {
+		limitsRemaining.WithLabelValues(getTokenMetricsLabel(tokenAlias, token)).Set(float64(limits.remaining))
+	}
+}
+
+// ErrMessageNotFound is returned by the queue administration if the message is not present in the queue (or in the dead letters)
+var ErrMessageNotFound = errors.New("the message is not present in the queue")
+
+// ErrDeadLettersNotStored is returned by the dead letters administration if the processor has no dead letter store
+var ErrDeadLettersNotStored = errors.New("the dead letters are not stored")
+
+// ErrEscalationNotFound is returned by the escalation administration if the escalation is not present or not active
+var ErrEscalationNotFound = errors.New("the escalation is not present or not active")
+
+// RetryQueuedMessage schedules an immediate delivery attempt of the queued message
+func (p *Processor) RetryQueuedMessage(id string) error {
+
+	// lock the mutex
+	p.queueMutex.Lock()
+	defer p.queueMutex.Unlock()
+
+	queuedMessage, err := p.MessageRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if queuedMessage == nil {
+		return ErrMessageNotFound
+	}
+	queuedMessage.NextAttemptAt = time.Now()
+	err = p.MessageRepository.Store(queuedMessage)
+	if err == nil {
+		p.WakeUp()
+	}
+	return err
+}
+
+// ReplayDeadLetter returns the dead letter to the queue and schedules an immediate delivery attempt, the attempt history is kept
+// and the message does not expire any more
+func (p *Processor) ReplayDeadLetter(id string) error {
+
+	// lock the mutex
+	p.queueMutex.Lock()
+	defer p.queueMutex.Unlock()
+
+	if p.DeadLetterRepository == nil {
+		return ErrDeadLettersNotStored
+	}
+	deadLetter, err := p.DeadLetterRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if deadLetter == nil {
+		return ErrMessageNotFound
+	}
+	queuedMessage := deadLetter.QueuedMessage
+	queuedMessage.NextAttemptAt = time.Now()
+	queuedMessage.ExpiresAt = time.Time{}
+	err = p.MessageRepository.Store(&queuedMessage)
+	if err != nil {
+		return err
+	}
+	err = p.DeadLetterRepository.Remove(id)
+	if err == nil {
+		p.WakeUp()
+	}
+	return err
+}
+
+// CancelScheduledMessage removes the scheduled message from the queue, the messages whose delivery has been already attempted
+// are not cancelled
+func (p *Processor) CancelScheduledMessage(id string) error {
+
+	// lock the mutex
+	p.queueMutex.Lock()
+	defer p.queueMutex.Unlock()
+
+	queuedMessage, err := p.MessageRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if queuedMessage == nil || !queuedMessage.isPendingSchedule() {
+		return ErrMessageNotFound
+	}
+	return p.MessageRepository.Remove(id)
+}
+
+// DeleteQueuedMessage removes the message from the queue
+func (p *Processor) DeleteQueuedMessage(id string) error {
+
+	// lock the mutex
+	p.queueMutex.Lock()
+	defer p.queueMutex.Unlock()
+
+	queuedMessage, err := p.MessageRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if queuedMessage == nil {
+		return ErrMessageNotFound
+	}
+	return p.MessageRepository.Remove(id)
+}
+
+// CancelEscalation stops the active escalation, the notifications of its steps are cancelled and no further users are notified
+func (p *Processor) CancelEscalation(id string) error {
+	if p.EscalationRepository == nil {
+		return ErrEscalationNotFound
+	}
+
+	escalation, err := p.storeEscalationCancellation(id)
+	if err != nil {
+		return err
+	}
+
+	// the notifications are cancelled without holding the lock
+	logger := slog.With(logKeyRequestID, escalation.ID, logKeyTokenAlias, escalation.TokenAlias, "escalation", escalation.Policy)
+	p.cancelEscalationReceipts(context.Background(), logger, escalation)
+	p.storeEscalationChanges(logger, escalation)
+	return nil
+}
+
+// marks the active escalation as cancelled and returns it
+func (p *Processor) storeEscalationCancellation(id string) (*Escalation, error) {
+
+	// lock the mutex
+	p.escalationMutex.Lock()
+	defer p.escalationMutex.Unlock()
+
+	escalation, err := p.EscalationRepository.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if escalation == nil || escalation.State != escalationStateActive {
+		return nil, ErrEscalationNotFound
+	}
+	escalation.State = escalationStateCancelled
+	escalation.UpdatedAt = time.Now()
+	err = p.EscalationRepository.Store(escalation)
+	if err != nil {
+		return nil, err
+	}
+	return escalation, nil
 }
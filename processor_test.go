@@ -1,12 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// creates a new message repository in a temporary directory
+func newTestMessageRepository(t *testing.T) *MessageRepositoryImpl {
+	messageRepository, err := NewMessageRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Message repository creation failed with error %s.", err)
+	}
+	return messageRepository
+}
+
 // TestShouldSendMessageToPushNotificationsSender tests whether the processor attempts to send all the incomming messages to Pushover connector
 func TestShouldSendMessageToPushNotificationsSender(t *testing.T) {
 
@@ -14,7 +28,7 @@ func TestShouldSendMessageToPushNotificationsSender(t *testing.T) {
 
 	// The REST API server is initialized and connected to the message handler mock
 	pcm := NewPushNotificationsSenderMock()
-	processor := NewProcessor(pcm, NewLimitsCounterImpl())
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
 
 	// start the processor
 	go processor.Run()
@@ -25,7 +39,7 @@ func TestShouldSendMessageToPushNotificationsSender(t *testing.T) {
 	testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: ""}
 
 	var response = PushNotificationHandlingResponse{}
-	err := processor.HandleMessage(&response, testMessage)
+	err := processor.HandleMessage(context.Background(), &response, testMessage)
 
 	// **** THEN ****
 
@@ -62,7 +76,7 @@ func TestShouldPropagateSuccessOrPermanentFailureResponses(t *testing.T) {
 
 	// The REST API server is initialized and connected to the message handler mock
 	pcm := NewPushNotificationsSenderMock()
-	processor := NewProcessor(pcm, NewLimitsCounterImpl())
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
 
 	testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: ""}
 
@@ -80,7 +94,7 @@ func TestShouldPropagateSuccessOrPermanentFailureResponses(t *testing.T) {
 
 			// a push notification is obtained by the process (via IncommingPushNotificationMessageHandler interface method HandleMessage())
 			var response = PushNotificationHandlingResponse{}
-			err := processor.HandleMessage(&response, testMessage)
+			err := processor.HandleMessage(context.Background(), &response, testMessage)
 
 			// **** THEN ****
 
@@ -100,7 +114,7 @@ func TestShouldPropagateSuccessOrPermanentFailureResponses(t *testing.T) {
 			// if the limits match the expected limits
 			if response.limits != tc.responseLimits {
 
-				t.Errorf("Returned limits %s don't match the expected value %s.", response.limits, tc.responseLimits)
+				t.Errorf("Returned limits %v don't match the expected value %v.", response.limits, tc.responseLimits)
 			}
 
 			// get the content of the body
@@ -134,7 +148,10 @@ func TestShouldReturn202AcceptedOnTemporaryFailure(t *testing.T) {
 		responseLimits     *Limits
 	}{
 		{"ShouldReturn202OnPostError", errors.New("post error"), 0, nil},
+		{"ShouldReturn202OnTooManyRequests429", nil, 429, nil},
 		{"ShouldReturn202OnInternalServerError", nil, 500, nil},
+		{"ShouldReturn202OnBadGateway502", nil, 502, nil},
+		{"ShouldReturn202OnServiceUnavailable503", nil, 503, nil},
 		{"ShouldReturn202OnGatewayTimeOut504", nil, 504, nil},
 		{"ShouldReturn202OnNetworkReadTimeOut598", nil, 598, nil},
 		{"ShouldReturn202OnNetworkTimeOut599", nil, 599, nil},
@@ -143,7 +160,7 @@ func TestShouldReturn202AcceptedOnTemporaryFailure(t *testing.T) {
 
 	// The REST API server is initialized and connected to the message handler mock
 	pcm := NewPushNotificationsSenderMock()
-	processor := NewProcessor(pcm, NewLimitsCounterImpl())
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
 
 	testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: ""}
 
@@ -161,7 +178,7 @@ func TestShouldReturn202AcceptedOnTemporaryFailure(t *testing.T) {
 
 			// a push notification is obtained by the process (via IncommingPushNotificationMessageHandler interface method HandleMessage())
 			var response = PushNotificationHandlingResponse{}
-			err := processor.HandleMessage(&response, testMessage)
+			err := processor.HandleMessage(context.Background(), &response, testMessage)
 
 			// **** THEN ****
 
@@ -181,7 +198,1162 @@ func TestShouldReturn202AcceptedOnTemporaryFailure(t *testing.T) {
 			// if the limits match the expected limits
 			if response.limits != tc.responseLimits {
 
-				t.Errorf("Returned limits %s don't match the expected value %s.", response.limits, tc.responseLimits)
+				t.Errorf("Returned limits %v don't match the expected value %v.", response.limits, tc.responseLimits)
+			}
+		})
+	}
+}
+
+// TestShouldSendResolvedAliasesToPushNotificationsSender tests whether the processor replaces the aliases by the real values from the vault
+func TestShouldSendResolvedAliasesToPushNotificationsSender(t *testing.T) {
+
+	// **** GIVEN ****
+
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.TokenVault = NewTokenVault(map[string]string{"backup": "<real token>"}, map[string]string{"martin": "<real user>"}, nil, true)
+
+	// **** WHEN ****
+
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(context.Background(), &response, PushNotification{Token: "backup", User: "martin", Message: "<dummy message>"})
+
+	var rejectedResponse = PushNotificationHandlingResponse{}
+	rejectedErr := processor.HandleMessage(context.Background(), &rejectedResponse, PushNotification{Token: "unknown", User: "martin", Message: "<dummy message>"})
+
+	// **** THEN ****
+
+	if err != nil || rejectedErr != nil {
+		t.Errorf("Handling of the messages failed with errors %v and %v.", err, rejectedErr)
+		return
+	}
+
+	// the sender receives the real values only for the known aliases
+	pcm.AssertMessageAcceptedOnce(t, PushNotification{Token: "<real token>", User: "<real user>", Message: "<dummy message>"})
+	if rejectedResponse.responseCode != 400 {
+		t.Errorf("The message with unknown token returned response code %d, expected 400.", rejectedResponse.responseCode)
+	}
+}
+
+// TestShouldDeliverQueuedMessages tests whether the processor queues the temporarily failed messages and repeats their delivery
+func TestShouldDeliverQueuedMessages(t *testing.T) {
+
+	var testcases = []struct {
+		id                    string
+		retryResponseErr      error
+		retryResponseCode     int
+		expectedQueued        bool
+		expectedDeadLetter    bool
+		expectedDeliveredDiff float64
+		expectedFailedDiff    float64
+	}{
+		{"ShouldRemoveDeliveredMessage", nil, 200, false, false, 1, 0},
+		{"ShouldKeepMessageOnTemporaryFailure", errors.New("still offline"), 0, true, false, 0, 0},
+		{"ShouldMoveRejectedMessageToDeadLetters", nil, 400, false, true, 0, 1},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			// the message is accepted to the queue while offline
+			pcm := NewPushNotificationsSenderMock()
+			messageRepository := newTestMessageRepository(t)
+			deadLetterRepository := newTestDeadLetterRepository(t)
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+			processor.DeadLetterRepository = deadLetterRepository
+			processor.RetryInterval = 0
+			testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"}
+
+			pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+			var response = PushNotificationHandlingResponse{}
+			err := processor.HandleMessage(WithRequestID(context.Background(), "queuedrequest"), &response, testMessage)
+			if err != nil || response.responseCode != 202 {
+				t.Fatalf("Handling of the message returned error %v and response code %d, expected 202.", err, response.responseCode)
+			}
+
+			// the message is delivered with the time of the acceptance
+			acceptedMessage, err := messageRepository.Get("queuedrequest")
+			if err != nil || acceptedMessage == nil {
+				t.Fatalf("Reading of the queued message returned %v and error %v.", acceptedMessage, err)
+			}
+			expectedMessage := testMessage
+			expectedMessage.Timestamp = acceptedMessage.AcceptedAt.Unix()
+			retriedBefore := testutil.ToFloat64(messagesRetried)
+			deliveredBefore := testutil.ToFloat64(messagesDelivered)
+			failedBefore := testutil.ToFloat64(messagesFailed)
+
+			// **** WHEN ****
+
+			pcm.ForceResponse(tc.retryResponseErr, tc.retryResponseCode, nil, "")
+			processor.processQueue()
+
+			// **** THEN ****
+
+			pcm.AssertMessageAcceptedOnce(t, expectedMessage)
+			queuedMessage, err := messageRepository.Get("queuedrequest")
+			if err != nil {
+				t.Fatalf("Reading of the queue failed with error %s.", err)
+			}
+			if (queuedMessage != nil) != tc.expectedQueued {
+				t.Errorf("Message queued after the retry is %t, expected %t.", queuedMessage != nil, tc.expectedQueued)
+			}
+			if queuedMessage != nil && queuedMessage.Attempts != 2 {
+				t.Errorf("Queued message has %d attempts, expected 2.", queuedMessage.Attempts)
+			}
+			if queuedMessage != nil && len(queuedMessage.History) != 2 {
+				t.Errorf("Queued message has %d attempt results, expected 2.", len(queuedMessage.History))
+			}
+			deadLetter, err := deadLetterRepository.Get("queuedrequest")
+			if err != nil {
+				t.Fatalf("Reading of the dead letters failed with error %s.", err)
+			}
+			if (deadLetter != nil) != tc.expectedDeadLetter {
+				t.Errorf("Dead letter stored after the retry is %t, expected %t.", deadLetter != nil, tc.expectedDeadLetter)
+			}
+			if deadLetter != nil && (len(deadLetter.History) != 2 || deadLetter.History[1].StatusCode != tc.retryResponseCode || deadLetter.FinalError == "") {
+				t.Errorf("Dead letter %v does not keep the attempt results.", deadLetter)
+			}
+			if diff := testutil.ToFloat64(messagesRetried) - retriedBefore; diff != 1 {
+				t.Errorf("Retried messages counter increased by %f, expected 1.", diff)
+			}
+			if diff := testutil.ToFloat64(messagesDelivered) - deliveredBefore; diff != tc.expectedDeliveredDiff {
+				t.Errorf("Delivered messages counter increased by %f, expected %f.", diff, tc.expectedDeliveredDiff)
+			}
+			if diff := testutil.ToFloat64(messagesFailed) - failedBefore; diff != tc.expectedFailedDiff {
+				t.Errorf("Failed messages counter increased by %f, expected %f.", diff, tc.expectedFailedDiff)
+			}
+		})
+	}
+}
+
+// TestShouldDoubleRetryDelay tests the exponential back-off of the queued messages
+func TestShouldDoubleRetryDelay(t *testing.T) {
+
+	// GIVEN
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.RetryInterval = 30 * time.Second
+	processor.MaxRetryDelay = 2 * time.Minute
+
+	// WHEN
+	delays := []time.Duration{processor.getRetryDelay(1), processor.getRetryDelay(2), processor.getRetryDelay(3), processor.getRetryDelay(10)}
+
+	// THEN
+	expectedDelays := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute}
+	for i := range delays {
+		if delays[i] != expectedDelays[i] {
+			t.Errorf("Delay %s after %d attempts, expected %s.", delays[i], i+1, expectedDelays[i])
+		}
+	}
+}
+
+// TestShouldNotifyAdministratorAboutDeadLetter tests whether the administrator is notified when a message is moved to the dead letters
+func TestShouldNotifyAdministratorAboutDeadLetter(t *testing.T) {
+
+	// GIVEN
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.DeadLetterRepository = newTestDeadLetterRepository(t)
+	processor.TokenVault = NewTokenVault(map[string]string{"broker": "<broker token>"}, map[string]string{"admin": "<admin user>"}, nil, false)
+	processor.DeadLetterNotification = &PushNotification{Token: "broker", User: "admin"}
+	processor.RetryInterval = 0
+
+	pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+	var response = PushNotificationHandlingResponse{}
+	processor.HandleMessage(WithRequestID(context.Background(), "deadrequest"), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"})
+
+	// WHEN
+	pcm.ForceResponse(nil, 400, nil, "{\"user\":\"invalid\",\"status\":0}")
+	pcm.onPost = func() {
+		if pcm.notification.User != "<admin user>" {
+			return
+		}
+		if !processor.queueMutex.TryLock() {
+			t.Error("The dead letter notification was sent while holding the queue lock.")
+			return
+		}
+		processor.queueMutex.Unlock()
+	}
+	processor.processQueue()
+
+	// THEN
+	if pcm.handleMessageCalled != 2 {
+		t.Fatalf("%d messages sent after the rejection, expected the retry and the notification.", pcm.handleMessageCalled)
+	}
+	if pcm.notification.Token != "<broker token>" || pcm.notification.User != "<admin user>" || !strings.Contains(pcm.notification.Message, "deadrequest") {
+		t.Errorf("Notification %v sent, expected the dead letter notification to the administrator.", pcm.notification)
+	}
+}
+
+// TestShouldExpireQueuedMessages tests whether the queued messages are moved to the dead letters instead of the delivery after their expiration
+func TestShouldExpireQueuedMessages(t *testing.T) {
+
+	var testcases = []struct {
+		id              string
+		priority        int
+		brokerExpire    int
+		maxQueueAge     map[int]time.Duration
+		age             time.Duration
+		expectedExpired bool
+	}{
+		{"ShouldNotExpireWithoutExpiration", 0, 0, nil, 72 * time.Hour, false},
+		{"ShouldExpireByBrokerExpire", 0, 60, nil, 2 * time.Minute, true},
+		{"ShouldNotExpireBeforeBrokerExpire", 0, 600, nil, 2 * time.Minute, false},
+		{"ShouldExpireByPriorityMaxQueueAge", -1, 0, map[int]time.Duration{-1: time.Hour}, 2 * time.Hour, true},
+		{"ShouldNotExpireOtherPriority", 1, 0, map[int]time.Duration{-1: time.Hour}, 2 * time.Hour, false},
+		{"ShouldPreferBrokerExpire", -1, 3 * 3600, map[int]time.Duration{-1: time.Hour}, 2 * time.Hour, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+
+			// the message was accepted to the queue the given time ago
+			pcm := NewPushNotificationsSenderMock()
+			messageRepository := newTestMessageRepository(t)
+			deadLetterRepository := newTestDeadLetterRepository(t)
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+			processor.DeadLetterRepository = deadLetterRepository
+			processor.MaxQueueAge = tc.maxQueueAge
+			processor.RetryInterval = 0
+			testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "backup finished", Priority: tc.priority, BrokerExpire: tc.brokerExpire}
+
+			pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+			var response = PushNotificationHandlingResponse{}
+			processor.HandleMessage(WithRequestID(context.Background(), "expiringrequest"), &response, testMessage)
+			queuedMessage, _ := messageRepository.Get("expiringrequest")
+			queuedMessage.ExpiresAt = processor.getExpirationTime(testMessage, time.Now().Add(-tc.age))
+			messageRepository.Store(queuedMessage)
+
+			// WHEN
+			pcm.ForceResponse(nil, 200, nil, "")
+			processor.processQueue()
+
+			// THEN
+			deadLetter, err := deadLetterRepository.Get("expiringrequest")
+			if err != nil {
+				t.Fatalf("Reading of the dead letters failed with error %s.", err)
+			}
+			if (deadLetter != nil) != tc.expectedExpired {
+				t.Fatalf("Message expired %t, expected %t.", deadLetter != nil, tc.expectedExpired)
+			}
+			if deadLetter != nil && deadLetter.State != deadLetterStateExpired {
+				t.Errorf("Dead letter in state %s, expected %s.", deadLetter.State, deadLetterStateExpired)
+			}
+			if tc.expectedExpired && pcm.handleMessageCalled != 0 {
+				t.Errorf("Expired message was sent %d times after the expiration, expected none.", pcm.handleMessageCalled)
+			}
+		})
+	}
+}
+
+// TestShouldDeliverQueuedMessagesByPriority tests whether the queue is delivered by the priority and in the acceptance order per user
+func TestShouldDeliverQueuedMessagesByPriority(t *testing.T) {
+
+	// GIVEN
+
+	// the messages of various priorities and users are queued, the normal priority message m2 of user A is not due yet
+	pcm := NewPushNotificationsSenderMock()
+	messageRepository := newTestMessageRepository(t)
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+	now := time.Now()
+	for i, queued := range []struct {
+		priority int
+		user     string
+		due      bool
+	}{
+		{priorityLow, "A", true},
+		{priorityNormal, "A", false},
+		{priorityEmergency, "B", true},
+		{priorityNormal, "A", true},
+		{priorityHigh, "A", true},
+		{priorityNormal, "C", true},
+	} {
+		nextAttemptAt := now.Add(-time.Minute)
+		if !queued.due {
+			nextAttemptAt = now.Add(time.Hour)
+		}
+		id := fmt.Sprintf("m%d", i+1)
+		messageRepository.Store(&QueuedMessage{
+			ID:            id,
+			Notification:  PushNotification{Token: "<dummy token>", User: queued.user, Message: id, Priority: queued.priority},
+			AcceptedAt:    now.Add(time.Duration(i-10) * time.Minute),
+			NextAttemptAt: nextAttemptAt,
+		})
+	}
+
+	// WHEN
+	pcm.ForceResponse(nil, 200, nil, "")
+	processor.processQueue()
+
+	// THEN
+	var delivered []string
+	for _, notification := range pcm.notifications {
+		delivered = append(delivered, notification.Message)
+	}
+	if strings.Join(delivered, ",") != "m3,m5,m6,m1" {
+		t.Errorf("Messages delivered in the order %v, expected m3,m5,m6,m1.", delivered)
+	}
+}
+
+// TestShouldSuppressDuplicateMessages tests whether the duplicates within the deduplication window are accepted but not delivered,
+// the summary of the suppressed duplicates is delivered with the resolved aliases
+func TestShouldSuppressDuplicateMessages(t *testing.T) {
+
+	// **** GIVEN ****
+
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.TokenVault = NewTokenVault(map[string]string{"backup": "<real token>"}, map[string]string{"martin": "<real user>"}, nil, false)
+	processor.Deduplicator = NewDeduplicator(time.Hour, nil)
+	testMessage := PushNotification{Token: "backup", User: "martin", Title: "<dummy title>", Message: "<dummy message>"}
+
+	// **** WHEN ****
+
+	// the same message is sent both with the aliases and the real values
+	var responses []PushNotificationHandlingResponse
+	for _, message := range []PushNotification{testMessage, testMessage, {Token: "<real token>", User: "<real user>", Title: "<dummy title>", Message: "<dummy message>"}} {
+		var response = PushNotificationHandlingResponse{}
+		err := processor.HandleMessage(context.Background(), &response, message)
+		if err != nil {
+			t.Fatalf("Handling of the message failed with error %s.", err)
+		}
+		responses = append(responses, response)
+	}
+	processor.SendDuplicatesSummary(getDuplicatesSummary(testMessage, 2))
+
+	// **** THEN ****
+
+	for i, response := range responses {
+		if response.responseCode != 200 {
+			t.Errorf("The message %d returned response code %d, expected 200.", i, response.responseCode)
+		}
+	}
+	expected := []PushNotification{
+		{Token: "<real token>", User: "<real user>", Title: "<dummy title>", Message: "<dummy message>"},
+		{Token: "<real token>", User: "<real user>", Title: "<dummy title>", Message: "Message repeated 2 times: <dummy message>"},
+	}
+	if len(pcm.notifications) != len(expected) || pcm.notifications[0] != expected[0] || pcm.notifications[1] != expected[1] {
+		t.Errorf("The notifications %v delivered, expected %v.", pcm.notifications, expected)
+	}
+}
+
+// TestShouldSendDigestOfLowPriorityMessages tests whether the low priority messages of a user are accumulated and sent as one notification
+func TestShouldSendDigestOfLowPriorityMessages(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the low priority messages and a normal priority message are received
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.DigestRepository = newTestDigestRepository(t)
+	processor.DigestInterval = time.Hour
+	for _, message := range []PushNotification{
+		{Token: "<dummy token>", User: "<dummy user>", Title: "backup", Message: "finished", Priority: priorityLowest},
+		{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"},
+		{Token: "<dummy token>", User: "<dummy user>", Message: "disk 80% full", Priority: priorityLow},
+	} {
+		var response = PushNotificationHandlingResponse{}
+		err := processor.HandleMessage(context.Background(), &response, message)
+		if err != nil || response.responseCode != 200 {
+			t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+		}
+	}
+	processor.processDigests()
+	if len(pcm.notifications) != 1 || pcm.notifications[0].Message != "<dummy message>" {
+		t.Fatalf("The notifications %v delivered before the digest interval, expected the normal priority message only.", pcm.notifications)
+	}
+
+	// **** WHEN ****
+
+	// the digest interval passes
+	digests, _ := processor.DigestRepository.List()
+	if len(digests) != 1 {
+		t.Fatalf("%d digests stored, expected 1.", len(digests))
+	}
+	digests[0].SendAt = time.Now().Add(-time.Second)
+	processor.DigestRepository.Store(digests[0])
+	pcm.ForceResponse(nil, 200, nil, "")
+	processor.processDigests()
+
+	// **** THEN ****
+
+	expected := PushNotification{Token: "<dummy token>", User: "<dummy user>", Title: "2 notifications", Message: "backup: finished\ndisk 80% full", Priority: priorityLow}
+	if len(pcm.notifications) != 1 || pcm.notifications[0] != expected {
+		t.Errorf("The notifications %v delivered, expected the digest %v.", pcm.notifications, expected)
+	}
+	digests, _ = processor.DigestRepository.List()
+	if len(digests) != 0 {
+		t.Errorf("%d digests left after sending, expected none.", len(digests))
+	}
+}
+
+// TestShouldKeepMessagesAddedWhileSendingDigest tests whether the message added to the digest while the digest is being sent
+// is kept for the next digest
+func TestShouldKeepMessagesAddedWhileSendingDigest(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the digest is due
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	processor.DigestRepository = newTestDigestRepository(t)
+	processor.DigestInterval = time.Hour
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(context.Background(), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "first", Priority: priorityLow})
+	if err != nil || response.responseCode != 200 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+	}
+	digests, _ := processor.DigestRepository.List()
+	digests[0].SendAt = time.Now().Add(-time.Second)
+	processor.DigestRepository.Store(digests[0])
+
+	// the next message arrives while the digest is being sent
+	pcm.onPost = func() {
+		pcm.onPost = nil
+		var response = PushNotificationHandlingResponse{}
+		err := processor.HandleMessage(context.Background(), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "second", Priority: priorityLow})
+		if err != nil || response.responseCode != 200 {
+			t.Errorf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+		}
+	}
+
+	// **** WHEN ****
+
+	processor.processDigests()
+
+	// **** THEN ****
+
+	if len(pcm.notifications) != 1 || pcm.notifications[0].Message != "first" {
+		t.Errorf("The notifications %v delivered, expected the digest of the first message.", pcm.notifications)
+	}
+	digests, _ = processor.DigestRepository.List()
+	if len(digests) != 1 || len(digests[0].Items) != 1 || digests[0].Items[0].Message != "second" || !digests[0].SendAt.After(time.Now()) {
+		t.Errorf("The digests %v left after sending, expected the pending digest of the second message.", digests)
+	}
+}
+
+func TestShouldTruncateDigestMessage(t *testing.T) {
+
+	var testcases = []struct {
+		id             string
+		message        string
+		expectedLength int
+		expectedSuffix string
+	}{
+		{"ShouldKeepShortMessage", strings.Repeat("a", 1024), 1024, "a"},
+		{"ShouldTruncateLongMessage", strings.Repeat("a", 1025), 1024, "…"},
+		{"ShouldCountCharacters", strings.Repeat("č", 1024), 1024, "č"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			digest := &Digest{Items: []DigestItem{{Message: tc.message}}}
+
+			// WHEN
+			notification := getDigestNotification(digest)
+
+			// THEN
+			length := len([]rune(notification.Message))
+			if length != tc.expectedLength || !strings.HasSuffix(notification.Message, tc.expectedSuffix) {
+				t.Errorf("The message of %d characters ending by \"%s\" generated, expected %d ending by \"%s\".", length, string([]rune(notification.Message)[length-1:]), tc.expectedLength, tc.expectedSuffix)
+			}
+		})
+	}
+}
+
+// TestShouldDeliverScheduledMessages tests whether the scheduled message is delivered at its time with the scheduled timestamp
+// and it does not hold the other messages of the user
+func TestShouldDeliverScheduledMessages(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the message is scheduled to the future
+	pcm := NewPushNotificationsSenderMock()
+	messageRepository := newTestMessageRepository(t)
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	scheduledMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<reminder>", SendAt: sendAt.Format(time.RFC3339)}
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(WithRequestID(context.Background(), "scheduledrequest"), &response, scheduledMessage)
+	if err != nil || response.responseCode != 202 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 202.", err, response.responseCode)
+	}
+
+	// a later message of the same user fails temporarily and gets queued behind the scheduled one
+	pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+	err = processor.HandleMessage(WithRequestID(context.Background(), "laterrequest"), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"})
+	if err != nil || response.responseCode != 202 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 202.", err, response.responseCode)
+	}
+	laterMessage, _ := messageRepository.Get("laterrequest")
+	laterMessage.NextAttemptAt = time.Now()
+	messageRepository.Store(laterMessage)
+
+	// **** WHEN ****
+
+	// the queue is processed before and after the scheduled time
+	pcm.ForceResponse(nil, 200, nil, "")
+	nextAttemptAt := processor.processQueue()
+	deliveredBefore := pcm.notifications
+	queued, _ := messageRepository.Get("scheduledrequest")
+	queued.NextAttemptAt = time.Now()
+	messageRepository.Store(queued)
+	pcm.ForceResponse(nil, 200, nil, "")
+	processor.processQueue()
+
+	// **** THEN ****
+
+	if len(deliveredBefore) != 1 || deliveredBefore[0].Message != "<dummy message>" {
+		t.Errorf("The notifications %v delivered before the scheduled time, expected the later message only.", deliveredBefore)
+	}
+	if !nextAttemptAt.Equal(sendAt) {
+		t.Errorf("The next attempt at %s returned, expected the scheduled time %s.", nextAttemptAt, sendAt)
+	}
+	expected := scheduledMessage
+	expected.Timestamp = sendAt.Unix()
+	pcm.AssertMessageAcceptedOnce(t, expected)
+	remaining, _ := messageRepository.List()
+	if len(remaining) != 0 {
+		t.Errorf("%d messages left in the queue, expected none.", len(remaining))
+	}
+}
+
+// TestShouldApplyQuietHours tests whether the non-emergency messages are deferred or downgraded during the quiet hours of the user
+func TestShouldApplyQuietHours(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		user                 string
+		priority             int
+		action               string
+		expectedResponseCode int
+		expectedPriority     int  // priority of the delivered message
+		expectedDeferred     bool // the message is queued until the end of the quiet hours
+	}{
+		{"ShouldDeferNormalMessage", "martin", priorityNormal, quietHoursActionDefer, 202, 0, true},
+		{"ShouldDeferMessageOfUserKey", "<real user>", priorityHigh, quietHoursActionDefer, 202, 0, true},
+		{"ShouldDowngradeHighMessage", "martin", priorityHigh, quietHoursActionDowngrade, 200, priorityLow, false},
+		{"ShouldKeepLowestPriorityOnDowngrade", "martin", priorityLowest, quietHoursActionDowngrade, 200, priorityLowest, false},
+		{"ShouldPassEmergencyMessage", "martin", priorityEmergency, quietHoursActionDefer, 200, priorityEmergency, false},
+		{"ShouldPassMessageOfOtherUser", "other", priorityNormal, quietHoursActionDefer, 200, priorityNormal, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			// the user is within the quiet hours
+			pcm := NewPushNotificationsSenderMock()
+			messageRepository := newTestMessageRepository(t)
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+			processor.TokenVault = NewTokenVault(nil, map[string]string{"martin": "<real user>"}, nil, false)
+			now := time.Now().UTC()
+			quietHours, err := NewQuietHours(now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"), "UTC", tc.action)
+			if err != nil {
+				t.Fatalf("Creation of the quiet hours failed with error %s.", err)
+			}
+			processor.QuietHours = map[string]*QuietHours{"martin": quietHours}
+
+			// **** WHEN ****
+
+			var response = PushNotificationHandlingResponse{}
+			err = processor.HandleMessage(WithRequestID(context.Background(), "quietrequest"), &response, PushNotification{Token: "<dummy token>", User: tc.user, Message: "<dummy message>", Priority: tc.priority})
+
+			// **** THEN ****
+
+			if err != nil || response.responseCode != tc.expectedResponseCode {
+				t.Fatalf("Handling of the message returned error %v and response code %d, expected %d.", err, response.responseCode, tc.expectedResponseCode)
+			}
+			queuedMessage, _ := messageRepository.Get("quietrequest")
+			if tc.expectedDeferred {
+				if len(pcm.notifications) != 0 || queuedMessage == nil || queuedMessage.NextAttemptAt.Sub(now) < 59*time.Minute || queuedMessage.Notification.Timestamp == 0 {
+					t.Errorf("The message %v was not deferred until the end of the quiet hours, the notifications %v delivered.", queuedMessage, pcm.notifications)
+				}
+				return
+			}
+			if queuedMessage != nil || len(pcm.notifications) != 1 || pcm.notifications[0].Priority != tc.expectedPriority {
+				t.Errorf("The notifications %v delivered, expected one of priority %d.", pcm.notifications, tc.expectedPriority)
+			}
+		})
+	}
+}
+
+// TestShouldNotDigestMessagesDowngradedByQuietHours tests whether the messages downgraded during the quiet hours are delivered
+// immediately instead of being accumulated into the digest
+func TestShouldNotDigestMessagesDowngradedByQuietHours(t *testing.T) {
+
+	var testcases = []struct {
+		id               string
+		priority         int
+		expectedPriority int  // priority of the delivered message
+		expectedDigested bool // the message is accumulated into the digest
+	}{
+		{"ShouldDeliverDowngradedHighMessage", priorityHigh, priorityLow, false},
+		{"ShouldDeliverDowngradedNormalMessage", priorityNormal, priorityLow, false},
+		{"ShouldDigestLowMessage", priorityLow, priorityLow, true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			// the user is within the quiet hours downgrading the messages and the digests are enabled
+			pcm := NewPushNotificationsSenderMock()
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+			processor.DigestRepository = newTestDigestRepository(t)
+			processor.DigestInterval = time.Hour
+			now := time.Now().UTC()
+			quietHours, err := NewQuietHours(now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"), "UTC", quietHoursActionDowngrade)
+			if err != nil {
+				t.Fatalf("Creation of the quiet hours failed with error %s.", err)
+			}
+			processor.QuietHours = map[string]*QuietHours{"martin": quietHours}
+
+			// **** WHEN ****
+
+			var response = PushNotificationHandlingResponse{}
+			err = processor.HandleMessage(context.Background(), &response, PushNotification{Token: "<dummy token>", User: "martin", Message: "<dummy message>", Priority: tc.priority})
+
+			// **** THEN ****
+
+			if err != nil || response.responseCode != 200 {
+				t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+			}
+			digests, _ := processor.DigestRepository.List()
+			if tc.expectedDigested {
+				if len(digests) != 1 || len(pcm.notifications) != 0 {
+					t.Errorf("%d digests stored and the notifications %v delivered, expected the message in the digest.", len(digests), pcm.notifications)
+				}
+				return
+			}
+			if len(digests) != 0 || len(pcm.notifications) != 1 || pcm.notifications[0].Priority != tc.expectedPriority {
+				t.Errorf("%d digests stored and the notifications %v delivered, expected one of priority %d.", len(digests), pcm.notifications, tc.expectedPriority)
+			}
+		})
+	}
+}
+
+// TestShouldApplyQuietHoursToQueuedMessages tests whether the retries and the scheduled messages coming due during the quiet
+// hours of the user are deferred or downgraded
+func TestShouldApplyQuietHoursToQueuedMessages(t *testing.T) {
+
+	var testcases = []struct {
+		id               string
+		priority         int
+		action           string
+		scheduled        bool
+		expectedPriority int  // priority of the delivered message
+		expectedDeferred bool // the message stays in the queue until the end of the quiet hours
+	}{
+		{"ShouldDeferRetry", priorityNormal, quietHoursActionDefer, false, 0, true},
+		{"ShouldDeferScheduledMessage", priorityHigh, quietHoursActionDefer, true, 0, true},
+		{"ShouldDowngradeRetry", priorityHigh, quietHoursActionDowngrade, false, priorityLow, false},
+		{"ShouldDowngradeScheduledMessage", priorityNormal, quietHoursActionDowngrade, true, priorityLow, false},
+		{"ShouldPassEmergencyRetry", priorityEmergency, quietHoursActionDefer, false, priorityEmergency, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			// the queued message of the user within the quiet hours is due
+			pcm := NewPushNotificationsSenderMock()
+			messageRepository := newTestMessageRepository(t)
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+			processor.TokenVault = NewTokenVault(nil, map[string]string{"martin": "<real user>"}, nil, false)
+			now := time.Now().UTC()
+			quietHours, err := NewQuietHours(now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"), "UTC", tc.action)
+			if err != nil {
+				t.Fatalf("Creation of the quiet hours failed with error %s.", err)
+			}
+			processor.QuietHours = map[string]*QuietHours{"martin": quietHours}
+			queuedMessage := newTestQueuedMessage("quietqueued", "", "martin", time.Minute)
+			queuedMessage.Notification.Priority = tc.priority
+			queuedMessage.NextAttemptAt = now.Add(-time.Second)
+			if tc.scheduled {
+				queuedMessage.Attempts = 0
+				queuedMessage.ScheduledAt = queuedMessage.NextAttemptAt
+			}
+			messageRepository.Store(queuedMessage)
+
+			// **** WHEN ****
+
+			processor.processQueue()
+
+			// **** THEN ****
+
+			storedMessage, _ := messageRepository.Get("quietqueued")
+			if tc.expectedDeferred {
+				if len(pcm.notifications) != 0 || storedMessage == nil || storedMessage.NextAttemptAt.Sub(now) < 59*time.Minute || storedMessage.Attempts != queuedMessage.Attempts {
+					t.Errorf("The message %v was not deferred until the end of the quiet hours, the notifications %v delivered.", storedMessage, pcm.notifications)
+				}
+				return
+			}
+			if storedMessage != nil || len(pcm.notifications) != 1 || pcm.notifications[0].Priority != tc.expectedPriority {
+				t.Errorf("The notifications %v delivered, expected one of priority %d.", pcm.notifications, tc.expectedPriority)
+			}
+		})
+	}
+}
+
+// creates the processor escalating the emergency messages by the policy "db" to bob and carol
+func newTestEscalatingProcessor(t *testing.T, pcm *PushNotificationsSenderMock) (*Processor, *ReceiptsCheckerMock) {
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+	rcm := NewReceiptsCheckerMock()
+	processor.ReceiptsChecker = rcm
+	processor.EscalationRepository = newTestEscalationRepository(t)
+	policy, err := NewEscalationPolicy("db", time.Hour, []string{"bob", "carol"})
+	if err != nil {
+		t.Fatalf("Escalation policy creation failed with error %s.", err)
+	}
+	processor.EscalationPolicies = map[string]*EscalationPolicy{"db": policy}
+	return processor, rcm
+}
+
+// makes the next step of the escalation due
+func expireEscalationTimeout(t *testing.T, processor *Processor, id string) {
+	escalation, err := processor.EscalationRepository.Get(id)
+	if err != nil || escalation == nil {
+		t.Fatalf("Reading of the escalation returned %v and error %v.", escalation, err)
+	}
+	escalation.EscalateAt = time.Now()
+	processor.EscalationRepository.Store(escalation)
+}
+
+// TestShouldEscalateUnacknowledgedEmergencyMessages tests whether the emergency message is sent to the next user of the chain
+// when not acknowledged in time and whether the escalation stops after the acknowledgement
+func TestShouldEscalateUnacknowledgedEmergencyMessages(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the emergency message is delivered to alice
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, rcm := newTestEscalatingProcessor(t, pcm)
+	message := PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, Retry: 60, Expire: 3600, Escalation: "db"}
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, message)
+	if err != nil || response.responseCode != 200 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+	}
+
+	// **** WHEN ****
+
+	// the escalation is processed before and after the acknowledgement timeout, then alice acknowledges
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"step\",\"receipt\":\"r2\"}")
+	processor.processEscalations()
+	notifiedBeforeTimeout := len(pcm.notifications)
+	expireEscalationTimeout(t, processor, "emergency")
+	processor.processEscalations()
+	notifiedAfterTimeout := pcm.notifications
+	rcm.receipts["r1"] = &Receipt{Acknowledged: true, AcknowledgedAt: time.Unix(1767258000, 0), AcknowledgedBy: "alice-user-key"}
+	expireEscalationTimeout(t, processor, "emergency")
+	processor.processEscalations()
+
+	// **** THEN ****
+
+	if notifiedBeforeTimeout != 0 {
+		t.Errorf("%d users notified before the timeout, expected none.", notifiedBeforeTimeout)
+	}
+	if len(notifiedAfterTimeout) != 1 || notifiedAfterTimeout[0].User != "bob" || notifiedAfterTimeout[0].Escalation != "db" || notifiedAfterTimeout[0].Message != message.Message {
+		t.Errorf("Notifications %v sent after the timeout, expected the message to bob.", notifiedAfterTimeout)
+	}
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	if escalation.State != escalationStateAcknowledged || escalation.AcknowledgedBy != "alice-user-key" || len(escalation.Steps) != 2 || escalation.Steps[1].Receipt != "r2" {
+		t.Errorf("Escalation %v stored, expected acknowledged by alice after two steps.", escalation)
+	}
+	if len(rcm.cancelled) != 1 || rcm.cancelled[0] != "r2" {
+		t.Errorf("Receipts %v cancelled, expected the receipt of bob.", rcm.cancelled)
+	}
+}
+
+// TestShouldCancelEscalationWhileSendingStep tests whether the escalation is cancelled while its next step is being sent and whether
+// the notifications of the step are stopped
+func TestShouldCancelEscalationWhileSendingStep(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the emergency message was delivered to alice and was not acknowledged in time
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, rcm := newTestEscalatingProcessor(t, pcm)
+	var response = PushNotificationHandlingResponse{}
+	processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, Escalation: "db"})
+	expireEscalationTimeout(t, processor, "emergency")
+
+	// the administrator cancels the escalation while the step of bob is being sent
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"step\",\"receipt\":\"r2\"}")
+	pcm.onPost = func() {
+		cancelled := make(chan error, 1)
+		go func() {
+			cancelled <- processor.CancelEscalation("emergency")
+		}()
+		select {
+		case err := <-cancelled:
+			if err != nil {
+				t.Errorf("Cancelling of the escalation failed with error %s.", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Cancelling of the escalation blocked while the step was being sent.")
+		}
+	}
+
+	// **** WHEN ****
+
+	processor.processEscalations()
+
+	// **** THEN ****
+
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	if escalation.State != escalationStateCancelled || len(escalation.Steps) != 2 || escalation.Steps[1].Receipt != "r2" || !escalation.Steps[1].Expired {
+		t.Errorf("Escalation %v stored, expected cancelled with the stopped step of bob.", escalation)
+	}
+	if len(rcm.cancelled) != 2 || rcm.cancelled[0] != "r1" || rcm.cancelled[1] != "r2" {
+		t.Errorf("Receipts %v cancelled, expected the receipts of alice and bob.", rcm.cancelled)
+	}
+}
+
+// TestShouldExhaustEscalationChain tests whether the queued step is tracked on its delivery and whether the escalation ends after
+// the last user of the chain
+func TestShouldExhaustEscalationChain(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the emergency message was delivered to alice and the step of bob fails temporarily
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, _ := newTestEscalatingProcessor(t, pcm)
+	message := PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, Escalation: "db"}
+	var response = PushNotificationHandlingResponse{}
+	processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, message)
+	pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+	expireEscalationTimeout(t, processor, "emergency")
+	processor.processEscalations()
+
+	// **** WHEN ****
+
+	// the queued step of bob is delivered and nobody acknowledges until the end of the chain
+	queue, _ := processor.MessageRepository.List()
+	if len(queue) != 1 || queue[0].ParentID != "emergency" {
+		t.Fatalf("Messages %v queued, expected the step of the escalation.", queue)
+	}
+	queue[0].NextAttemptAt = time.Now()
+	processor.MessageRepository.Store(queue[0])
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"step\",\"receipt\":\"r2\"}")
+	processor.processQueue()
+	for i := 0; i < 3; i++ {
+		expireEscalationTimeout(t, processor, "emergency")
+		processor.processEscalations()
+	}
+
+	// **** THEN ****
+
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	if escalation.State != escalationStateExhausted || len(escalation.Steps) != 3 {
+		t.Fatalf("Escalation %v stored, expected exhausted after three steps.", escalation)
+	}
+	if escalation.Steps[1].User != "bob" || escalation.Steps[1].Receipt != "r2" || escalation.Steps[2].User != "carol" {
+		t.Errorf("Steps %v stored, expected the delivered steps of bob and carol.", escalation.Steps)
+	}
+	escalations, _ := processor.EscalationRepository.List()
+	if len(escalations) != 1 {
+		t.Errorf("%d escalations stored, expected the step not to start a new escalation.", len(escalations))
+	}
+}
+
+// TestShouldRejectUnknownEscalationPolicy tests whether the message with an unknown escalation policy is rejected
+func TestShouldRejectUnknownEscalationPolicy(t *testing.T) {
+
+	// GIVEN
+	pcm := NewPushNotificationsSenderMock()
+	processor, _ := newTestEscalatingProcessor(t, pcm)
+
+	// WHEN
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, Escalation: "web"})
+
+	// THEN
+	if err != nil || response.responseCode != 400 {
+		t.Errorf("Handling of the message returned error %v and response code %d, expected 400.", err, response.responseCode)
+	}
+	if len(pcm.notifications) != 0 {
+		t.Errorf("Notifications %v sent, expected none.", pcm.notifications)
+	}
+}
+
+// TestShouldForwardAcknowledgementToCallback tests whether the acknowledgement of the emergency message is forwarded to its
+// callback URL and whether the failed forwarding is repeated
+func TestShouldForwardAcknowledgementToCallback(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the emergency message with the callback is delivered and acknowledged, the callback service is down
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, rcm := newTestEscalatingProcessor(t, pcm)
+	cfm := NewCallbackForwarderMock()
+	cfm.responseErr = errors.New("connection refused")
+	processor.CallbackForwarder = cfm
+	message := PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, BrokerCallback: "http://inventory.internal/ack"}
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, message)
+	if err != nil || response.responseCode != 200 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+	}
+	rcm.receipts["r1"] = &Receipt{Acknowledged: true, AcknowledgedAt: time.Unix(1767258000, 0), AcknowledgedBy: "alice-user-key"}
+
+	// **** WHEN ****
+
+	// the escalations are processed before and after the retry delay of the callback
+	processor.processEscalations()
+	processor.processEscalations()
+	attemptsBeforeDelay := len(cfm.events)
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	escalation.CallbackNextAttemptAt = time.Now()
+	processor.EscalationRepository.Store(escalation)
+	cfm.responseErr = nil
+	processor.processEscalations()
+	processor.processEscalations()
+
+	// **** THEN ****
+
+	if attemptsBeforeDelay != 1 {
+		t.Errorf("%d callback attempts before the retry delay, expected 1.", attemptsBeforeDelay)
+	}
+	expectedEvent := AcknowledgementEvent{Event: "acknowledged", Request: "emergency", Receipt: "r1", AcknowledgedAt: 1767258000, AcknowledgedBy: "alice-user-key", Message: "<db down>"}
+	if len(cfm.events) != 2 || *cfm.events[1] != expectedEvent || cfm.urls[1] != message.BrokerCallback {
+		t.Errorf("Events %v forwarded, expected %v twice.", cfm.events, expectedEvent)
+	}
+	escalation, _ = processor.EscalationRepository.Get("emergency")
+	if escalation.State != escalationStateAcknowledged || escalation.CallbackDeliveredAt.IsZero() || escalation.CallbackAttempts != 2 || len(pcm.notifications) != 1 {
+		t.Errorf("Escalation %v stored, expected the callback delivered on the second attempt without escalating.", escalation)
+	}
+}
+
+// TestShouldTrackMessagesWhileForwardingCallback tests whether the new emergency message is tracked while the acknowledgement is
+// being forwarded to the callback
+func TestShouldTrackMessagesWhileForwardingCallback(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the message with the callback was acknowledged
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, rcm := newTestEscalatingProcessor(t, pcm)
+	cfm := NewCallbackForwarderMock()
+	processor.CallbackForwarder = cfm
+	var response = PushNotificationHandlingResponse{}
+	processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, BrokerCallback: "http://inventory.internal/ack"})
+	rcm.receipts["r1"] = &Receipt{Acknowledged: true, AcknowledgedAt: time.Unix(1767258000, 0), AcknowledgedBy: "alice-user-key"}
+
+	// the next emergency message arrives while the acknowledgement is being forwarded
+	cfm.onForward = func() {
+		handled := make(chan error, 1)
+		go func() {
+			var response = PushNotificationHandlingResponse{}
+			handled <- processor.HandleMessage(WithRequestID(context.Background(), "next"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down again>", Priority: priorityEmergency, Escalation: "db"})
+		}()
+		select {
+		case err := <-handled:
+			if err != nil {
+				t.Errorf("Handling of the message failed with error %s.", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Handling of the message blocked while the acknowledgement was being forwarded.")
+		}
+	}
+
+	// **** WHEN ****
+
+	processor.processEscalations()
+
+	// **** THEN ****
+
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	if len(cfm.events) != 1 || escalation.CallbackDeliveredAt.IsZero() {
+		t.Errorf("Escalation %v stored after forwarding %d events, expected the callback delivered.", escalation, len(cfm.events))
+	}
+	next, _ := processor.EscalationRepository.Get("next")
+	if next == nil || next.State != escalationStateActive {
+		t.Errorf("Escalation %v of the next message stored, expected an active one.", next)
+	}
+}
+
+// TestShouldStopTrackingExpiredCallbackMessage tests whether the message with the callback is not tracked after its notifications
+// expired without the acknowledgement
+func TestShouldStopTrackingExpiredCallbackMessage(t *testing.T) {
+
+	// GIVEN
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(nil, 200, nil, "{\"status\":1,\"request\":\"emergency\",\"receipt\":\"r1\"}")
+	processor, rcm := newTestEscalatingProcessor(t, pcm)
+	cfm := NewCallbackForwarderMock()
+	processor.CallbackForwarder = cfm
+	var response = PushNotificationHandlingResponse{}
+	processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, BrokerCallback: "http://inventory.internal/ack"})
+	rcm.receipts["r1"] = &Receipt{Expired: true}
+
+	// WHEN
+	processor.processEscalations()
+
+	// THEN
+	escalation, _ := processor.EscalationRepository.Get("emergency")
+	if escalation == nil || escalation.State != escalationStateExhausted {
+		t.Errorf("Escalation %v stored, expected exhausted.", escalation)
+	}
+	if len(cfm.events) != 0 {
+		t.Errorf("Events %v forwarded, expected none.", cfm.events)
+	}
+}
+
+// TestShouldRejectUnsupportedCallback tests whether the message with the callback is rejected if the callbacks are not supported
+func TestShouldRejectUnsupportedCallback(t *testing.T) {
+
+	// GIVEN
+	pcm := NewPushNotificationsSenderMock()
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), newTestMessageRepository(t))
+
+	// WHEN
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(WithRequestID(context.Background(), "emergency"), &response, PushNotification{Token: "<dummy token>", User: "alice", Message: "<db down>", Priority: priorityEmergency, BrokerCallback: "http://inventory.internal/ack"})
+
+	// THEN
+	if err != nil || response.responseCode != 400 {
+		t.Errorf("Handling of the message returned error %v and response code %d, expected 400.", err, response.responseCode)
+	}
+	if len(pcm.notifications) != 0 {
+		t.Errorf("Notifications %v sent, expected none.", pcm.notifications)
+	}
+}
+
+// TestShouldEmitMessageLifecycleEvents tests whether the processor emits the events of the message states to the listeners
+func TestShouldEmitMessageLifecycleEvents(t *testing.T) {
+
+	var testcases = []struct {
+		id                 string
+		responseErr        error
+		responseCode       int
+		queuedResponseCode int // response of the repeated attempt of the queued message, not repeated if 0
+		expectedEvents     string
+	}{
+		{"ShouldEmitDelivered", nil, 200, 0, "accepted,delivered"},
+		{"ShouldEmitFailed", nil, 400, 0, "accepted,failed"},
+		{"ShouldEmitQueued", errors.New("offline"), 0, 0, "accepted,queued"},
+		{"ShouldEmitQueuedDelivered", errors.New("offline"), 0, 200, "accepted,queued,retried,delivered"},
+		{"ShouldEmitQueuedFailed", nil, 500, 400, "accepted,queued,retried,failed"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			pcm := NewPushNotificationsSenderMock()
+			pcm.ForceResponse(tc.responseErr, tc.responseCode, nil, "")
+			messageRepository := newTestMessageRepository(t)
+			processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+			elm := NewMessageEventListenerMock()
+			processor.EventListeners = []MessageEventListener{elm}
+
+			// WHEN
+			var response = PushNotificationHandlingResponse{}
+			err := processor.HandleMessage(WithRequestID(context.Background(), "request"), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>", Priority: priorityHigh})
+			if err != nil {
+				t.Fatalf("Handling of the message failed with error %s.", err)
+			}
+			if tc.queuedResponseCode != 0 {
+				queuedMessage, _ := messageRepository.Get("request")
+				queuedMessage.NextAttemptAt = time.Now()
+				messageRepository.Store(queuedMessage)
+				pcm.ForceResponse(nil, tc.queuedResponseCode, nil, "")
+				processor.processQueue()
+			}
+
+			// THEN
+			if elm.GetEventTypes() != tc.expectedEvents {
+				t.Errorf("Events %s emitted, expected %s.", elm.GetEventTypes(), tc.expectedEvents)
+			}
+			for _, event := range elm.events {
+				if event.Request != "request" || event.Priority != priorityHigh || event.ID == "" || event.At.IsZero() {
+					t.Errorf("Event %v emitted, expected the request with the priority, identifier and time.", event)
+				}
+				if event.User != RedactSecret("<dummy user>") {
+					t.Errorf("Event user %s emitted, expected the redacted user.", event.User)
+				}
+			}
+		})
+	}
+}
+
+// TestShouldNotReplayDeadLetterWithoutStore tests whether the replay fails if the processor does not store the dead letters
+func TestShouldNotReplayDeadLetterWithoutStore(t *testing.T) {
+
+	// GIVEN
+	processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+
+	// WHEN
+	err := processor.ReplayDeadLetter("failed")
+
+	// THEN
+	if err != ErrDeadLettersNotStored {
+		t.Errorf("Replay returned error %v, expected %s.", err, ErrDeadLettersNotStored)
+	}
+}
+
+// TestShouldEmitTerminalEventsOfUndeliveredMessages tests whether the suppressed and digested messages end by their own events
+func TestShouldEmitTerminalEventsOfUndeliveredMessages(t *testing.T) {
+
+	var testcases = []struct {
+		id             string
+		priority       int
+		deduplicate    bool
+		expectedEvents string
+	}{
+		{"ShouldEmitSuppressed", priorityNormal, true, "accepted,delivered,accepted,suppressed"},
+		{"ShouldEmitDigested", priorityLow, false, "accepted,digested,accepted,digested"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			processor := NewProcessor(NewPushNotificationsSenderMock(), NewLimitsCounterImpl(), newTestMessageRepository(t))
+			if tc.deduplicate {
+				processor.Deduplicator = NewDeduplicator(time.Hour, nil)
+			}
+			processor.DigestRepository = newTestDigestRepository(t)
+			processor.DigestInterval = time.Hour
+			elm := NewMessageEventListenerMock()
+			processor.EventListeners = []MessageEventListener{elm}
+			message := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>", Priority: tc.priority}
+
+			// WHEN
+			for _, requestID := range []string{"first", "second"} {
+				var response = PushNotificationHandlingResponse{}
+				err := processor.HandleMessage(WithRequestID(context.Background(), requestID), &response, message)
+				if err != nil || response.responseCode != 200 {
+					t.Fatalf("Handling of the message returned error %v and response code %d, expected 200.", err, response.responseCode)
+				}
+			}
+
+			// THEN
+			if elm.GetEventTypes() != tc.expectedEvents {
+				t.Errorf("Events %s emitted, expected %s.", elm.GetEventTypes(), tc.expectedEvents)
 			}
 		})
 	}
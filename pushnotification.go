@@ -3,13 +3,52 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// the Pushover message priorities
+const (
+	priorityLowest    = -2
+	priorityLow       = -1
+	priorityNormal    = 0
+	priorityHigh      = 1
+	priorityEmergency = 2
+)
+
+// priorityNames maps the names of the priorities used in the configuration to the Pushover priorities
+var priorityNames = map[string]int{
+	"lowest":    priorityLowest,
+	"low":       priorityLow,
+	"normal":    priorityNormal,
+	"high":      priorityHigh,
+	"emergency": priorityEmergency,
+}
+
+// brokerOnlyParameters are the parameters handled by the broker, they are not passed to the Pushover API
+var brokerOnlyParameters = []string{"broker_expire", "send_at", "channel", "escalation", "broker_callback"}
+
 // PushNotification represents a message with json request that is passed to the REST API
 type PushNotification struct {
-	Token   string `json:"token" schema:"token"`
-	User    string `json:"user"  schema:"user"`
-	Message string `json:"message" schema:"message"`
+	Token          string `json:"token" schema:"token"`
+	User           string `json:"user"  schema:"user"`
+	Message        string `json:"message" schema:"message"`
+	Title          string `json:"title,omitempty" schema:"title,omitempty"`
+	Sound          string `json:"sound,omitempty" schema:"sound,omitempty"`
+	URL            string `json:"url,omitempty" schema:"url,omitempty"`
+	Device         string `json:"device,omitempty" schema:"device,omitempty"`   // device name(s) of the user, all the devices if empty
+	Channel        string `json:"channel,omitempty" schema:"channel,omitempty"` // logical recipient routed by the broker to the users (see Router)
+	Priority       int    `json:"priority,omitempty" schema:"priority,omitempty"`
+	Retry          int    `json:"retry,omitempty" schema:"retry,omitempty"`                     // emergency priority only, seconds between the repeated notifications
+	Expire         int    `json:"expire,omitempty" schema:"expire,omitempty"`                   // emergency priority only, seconds until the notifications stop
+	BrokerExpire   int    `json:"broker_expire,omitempty" schema:"broker_expire,omitempty"`     // seconds after the acceptance, the queued message is not delivered later
+	Timestamp      int64  `json:"timestamp,omitempty" schema:"timestamp,omitempty"`             // Unix time of the message displayed to the user, the time of the delivery if not set
+	SendAt         string `json:"send_at,omitempty" schema:"send_at,omitempty"`                 // Unix time or RFC 3339 time of the scheduled delivery, delivered immediately if empty
+	Escalation     string `json:"escalation,omitempty" schema:"escalation,omitempty"`           // name of the escalation policy of the emergency message, not escalated if empty
+	BrokerCallback string `json:"broker_callback,omitempty" schema:"broker_callback,omitempty"` // internal URL receiving the acknowledgement of the emergency message from the broker
 }
 
 // GetToken returns the API token from the push notification.
@@ -27,21 +66,91 @@ func (m *PushNotification) GetMessage() string {
 	return m.Message
 }
 
+// GetSendAt returns the time of the scheduled delivery or zero time if the message is not scheduled
+func (m *PushNotification) GetSendAt() (time.Time, error) {
+	if m.SendAt == "" {
+		return time.Time{}, nil
+	}
+	unixTime, err := strconv.ParseInt(m.SendAt, 10, 64)
+	if err == nil {
+		return time.Unix(unixTime, 0), nil
+	}
+	sendAt, err := time.Parse(time.RFC3339, m.SendAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("push notification send_at value \"%s\" is neither Unix time nor RFC 3339 time", m.SendAt)
+	}
+	return sendAt, nil
+}
+
+// ValidationRules represents the broker configuration the incomming messages are validated against
+type ValidationRules struct {
+	CallbackURLPrefixes []string // the broker_callback URL has to start with one of the URL prefixes, the callbacks are rejected if empty
+	ChannelRouting      bool     // the routing rules are configured, the messages may be addressed by the channel only
+}
+
 // check the validity of the PushNotification message
-func (m *PushNotification) Validate() error {
+func (m *PushNotification) Validate(rules ValidationRules) error {
 	if m.Token == "" {
 		return errors.New("push notification token value cannot be empty")
 	}
-	if m.User == "" {
-		return errors.New("push notification user value cannot be empty")
+	if m.User == "" && m.Channel == "" {
+		return errors.New("push notification user value cannot be empty, unless the channel is given")
+	}
+	if m.User == "" && !rules.ChannelRouting {
+		return errors.New("push notification user value cannot be empty, there are no routes of the channel")
 	}
 	if m.Message == "" {
 		return errors.New("push notification message value cannot be empty")
 	}
+	if m.Priority < priorityLowest || m.Priority > priorityEmergency {
+		return fmt.Errorf("push notification priority %d is out of range -2..2", m.Priority)
+	}
+	if m.BrokerExpire < 0 {
+		return errors.New("push notification broker_expire value cannot be negative")
+	}
+	if m.Escalation != "" && m.Priority != priorityEmergency {
+		return errors.New("push notification escalation requires the emergency priority 2")
+	}
+	if m.BrokerCallback != "" {
+		if m.Priority != priorityEmergency {
+			return errors.New("push notification broker_callback requires the emergency priority 2")
+		}
+		callbackURL, err := url.Parse(m.BrokerCallback)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			return errors.New("push notification broker_callback value is not an absolute http(s) URL")
+		}
+		if !isAllowedCallbackURL(callbackURL, rules.CallbackURLPrefixes) {
+			return errors.New("push notification broker_callback URL is not allowed by the callback_url_prefixes")
+		}
+	}
+	if _, err := m.GetSendAt(); err != nil {
+		return err
+	}
 	return nil
 }
 
-// DumpToString converts the PushNotification to string
+// returns true if the URL has the scheme and host of one of the URL prefixes and its path continues the path of the prefix
+func isAllowedCallbackURL(callbackURL *url.URL, prefixes []string) bool {
+
+	// the dot segments could leave the allowed path on the receiving server
+	segments := strings.Split(callbackURL.Path, "/")
+	if callbackURL.User != nil || slices.Contains(segments, "..") || slices.Contains(segments, ".") {
+		return false
+	}
+	for _, prefix := range prefixes {
+		prefixURL, err := url.Parse(prefix)
+		if err != nil || callbackURL.Scheme != prefixURL.Scheme || !strings.EqualFold(callbackURL.Host, prefixURL.Host) {
+			continue
+		}
+		prefixPath := strings.TrimSuffix(prefixURL.Path, "/")
+		if callbackURL.Path == prefixPath || strings.HasPrefix(callbackURL.Path, prefixPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// DumpToString converts the PushNotification to string, the token and user are redacted
 func (m *PushNotification) DumpToString() string {
-	return fmt.Sprintf("token=\"%s\", user=\"%s\", message=\"%s\"", m.GetToken(), m.GetUser(), m.GetMessage())
+	return fmt.Sprintf("token=\"%s\", user=\"%s\", message=\"%s\"", RedactSecret(m.GetToken()), RedactSecret(m.GetUser()), m.GetMessage())
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPushNotificationShouldParseSendAt(t *testing.T) {
+
+	var testcases = []struct {
+		id             string
+		sendAt         string
+		expectedSendAt time.Time
+		expectedErr    bool
+	}{
+		{"ShouldAcceptEmpty", "", time.Time{}, false},
+		{"ShouldParseUnixTime", "1767258000", time.Unix(1767258000, 0), false},
+		{"ShouldParseRFC3339", "2026-01-01T09:00:00+01:00", time.Unix(1767254400, 0), false},
+		{"ShouldRejectOtherFormat", "tomorrow 9:00", time.Time{}, true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			message := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>", SendAt: tc.sendAt}
+
+			// WHEN
+			sendAt, err := message.GetSendAt()
+			validationErr := message.Validate(ValidationRules{})
+
+			// THEN
+			if (err != nil) != tc.expectedErr || (validationErr != nil) != tc.expectedErr {
+				t.Fatalf("Parsing returned error %v and validation error %v, expected error %t.", err, validationErr, tc.expectedErr)
+			}
+			if !sendAt.Equal(tc.expectedSendAt) {
+				t.Errorf("Send time %s returned, expected %s.", sendAt, tc.expectedSendAt)
+			}
+		})
+	}
+}
+
+func TestPushNotificationShouldValidateEscalation(t *testing.T) {
+
+	var testcases = []struct {
+		id          string
+		priority    int
+		escalation  string
+		callback    string
+		expectedErr bool
+	}{
+		{"ShouldAcceptNoEscalation", priorityNormal, "", "", false},
+		{"ShouldAcceptEmergencyEscalation", priorityEmergency, "db", "", false},
+		{"ShouldRejectNonEmergencyEscalation", priorityHigh, "db", "", true},
+		{"ShouldAcceptEmergencyCallback", priorityEmergency, "", "https://inventory.internal/ack", false},
+		{"ShouldRejectNonEmergencyCallback", priorityHigh, "", "https://inventory.internal/ack", true},
+		{"ShouldRejectRelativeCallback", priorityEmergency, "", "/ack", true},
+		{"ShouldRejectOtherSchemeCallback", priorityEmergency, "", "file:///etc/passwd", true},
+		{"ShouldAcceptCallbackOfPrefix", priorityEmergency, "", "https://inventory.internal/ack/db", false},
+		{"ShouldAcceptCallbackOfOtherPrefix", priorityEmergency, "", "http://ops.internal:8080/hooks/ack", false},
+		{"ShouldRejectCallbackOfOtherHost", priorityEmergency, "", "https://metadata.internal/ack", true},
+		{"ShouldRejectCallbackOfHostSuffix", priorityEmergency, "", "https://inventory.internal.example.com/ack", true},
+		{"ShouldRejectCallbackOfOtherScheme", priorityEmergency, "", "http://inventory.internal/ack", true},
+		{"ShouldRejectCallbackOfOtherPort", priorityEmergency, "", "http://ops.internal:9090/hooks/ack", true},
+		{"ShouldRejectCallbackOutsidePath", priorityEmergency, "", "https://inventory.internal/admin", true},
+		{"ShouldRejectCallbackOfPathPrefix", priorityEmergency, "", "https://inventory.internal/acknowledge", true},
+		{"ShouldRejectCallbackLeavingPath", priorityEmergency, "", "https://inventory.internal/ack/../admin", true},
+		{"ShouldRejectCallbackWithCredentials", priorityEmergency, "", "https://inventory.internal@evil.example.com/ack", true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			message := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>", Priority: tc.priority, Escalation: tc.escalation, BrokerCallback: tc.callback}
+
+			// WHEN
+			err := message.Validate(ValidationRules{CallbackURLPrefixes: []string{"https://inventory.internal/ack", "http://ops.internal:8080/hooks/"}})
+
+			// THEN
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Validation returned error %v, expected error %t.", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestPushNotificationShouldRejectCallbacksWithoutPrefixes(t *testing.T) {
+
+	// GIVEN
+	message := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>", Priority: priorityEmergency, BrokerCallback: "https://inventory.internal/ack"}
+
+	// WHEN
+	err := message.Validate(ValidationRules{})
+
+	// THEN
+	if err == nil {
+		t.Errorf("Validation succeeded, expected the callback to be rejected without the allowed URL prefixes.")
+	}
+}
+
+func TestPushNotificationShouldValidateChannel(t *testing.T) {
+
+	var testcases = []struct {
+		id             string
+		user           string
+		channel        string
+		channelRouting bool
+		expectedErr    bool
+	}{
+		{"ShouldAcceptUser", "<dummy user>", "", false, false},
+		{"ShouldAcceptUserWithChannel", "<dummy user>", "db-alerts", false, false},
+		{"ShouldAcceptRoutedChannel", "", "db-alerts", true, false},
+		{"ShouldRejectChannelWithoutRoutes", "", "db-alerts", false, true},
+		{"ShouldRejectNoRecipient", "", "", true, true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			message := PushNotification{Token: "<dummy token>", User: tc.user, Channel: tc.channel, Message: "<dummy message>"}
+
+			// WHEN
+			err := message.Validate(ValidationRules{ChannelRouting: tc.channelRouting})
+
+			// THEN
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Validation returned error %v, expected error %t.", err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
+import "context"
+
 // PushNotificationsSender represents the connector to the Pushover API
 type PushNotificationsSender interface {
-	// PostPushNotificationMessage handles the message and returns error if ocurred (or nil) and response code (or 0 on POST error)
-	PostPushNotificationMessage(response *PushNotificationHandlingResponse, message PushNotification) error
+	// PostPushNotificationMessage handles the message and returns error if ocurred (or nil) and response code (or 0 on POST error).
+	// The context carries the trace of the delivery.
+	PostPushNotificationMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error
 }
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 // PushNotificationsSenderMock implements the PushNotificationsSender.PushNotificationsSender interface
 type PushNotificationsSenderMock struct {
@@ -10,6 +13,8 @@ type PushNotificationsSenderMock struct {
 	responseBody        string
 	handleMessageCalled int
 	notification        PushNotification
+	notifications       []PushNotification // all the notifications received since the last ForceResponse call
+	onPost              func()             // called while the message is being posted, if set
 }
 
 // NewPushNotificationsSenderMock initializes the mock
@@ -26,6 +31,7 @@ func NewPushNotificationsSenderMock() *PushNotificationsSenderMock {
 // ForceResponse configures the response to be returned from the PostPushNotificationMessage() call
 func (pcm *PushNotificationsSenderMock) ForceResponse(responseErr error, reseponseCode int, limits *Limits, responseBody string) {
 	pcm.handleMessageCalled = 0
+	pcm.notifications = nil
 	pcm.responseErr = responseErr
 	pcm.responseCode = reseponseCode
 	pcm.responseBody = responseBody
@@ -33,9 +39,13 @@ func (pcm *PushNotificationsSenderMock) ForceResponse(responseErr error, resepon
 }
 
 // PostPushNotificationMessage receives the push notification message and returns the predefined error and response code
-func (pcm *PushNotificationsSenderMock) PostPushNotificationMessage(response *PushNotificationHandlingResponse, message PushNotification) error {
+func (pcm *PushNotificationsSenderMock) PostPushNotificationMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error {
 	pcm.handleMessageCalled++
 	pcm.notification = message
+	pcm.notifications = append(pcm.notifications, message)
+	if pcm.onPost != nil {
+		pcm.onPost()
+	}
 	response.responseCode = pcm.responseCode
 	response.limits = pcm.limits
 	response.jsonResponseBody = pcm.responseBody
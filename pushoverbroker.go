@@ -1,29 +1,204 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
 // PushoverBroker represents the main class constructing the Pushover broker. It initializes the REST API server, processing logc & database.
 // Depends on the PushNotificationsSender interface
 type PushoverBroker struct {
+	config                  *Config
 	server                  *Server
 	processor               *Processor
+	groupRepository         GroupRepository
+	webhookDispatcher       *WebhookDispatcher // nil if there are no webhooks
 	PushNotificationsSender PushNotificationsSender
 }
 
 // NewPushoverBroker creates an instance of the PushoverBroker
-func NewPushoverBroker(port int, certFilePath string, keyFilePath string, PushNotificationsSender PushNotificationsSender) *PushoverBroker {
+func NewPushoverBroker(config *Config, PushNotificationsSender PushNotificationsSender) (*PushoverBroker, error) {
 	pb := new(PushoverBroker)
+	pb.config = config
 	pb.PushNotificationsSender = PushNotificationsSender
 
+	// open the persistent queue and the dead letters
+	messageRepository, err := NewMessageRepositoryImpl(config.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	deadLetterRepository, err := NewDeadLetterRepositoryImpl(config.DeadLetterDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// open the local groups, the groups of the configuration replace the stored ones
+	groupRepository, err := NewGroupRepositoryImpl(config.GroupDir)
+	if err != nil {
+		return nil, err
+	}
+	for name, members := range config.Groups {
+		err = validateGroup(&Group{Name: name, Members: members})
+		if err != nil {
+			return nil, fmt.Errorf("invalid group \"%s\" of the configuration: %s", name, err.Error())
+		}
+	}
+	for name, members := range config.Groups {
+		err = groupRepository.Store(&Group{Name: name, Members: members})
+		if err != nil {
+			return nil, err
+		}
+	}
+	pb.groupRepository = groupRepository
+
 	// create new message processor
-	pb.processor = NewProcessor(PushNotificationsSender, NewLimitsCounterImpl())
+	pb.processor = NewProcessor(PushNotificationsSender, NewLimitsCounterImpl(), messageRepository)
+	pb.processor.TokenVault = NewTokenVault(config.Tokens, config.Users, config.APIKeys, config.RequireVault)
+	pb.processor.RetryInterval, pb.processor.MaxRetryDelay, err = config.GetRetryDelays()
+	if err != nil {
+		return nil, err
+	}
+	pb.processor.DeadLetterRepository = deadLetterRepository
+	pb.processor.MaxQueueAge, err = config.GetMaxQueueAges()
+	if err != nil {
+		return nil, err
+	}
+	pb.processor.QuietHours, err = config.GetQuietHours()
+	if err != nil {
+		return nil, err
+	}
+	if config.DedupWindow > 0 {
+		var onSummary func(PushNotification)
+		if config.DedupSummary {
+			onSummary = pb.processor.SendDuplicatesSummary
+		}
+		pb.processor.Deduplicator = NewDeduplicator(time.Duration(config.DedupWindow), onSummary)
+	}
+	if config.DigestInterval > 0 {
+		pb.processor.DigestRepository, err = NewDigestRepositoryImpl(config.DigestDir)
+		if err != nil {
+			return nil, err
+		}
+		pb.processor.DigestInterval = time.Duration(config.DigestInterval)
+	}
+	// the acknowledgements of the escalated messages and callbacks are polled by the receipts API of the sender
+	if receiptsChecker, supported := PushNotificationsSender.(ReceiptsChecker); supported {
+		pb.processor.ReceiptsChecker = receiptsChecker
+		pb.processor.EscalationRepository, err = NewEscalationRepositoryImpl(config.EscalationDir)
+		if err != nil {
+			return nil, err
+		}
+		pb.processor.CallbackForwarder = NewCallbackForwarderImpl(config.CallbackSecret)
+	} else if len(config.Escalations) > 0 {
+		return nil, errors.New("the escalations are not supported by the push notifications sender")
+	}
+	pb.processor.EscalationPolicies, err = config.GetEscalationPolicies()
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := config.GetWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) > 0 {
+		webhookRepository, err := NewWebhookRepositoryImpl(config.WebhookDir)
+		if err != nil {
+			return nil, err
+		}
+		pb.webhookDispatcher = NewWebhookDispatcher(webhooks, webhookRepository)
+		pb.webhookDispatcher.RetryInterval = pb.processor.RetryInterval
+		pb.webhookDispatcher.MaxRetryDelay = pb.processor.MaxRetryDelay
+		pb.processor.EventListeners = append(pb.processor.EventListeners, pb.webhookDispatcher)
+	}
+	pb.processor.DeadLetterNotification, err = config.GetDeadLetterNotification()
+	if err != nil {
+		return nil, err
+	}
+
+	// the messages are routed to the recipients (by the routing rules and groups) before the processing
+	routes, err := config.GetRoutes()
+	if err != nil {
+		return nil, err
+	}
 
 	// create new HTTP server
-	pb.server = NewServer(port, certFilePath, keyFilePath, pb.processor)
-	return pb
+	pb.server = NewServer(config.Port, config.CertFile, config.KeyFile, NewRouter(pb.processor, routes, groupRepository))
+	templates, err := config.GetTemplates()
+	if err != nil {
+		return nil, err
+	}
+	pb.server.SetTemplates(templates)
+	validationRules, err := config.GetValidationRules()
+	if err != nil {
+		return nil, err
+	}
+	validationRules.ChannelRouting = len(routes) > 0
+	pb.server.SetValidationRules(validationRules)
+	if config.IdempotencyWindow > 0 {
+		pb.server.SetIdempotencyStore(NewIdempotencyStoreImpl(time.Duration(config.IdempotencyWindow)))
+	}
+
+	// the health and readiness endpoints
+	healthHandler := NewHealthHandler(messageRepository, pb.processor, pb.server, time.Duration(config.UpstreamOfflineThreshold))
+	pb.server.Handle("/healthz", http.HandlerFunc(healthHandler.ServeHealth))
+	pb.server.Handle("/readyz", http.HandlerFunc(healthHandler.ServeReadiness))
+
+	// the Prometheus metrics, the queue metrics of the broker are reported by its own registry, so that the brokers of the same
+	// process do not collide in the default registry
+	metricsRegistry := prometheus.NewRegistry()
+	err = metricsRegistry.Register(newQueueCollector(messageRepository, deadLetterRepository))
+	if err != nil {
+		return nil, err
+	}
+	pb.server.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, metricsRegistry}, promhttp.HandlerOpts{}))
+
+	// the admin API is available only if there are any administrators
+	if len(config.AdminTokens) > 0 {
+		adminHandler := NewAdminHandler(pb.processor, config.AdminTokens)
+		adminHandler.SetGroupRepository(groupRepository)
+
+		// the lifecycle events are published to the event streams of the admin API
+		eventBus := NewEventBus()
+		pb.processor.EventListeners = append(pb.processor.EventListeners, eventBus)
+		adminHandler.SetEventBus(eventBus)
+		adminHandler.Register(pb.server)
+
+		// the web dashboard operates on the admin API
+		pb.server.Handle("GET "+dashboardPath, NewDashboardHandler())
+	}
+	return pb, nil
 }
 
-// Run starts the server
+// Run starts the server. Returns only on failure.
 func (pb *PushoverBroker) Run() error {
-	pb.processor.Run()
-	pb.server.Run()
-	return nil
+
+	// if the clients should be authenticated by the certificates
+	if pb.config.ClientCAFile != "" {
+		err := pb.server.RequireClientCertificates(pb.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pb.webhookDispatcher != nil {
+		go pb.webhookDispatcher.Run()
+	}
+	go pb.processor.Run()
+	return pb.server.Run()
+}
+
+// Shutdown stops the server and the message processing of the running broker
+func (pb *PushoverBroker) Shutdown(ctx context.Context) error {
+	err := pb.server.Shutdown(ctx)
+	pb.processor.Stop()
+	if pb.webhookDispatcher != nil {
+		pb.webhookDispatcher.Stop()
+	}
+	return err
 }
@@ -2,15 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
-	"path"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -22,16 +24,22 @@ func TestBrokerAPI1MessageJSON(t *testing.T) {
 
 	// get the certificate files path
 	wd, _ := os.Getwd()
-	certFilePath := path.Join(wd, "private", "server.cert.pem")
-	keyFilePath := path.Join(wd, "private", "server.key.pem")
+	config := NewDefaultConfig(wd)
 
 	// The REST API server is initialized and connected to the message handler mock
 	pcm := NewPushNotificationsSenderMock()
 	port := 8501
-	broker := NewPushoverBroker(port, certFilePath, keyFilePath, pcm)
+	config.Port = port
+	config.QueueDir = t.TempDir()
+	config.DeadLetterDir = t.TempDir()
+	broker, err := NewPushoverBroker(config, pcm)
+	if err != nil {
+		t.Fatalf("Broker creation failed with error %s.", err)
+	}
 
 	// start the broker
 	go broker.Run()
+	defer broker.Shutdown(context.Background())
 
 	// give the HTTP server enough time to start listening for the new connections
 	time.Sleep(100 * time.Millisecond)
@@ -237,4 +245,174 @@ func TestBrokerAPI1MessageJSON(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("ShouldExposeMetrics", func(t *testing.T) {
+
+		// **** WHEN ****
+
+		// initialize the client that does not check the certificates (for testing purposes only)
+		tlsConfig := tls.Config{InsecureSkipVerify: true}
+		transport := &http.Transport{TLSClientConfig: &tlsConfig}
+		client := &http.Client{Transport: transport}
+
+		resp, err := client.Get("https://localhost:" + strconv.Itoa(port) + "/metrics")
+		if err != nil {
+			t.Errorf("GET request failed with error %s, but was expected to succeed.", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// **** THEN ****
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Errorf("GET request returned status code %d, expected 200.", resp.StatusCode)
+		}
+		for _, metric := range []string{"pushoverbroker_messages_received_total", "pushoverbroker_messages_queued_total", "pushoverbroker_queue_depth", "pushoverbroker_queue_oldest_age_seconds", "pushoverbroker_limits_remaining"} {
+			if !strings.Contains(string(body), metric) {
+				t.Errorf("The metrics do not contain %s.", metric)
+			}
+		}
+	})
+}
+
+// TestBrokersShouldExposeOwnQueueMetrics tests whether several brokers of the same process report the metrics of their own queues
+func TestBrokersShouldExposeOwnQueueMetrics(t *testing.T) {
+
+	// **** GIVEN ****
+
+	wd, _ := os.Getwd()
+	brokers := make([]*PushoverBroker, 2)
+	for i := range brokers {
+		config := NewDefaultConfig(wd)
+		config.QueueDir = t.TempDir()
+		config.DeadLetterDir = t.TempDir()
+		broker, err := NewPushoverBroker(config, NewPushNotificationsSenderMock())
+		if err != nil {
+			t.Fatalf("Creation of the broker %d failed with error %s.", i, err)
+		}
+		brokers[i] = broker
+	}
+	brokers[1].processor.MessageRepository.Store(newTestQueuedMessage("queued", "backup", "<dummy user>", time.Minute))
+
+	for i, expectedDepth := range []string{"pushoverbroker_queue_depth 0", "pushoverbroker_queue_depth 1"} {
+
+		// **** WHEN ****
+
+		response := httptest.NewRecorder()
+		brokers[i].server.mux.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+
+		// **** THEN ****
+
+		if response.Code != 200 || !strings.Contains(response.Body.String(), expectedDepth) {
+			t.Errorf("The metrics of the broker %d returned status code %d without %s.", i, response.Code, expectedDepth)
+		}
+	}
+}
+
+func TestBrokerShouldRejectInvalidConfiguredGroups(t *testing.T) {
+
+	var testcases = []struct {
+		id      string
+		name    string
+		members []GroupMember
+	}{
+		{"ShouldRejectInvalidName", "../oncall", []GroupMember{{User: "alice"}}},
+		{"ShouldRejectNoMembers", "oncall", nil},
+		{"ShouldRejectEmptyUser", "oncall", []GroupMember{{User: ""}}},
+		{"ShouldRejectNestedGroup", "oncall", []GroupMember{{User: "group:other"}}},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			wd, _ := os.Getwd()
+			config := NewDefaultConfig(wd)
+			config.QueueDir = t.TempDir()
+			config.DeadLetterDir = t.TempDir()
+			config.GroupDir = t.TempDir()
+			config.Groups = map[string][]GroupMember{"backup": {{User: "bob"}}, tc.name: tc.members}
+
+			// **** WHEN ****
+
+			broker, err := NewPushoverBroker(config, NewPushNotificationsSenderMock())
+
+			// **** THEN ****
+
+			if err == nil {
+				broker.Shutdown(context.Background())
+				t.Fatalf("Creation of the broker with the group %s %v succeeded, expected an error.", tc.name, tc.members)
+			}
+			groups, _ := os.ReadDir(config.GroupDir)
+			if len(groups) != 0 {
+				t.Errorf("%d groups stored, expected none.", len(groups))
+			}
+		})
+	}
+}
+
+func TestBrokerShouldRejectNonPositiveRetryDelays(t *testing.T) {
+
+	var testcases = []struct {
+		id            string
+		retryInterval Duration
+		maxRetryDelay Duration
+	}{
+		{"ShouldRejectZeroRetryInterval", 0, Duration(time.Hour)},
+		{"ShouldRejectNegativeRetryInterval", Duration(-time.Second), Duration(time.Hour)},
+		{"ShouldRejectZeroMaxRetryDelay", Duration(time.Second), 0},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			wd, _ := os.Getwd()
+			config := NewDefaultConfig(wd)
+			config.QueueDir = t.TempDir()
+			config.DeadLetterDir = t.TempDir()
+			config.GroupDir = t.TempDir()
+			config.RetryInterval = tc.retryInterval
+			config.MaxRetryDelay = tc.maxRetryDelay
+
+			// **** WHEN ****
+
+			broker, err := NewPushoverBroker(config, NewPushNotificationsSenderMock())
+
+			// **** THEN ****
+
+			if err == nil {
+				broker.Shutdown(context.Background())
+				t.Errorf("Creation of the broker with the retry interval %s and maximal retry delay %s succeeded, expected an error.", time.Duration(tc.retryInterval), time.Duration(tc.maxRetryDelay))
+			}
+		})
+	}
+}
+
+func TestBrokerShouldRejectDeadLetterNotificationWithoutToken(t *testing.T) {
+
+	// **** GIVEN ****
+
+	wd, _ := os.Getwd()
+	config := NewDefaultConfig(wd)
+	config.QueueDir = t.TempDir()
+	config.DeadLetterDir = t.TempDir()
+	config.GroupDir = t.TempDir()
+	config.DeadLetterNotifyUser = "martin"
+
+	// **** WHEN ****
+
+	broker, err := NewPushoverBroker(config, NewPushNotificationsSenderMock())
+
+	// **** THEN ****
+
+	if err == nil {
+		broker.Shutdown(context.Background())
+		t.Errorf("Creation of the broker notifying the dead letters without the token succeeded, expected an error.")
+	}
 }
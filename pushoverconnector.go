@@ -2,19 +2,43 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// pushoverMessagesURL is the URL of the Pushover API messages endpoint
+const pushoverMessagesURL = "https://api.pushover.net/1/messages.json"
+
+// pushoverReceiptsURL is the URL prefix of the Pushover API receipts endpoints
+const pushoverReceiptsURL = "https://api.pushover.net/1/receipts/"
+
+// pushoverReceiptResponse represents the response body of the Pushover API receipt request
+type pushoverReceiptResponse struct {
+	Status         int      `json:"status"`
+	Acknowledged   int      `json:"acknowledged"`
+	AcknowledgedAt int64    `json:"acknowledged_at"`
+	AcknowledgedBy string   `json:"acknowledged_by"`
+	Expired        int      `json:"expired"`
+	Errors         []string `json:"errors"`
+}
+
 // PushoverConnector sends push notifications to Pushover service
 type PushoverConnector struct {
-	client  *http.Client
-	encoder *schema.Encoder
+	client      *http.Client
+	encoder     *schema.Encoder
+	apiURL      string
+	receiptsURL string
 }
 
 // NewPushoverConnector creates a new pushover connector
@@ -22,11 +46,17 @@ func NewPushoverConnector() *PushoverConnector {
 	pc := new(PushoverConnector)
 	pc.client = &http.Client{}
 	pc.encoder = schema.NewEncoder()
+	pc.apiURL = pushoverMessagesURL
+	pc.receiptsURL = pushoverReceiptsURL
 	return pc
 }
 
-// PostPushNotificationMessage post a message to the Pushover server and returns error if ocurred (or nil) and response code (or 0 on POST error)
-func (pc *PushoverConnector) PostPushNotificationMessage(response *PushNotificationHandlingResponse, message PushNotification) error {
+// PostPushNotificationMessage post a message to the Pushover server and returns error if ocurred (or nil) and response code (or 0 on POST error).
+// The status code and body of any Pushover API response (including the rejections) are propagated in the response without error.
+func (pc *PushoverConnector) PostPushNotificationMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error {
+	ctx, span := getTracer().Start(ctx, "PushoverConnector.PostPushNotificationMessage", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	logger := GetLogger(ctx)
 
 	// encode message into the URL form values
 	form := url.Values{}
@@ -34,30 +64,43 @@ func (pc *PushoverConnector) PostPushNotificationMessage(response *PushNotificat
 	//if err != nil {
 	//	return fmt.Errorf("encoding of the message \"%s\" failed with error %s", message, err)
 	//}
+
+	// the broker parameters are not known to the Pushover API
+	for _, name := range brokerOnlyParameters {
+		form.Del(name)
+	}
 	formStr := form.Encode()
 
 	// Prepare the POST request with form data
-	url := "https://api.pushover.net/1/messages.json"
-	req, err := http.NewRequest("POST", url, bytes.NewBufferString(formStr))
+	url := pc.apiURL
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(formStr))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Content-Length", strconv.Itoa(len(formStr)))
 
+	// post the request and measure the latency
+	requestStart := time.Now()
 	resp, err := pc.client.Do(req)
 	if err != nil {
+		pushoverAPILatency.WithLabelValues("0").Observe(time.Since(requestStart).Seconds())
 		response.responseCode = 0
 		response.limits = nil
-		return fmt.Errorf("sending the Pushover API POST request at %s with foorm \"%s\" failed with error %s", url, form, err)
+		return recordSpanError(span, fmt.Errorf("sending the Pushover API POST request at %s with form \"%s\" failed with error %s", url, RedactForm(form).Encode(), err))
 	}
 	defer resp.Body.Close()
 
 	// get the body
 	body, _ := ioutil.ReadAll(resp.Body)
+	pushoverAPILatency.WithLabelValues(strconv.Itoa(resp.StatusCode)).Observe(time.Since(requestStart).Seconds())
+	span.SetAttributes(attribute.Int(traceKeyStatusCode, resp.StatusCode))
 
-	// the request should respond correctly
+	// if the request was not accepted, propagate the status and body, the limits are provided only on success
 	if resp.StatusCode != 200 {
-		response.responseCode = 0
+		span.SetStatus(codes.Error, "the Pushover API POST request was not accepted")
+		logger.Warn("The Pushover API POST request was not accepted.", logKeyStatusCode, resp.StatusCode, "form", RedactForm(form).Encode(), "body", string(body))
+		response.responseCode = resp.StatusCode
 		response.limits = nil
-		return fmt.Errorf("processing of the Pushover API POST request at %s with form \"%s\" returned status code %d, status message %s, body \"%s\"", url, form, resp.StatusCode, resp.Status, string(body))
+		response.jsonResponseBody = string(body)
+		return nil
 	}
 
 	// get the response header values
@@ -68,21 +111,89 @@ func (pc *PushoverConnector) PostPushNotificationMessage(response *PushNotificat
 	// convert the limits to numbers
 	limitValueInt, err := strconv.Atoi(limitValue)
 	if err != nil {
-		fmt.Printf("Obtained X-Limit-App-Limit value \"%s\" failed to be converted to number with error \"%s\".", limitValue, err.Error())
+		logger.Warn("Obtained X-Limit-App-Limit value failed to be converted to number.", "value", limitValue, logKeyError, err)
 	}
 	remainingValueInt, err := strconv.Atoi(remainingValue)
 	if err != nil {
-		fmt.Printf("Obtained X-Limit-App-Remaining value \"%s\" failed to be converted to number with error \"%s\".", remainingValue, err.Error())
+		logger.Warn("Obtained X-Limit-App-Remaining value failed to be converted to number.", "value", remainingValue, logKeyError, err)
 	}
 	resetValueInt, err := strconv.Atoi(resetValue)
 	if err != nil {
-		fmt.Printf("Obtained X-Limit-App-Reset value \"%s\" failed to be converted to number with error \"%s\".", resetValue, err.Error())
+		logger.Warn("Obtained X-Limit-App-Reset value failed to be converted to number.", "value", resetValue, logKeyError, err)
 	}
 	response.limits = &Limits{limitValueInt, remainingValueInt, resetValueInt}
-	response.responseCode = 0
+	response.responseCode = resp.StatusCode
 	response.jsonResponseBody = string(body)
 
-	//t.Logf("POST request response body '%s'.", string(body))
+	return nil
+}
 
+// GetReceipt returns the state of the emergency message given by the receipt (see ReceiptsChecker). The token is passed in the query,
+// so it is not part of the returned errors.
+func (pc *PushoverConnector) GetReceipt(ctx context.Context, token string, receipt string) (*Receipt, error) {
+	ctx, span := getTracer().Start(ctx, "PushoverConnector.GetReceipt", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	receiptURL := pc.receiptsURL + url.PathEscape(receipt) + ".json"
+	req, err := http.NewRequestWithContext(ctx, "GET", receiptURL+"?"+url.Values{"token": {token}}.Encode(), nil)
+	if err != nil {
+		return nil, recordSpanError(span, fmt.Errorf("creating of the Pushover API receipt request at %s failed with error %s", receiptURL, err.Error()))
+	}
+	body, statusCode, err := pc.doReceiptRequest(req)
+	if err != nil {
+		return nil, recordSpanError(span, fmt.Errorf("sending the Pushover API receipt request at %s failed with error %s", receiptURL, err.Error()))
+	}
+	span.SetAttributes(attribute.Int(traceKeyStatusCode, statusCode))
+
+	var receiptResponse pushoverReceiptResponse
+	err = json.Unmarshal(body, &receiptResponse)
+	if err != nil || statusCode != 200 || receiptResponse.Status != 1 {
+		return nil, recordSpanError(span, fmt.Errorf("the Pushover API receipt request at %s failed with status code %d and response %s", receiptURL, statusCode, string(body)))
+	}
+	result := &Receipt{Acknowledged: receiptResponse.Acknowledged == 1, AcknowledgedBy: receiptResponse.AcknowledgedBy, Expired: receiptResponse.Expired == 1}
+	if receiptResponse.AcknowledgedAt > 0 {
+		result.AcknowledgedAt = time.Unix(receiptResponse.AcknowledgedAt, 0)
+	}
+	return result, nil
+}
+
+// CancelReceipt stops the repeated notifications of the emergency message given by the receipt (see ReceiptsChecker)
+func (pc *PushoverConnector) CancelReceipt(ctx context.Context, token string, receipt string) error {
+	ctx, span := getTracer().Start(ctx, "PushoverConnector.CancelReceipt", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	cancelURL := pc.receiptsURL + url.PathEscape(receipt) + "/cancel.json"
+	formStr := url.Values{"token": {token}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", cancelURL, bytes.NewBufferString(formStr))
+	if err != nil {
+		return recordSpanError(span, fmt.Errorf("creating of the Pushover API receipt cancel request at %s failed with error %s", cancelURL, err.Error()))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, statusCode, err := pc.doReceiptRequest(req)
+	if err != nil {
+		return recordSpanError(span, fmt.Errorf("sending the Pushover API receipt cancel request at %s failed with error %s", cancelURL, err.Error()))
+	}
+	span.SetAttributes(attribute.Int(traceKeyStatusCode, statusCode))
+	if statusCode != 200 {
+		return recordSpanError(span, fmt.Errorf("the Pushover API receipt cancel request at %s failed with status code %d and response %s", cancelURL, statusCode, string(body)))
+	}
 	return nil
 }
+
+// sends the receipts API request and returns the response body and status code, the latency is measured as of the messages
+func (pc *PushoverConnector) doReceiptRequest(req *http.Request) ([]byte, int, error) {
+	requestStart := time.Now()
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		pushoverAPILatency.WithLabelValues("0").Observe(time.Since(requestStart).Seconds())
+		// the error of the client contains the URL with the token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	pushoverAPILatency.WithLabelValues(strconv.Itoa(resp.StatusCode)).Observe(time.Since(requestStart).Seconds())
+	return body, resp.StatusCode, nil
+}
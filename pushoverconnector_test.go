@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// starts a fake Pushover API responding with the given status code, limits headers and body
+func newFakePushoverAPI(statusCode int, limitsHeaders bool, body string) (*httptest.Server, *PushoverConnector) {
+	pushoverAPI := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitsHeaders {
+			w.Header().Set("X-Limit-App-Limit", "10000")
+			w.Header().Set("X-Limit-App-Remaining", "7496")
+			w.Header().Set("X-Limit-App-Reset", "1393653600")
+		}
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	}))
+	pc := NewPushoverConnector()
+	pc.client = pushoverAPI.Client()
+	pc.apiURL = pushoverAPI.URL
+	return pushoverAPI, pc
+}
+
+func TestPushoverConnectorShouldPropagateResponse(t *testing.T) {
+
+	var testcases = []struct {
+		id             string
+		statusCode     int
+		limitsHeaders  bool
+		body           string
+		expectedLimits *Limits
+	}{
+		{"ShouldPropagateSuccess", 200, true, "{\"status\":1,\"request\":\"647d2300-702c-4b38-8b2f-d56326ae460b\"}", &Limits{limit: 10000, remaining: 7496, reset: 1393653600}},
+		{"ShouldPropagateRejection", 400, false, "{\"token\":\"invalid\",\"errors\":[\"application token is invalid\"],\"status\":0}", nil},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			pushoverAPI, pc := newFakePushoverAPI(tc.statusCode, tc.limitsHeaders, tc.body)
+			defer pushoverAPI.Close()
+
+			// WHEN
+			var response = PushNotificationHandlingResponse{}
+			err := pc.PostPushNotificationMessage(context.Background(), &response, PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"})
+
+			// THEN
+			if err != nil {
+				t.Errorf("Posting failed with error %s, expected no error.", err)
+				return
+			}
+			if response.responseCode != tc.statusCode || response.jsonResponseBody != tc.body {
+				t.Errorf("Response code %d and body \"%s\" returned, expected %d and \"%s\".", response.responseCode, response.jsonResponseBody, tc.statusCode, tc.body)
+			}
+			if (response.limits == nil) != (tc.expectedLimits == nil) || (response.limits != nil && *response.limits != *tc.expectedLimits) {
+				t.Errorf("Limits %v returned, expected %v.", response.limits, tc.expectedLimits)
+			}
+		})
+	}
+}
+
+func TestPushoverConnectorErrorsShouldNotContainSecrets(t *testing.T) {
+
+	// GIVEN
+	message := PushNotification{Token: "azGDORePK8gMaC0QOYAMyEEuzJnyUi", User: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG", Message: "backup finished"}
+
+	// the unreachable Pushover API
+	pc := NewPushoverConnector()
+	pc.apiURL = "https://127.0.0.1:1/1/messages.json"
+
+	// WHEN
+	var response = PushNotificationHandlingResponse{}
+	err := pc.PostPushNotificationMessage(context.Background(), &response, message)
+
+	// THEN
+	if err == nil {
+		t.Errorf("Posting succeeded, expected error.")
+		return
+	}
+	if strings.Contains(err.Error(), message.Token) || strings.Contains(err.Error(), message.User) {
+		t.Errorf("Error \"%s\" contains the secrets.", err)
+	}
+}
+
+func TestPushoverConnectorShouldNotForwardBrokerParameters(t *testing.T) {
+
+	var testcases = []struct {
+		id           string
+		message      PushNotification
+		expectedForm string
+	}{
+		{"ShouldOmitDefaultPriority", PushNotification{Token: "<token>", User: "<user>", Message: "hello"}, "message=hello&token=%3Ctoken%3E&user=%3Cuser%3E"},
+		{"ShouldForwardPriority", PushNotification{Token: "<token>", User: "<user>", Message: "hello", Priority: 2, Retry: 60, Expire: 3600}, "expire=3600&message=hello&priority=2&retry=60&token=%3Ctoken%3E&user=%3Cuser%3E"},
+		{"ShouldStripBrokerExpire", PushNotification{Token: "<token>", User: "<user>", Message: "hello", BrokerExpire: 3600}, "message=hello&token=%3Ctoken%3E&user=%3Cuser%3E"},
+		{"ShouldStripEscalation", PushNotification{Token: "<token>", User: "<user>", Message: "hello", Priority: 2, Escalation: "db", BrokerCallback: "https://inventory.internal/ack"}, "message=hello&priority=2&token=%3Ctoken%3E&user=%3Cuser%3E"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			receivedForm := ""
+			pushoverAPI := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				receivedForm = r.PostForm.Encode()
+			}))
+			defer pushoverAPI.Close()
+			pc := NewPushoverConnector()
+			pc.client = pushoverAPI.Client()
+			pc.apiURL = pushoverAPI.URL
+
+			// WHEN
+			var response = PushNotificationHandlingResponse{}
+			err := pc.PostPushNotificationMessage(context.Background(), &response, tc.message)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("Posting failed with error %s, expected no error.", err)
+			}
+			if receivedForm != tc.expectedForm {
+				t.Errorf("Form \"%s\" received by the Pushover API, expected \"%s\".", receivedForm, tc.expectedForm)
+			}
+		})
+	}
+}
+
+func TestPushoverConnectorShouldCheckReceipts(t *testing.T) {
+
+	var testcases = []struct {
+		id              string
+		statusCode      int
+		body            string
+		expectedReceipt *Receipt
+		expectedErr     bool
+	}{
+		{"ShouldReturnAcknowledged", 200, "{\"status\":1,\"acknowledged\":1,\"acknowledged_at\":1767258000,\"acknowledged_by\":\"uQiRzpo4DXghDmr9QzzfQu27cmVRsG\",\"expired\":0}", &Receipt{Acknowledged: true, AcknowledgedAt: time.Unix(1767258000, 0), AcknowledgedBy: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG"}, false},
+		{"ShouldReturnExpired", 200, "{\"status\":1,\"acknowledged\":0,\"acknowledged_at\":0,\"expired\":1}", &Receipt{Expired: true}, false},
+		{"ShouldFailOnRejection", 400, "{\"receipt\":\"not found\",\"status\":0}", nil, true},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			requests := []string{}
+			pushoverAPI := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Form.Get("token"))
+				w.WriteHeader(tc.statusCode)
+				w.Write([]byte(tc.body))
+			}))
+			defer pushoverAPI.Close()
+			pc := NewPushoverConnector()
+			pc.client = pushoverAPI.Client()
+			pc.receiptsURL = pushoverAPI.URL + "/1/receipts/"
+
+			// WHEN
+			receipt, err := pc.GetReceipt(context.Background(), "azGDORePK8gMaC0QOYAMyEEuzJnyUi", "r1")
+			cancelErr := pc.CancelReceipt(context.Background(), "azGDORePK8gMaC0QOYAMyEEuzJnyUi", "r1")
+
+			// THEN
+			if (err != nil) != tc.expectedErr || (cancelErr != nil) != tc.expectedErr {
+				t.Fatalf("Receipt requests failed with errors %v and %v, expected error %t.", err, cancelErr, tc.expectedErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "azGDORePK8gMaC0QOYAMyEEuzJnyUi") {
+				t.Errorf("Error \"%s\" contains the token.", err)
+			}
+			if (receipt == nil) != (tc.expectedReceipt == nil) || (receipt != nil && *receipt != *tc.expectedReceipt) {
+				t.Errorf("Receipt %v returned, expected %v.", receipt, tc.expectedReceipt)
+			}
+			expectedRequests := "GET /1/receipts/r1.json azGDORePK8gMaC0QOYAMyEEuzJnyUi,POST /1/receipts/r1/cancel.json azGDORePK8gMaC0QOYAMyEEuzJnyUi"
+			if strings.Join(requests, ",") != expectedRequests {
+				t.Errorf("Requests %v received by the Pushover API, expected %s.", requests, expectedRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// the actions applied on the messages received during the quiet hours
+const (
+	quietHoursActionDefer     = "defer"     // the message is held in the queue until the end of the quiet hours
+	quietHoursActionDowngrade = "downgrade" // the message is delivered immediately with the quiet priority (-1)
+)
+
+// QuietHours represents the daily time window of a user during which the non-emergency messages are deferred or downgraded
+type QuietHours struct {
+	start    int // minutes since the midnight
+	end      int // minutes since the midnight, the window passes the midnight if lower than start
+	location *time.Location
+	action   string
+}
+
+// NewQuietHours creates the quiet hours from start to end ("22:00" and "07:00") in the time zone ("Europe/Prague", the local
+// time zone if empty). The action is either "defer" (default) or "downgrade".
+func NewQuietHours(start string, end string, timezone string, action string) (*QuietHours, error) {
+	q := new(QuietHours)
+	var err error
+	q.start, err = parseTimeOfDay(start)
+	if err != nil {
+		return nil, err
+	}
+	q.end, err = parseTimeOfDay(end)
+	if err != nil {
+		return nil, err
+	}
+	q.location = time.Local
+	if timezone != "" {
+		q.location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("loading of the quiet hours time zone \"%s\" failed with error %s", timezone, err.Error())
+		}
+	}
+	switch action {
+	case "":
+		q.action = quietHoursActionDefer
+	case quietHoursActionDefer, quietHoursActionDowngrade:
+		q.action = action
+	default:
+		return nil, fmt.Errorf("unsupported quiet hours action \"%s\", expected \"defer\" or \"downgrade\"", action)
+	}
+	return q, nil
+}
+
+// GetEnd returns the end of the quiet hours if the time is within them, otherwise returns zero time
+func (q *QuietHours) GetEnd(at time.Time) time.Time {
+	local := at.In(q.location)
+	minutes := local.Hour()*60 + local.Minute()
+	var quiet bool
+	if q.start <= q.end {
+		quiet = minutes >= q.start && minutes < q.end
+	} else {
+		quiet = minutes >= q.start || minutes < q.end
+	}
+	if !quiet {
+		return time.Time{}
+	}
+
+	// the end is today or tomorrow if the window passes the midnight
+	end := time.Date(local.Year(), local.Month(), local.Day(), q.end/60, q.end%60, 0, 0, q.location)
+	if !end.After(local) {
+		end = time.Date(local.Year(), local.Month(), local.Day()+1, q.end/60, q.end%60, 0, 0, q.location)
+	}
+	return end
+}
+
+// returns the minutes since the midnight of the time of the day in the "15:04" format
+func parseTimeOfDay(value string) (int, error) {
+	timeOfDay, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day \"%s\", expected HH:MM", value)
+	}
+	return timeOfDay.Hour()*60 + timeOfDay.Minute(), nil
+}
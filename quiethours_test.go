@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursShouldReturnEndWithinWindow(t *testing.T) {
+
+	prague, _ := time.LoadLocation("Europe/Prague")
+
+	var testcases = []struct {
+		id          string
+		start       string
+		end         string
+		at          time.Time
+		expectedEnd time.Time
+	}{
+		{"ShouldBeQuietBeforeMidnight", "22:00", "07:00", time.Date(2026, 3, 10, 23, 30, 0, 0, prague), time.Date(2026, 3, 11, 7, 0, 0, 0, prague)},
+		{"ShouldBeQuietAfterMidnight", "22:00", "07:00", time.Date(2026, 3, 11, 6, 59, 0, 0, prague), time.Date(2026, 3, 11, 7, 0, 0, 0, prague)},
+		{"ShouldNotBeQuietAtEnd", "22:00", "07:00", time.Date(2026, 3, 11, 7, 0, 0, 0, prague), time.Time{}},
+		{"ShouldNotBeQuietDuringDay", "22:00", "07:00", time.Date(2026, 3, 11, 12, 0, 0, 0, prague), time.Time{}},
+		{"ShouldBeQuietWithinDay", "12:00", "14:00", time.Date(2026, 3, 11, 12, 0, 0, 0, prague), time.Date(2026, 3, 11, 14, 0, 0, 0, prague)},
+		{"ShouldUseTimezone", "22:00", "07:00", time.Date(2026, 3, 10, 21, 30, 0, 0, time.UTC), time.Date(2026, 3, 11, 7, 0, 0, 0, prague)},
+		{"ShouldFollowDaylightSavingTime", "22:00", "07:00", time.Date(2026, 3, 28, 23, 0, 0, 0, prague), time.Date(2026, 3, 29, 7, 0, 0, 0, prague)},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			quietHours, err := NewQuietHours(tc.start, tc.end, "Europe/Prague", "")
+			if err != nil {
+				t.Fatalf("Creation of the quiet hours failed with error %s.", err)
+			}
+
+			// WHEN
+			end := quietHours.GetEnd(tc.at)
+
+			// THEN
+			if !end.Equal(tc.expectedEnd) {
+				t.Errorf("End %s returned, expected %s.", end, tc.expectedEnd)
+			}
+		})
+	}
+}
+
+func TestQuietHoursShouldRejectInvalidConfiguration(t *testing.T) {
+
+	var testcases = []struct {
+		id       string
+		start    string
+		end      string
+		timezone string
+		action   string
+	}{
+		{"ShouldRejectInvalidStart", "10pm", "07:00", "Europe/Prague", ""},
+		{"ShouldRejectInvalidEnd", "22:00", "25:00", "Europe/Prague", ""},
+		{"ShouldRejectUnknownTimezone", "22:00", "07:00", "Europe/Atlantis", ""},
+		{"ShouldRejectUnknownAction", "22:00", "07:00", "Europe/Prague", "drop"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// WHEN
+			_, err := NewQuietHours(tc.start, tc.end, tc.timezone, tc.action)
+
+			// THEN
+			if err == nil {
+				t.Error("The quiet hours were created, expected error.")
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Receipt represents the state of the emergency message notifications as reported by the Pushover receipts API
+type Receipt struct {
+	Acknowledged   bool
+	AcknowledgedAt time.Time // zero if not acknowledged
+	AcknowledgedBy string    // user key of the user acknowledging the message
+	Expired        bool      // the notifications stopped without the acknowledgement
+}
+
+// ReceiptsChecker represents the connector to the Pushover receipts API
+type ReceiptsChecker interface {
+	// GetReceipt returns the state of the emergency message given by the receipt of the application token
+	GetReceipt(ctx context.Context, token string, receipt string) (*Receipt, error)
+
+	// CancelReceipt stops the repeated notifications of the emergency message given by the receipt
+	CancelReceipt(ctx context.Context, token string, receipt string) error
+}
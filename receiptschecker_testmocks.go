@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ReceiptsCheckerMock implements the ReceiptsChecker interface
+type ReceiptsCheckerMock struct {
+	receipts  map[string]*Receipt // receipt -> state returned by GetReceipt, not acknowledged if not present
+	cancelled []string            // receipts cancelled by CancelReceipt
+	offline   bool                // all the calls fail
+}
+
+// NewReceiptsCheckerMock initializes the mock
+func NewReceiptsCheckerMock() *ReceiptsCheckerMock {
+	rcm := new(ReceiptsCheckerMock)
+	rcm.receipts = make(map[string]*Receipt)
+	return rcm
+}
+
+// GetReceipt returns the predefined state of the receipt
+func (rcm *ReceiptsCheckerMock) GetReceipt(ctx context.Context, token string, receipt string) (*Receipt, error) {
+	if rcm.offline {
+		return nil, errors.New("offline")
+	}
+	if state, found := rcm.receipts[receipt]; found {
+		return state, nil
+	}
+	return &Receipt{}, nil
+}
+
+// CancelReceipt records the cancelled receipt
+func (rcm *ReceiptsCheckerMock) CancelReceipt(ctx context.Context, token string, receipt string) error {
+	if rcm.offline {
+		return errors.New("offline")
+	}
+	rcm.cancelled = append(rcm.cancelled, receipt)
+	return nil
+}
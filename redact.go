@@ -0,0 +1,45 @@
+package main
+
+import "net/url"
+
+// redactedPrefixLength is the number of the leading characters of a secret left visible by the redaction
+const redactedPrefixLength = 4
+
+// redactionMask replaces the hidden part of the secret
+const redactionMask = "****"
+
+// secretFormFields are the names of the form fields carrying the secrets
+var secretFormFields = []string{"token", "user"}
+
+// RedactSecret masks the secret so that it can be logged or returned to the client. Only the first few characters are kept,
+// the short secrets are masked completely.
+func RedactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 2*redactedPrefixLength {
+		return redactionMask
+	}
+	return secret[:redactedPrefixLength] + redactionMask
+}
+
+// RedactForm returns a copy of the form values with the secrets masked
+func RedactForm(form url.Values) url.Values {
+	redacted := url.Values{}
+	for name, values := range form {
+		redacted[name] = append([]string(nil), values...)
+	}
+	for _, name := range secretFormFields {
+		for i, value := range redacted[name] {
+			redacted[name][i] = RedactSecret(value)
+		}
+	}
+	return redacted
+}
+
+// RedactNotification returns a copy of the notification with the token and user key masked
+func RedactNotification(notification PushNotification) PushNotification {
+	notification.Token = RedactSecret(notification.Token)
+	notification.User = RedactSecret(notification.User)
+	return notification
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecret(t *testing.T) {
+
+	var testcases = []struct {
+		id       string
+		secret   string
+		expected string
+	}{
+		{"ShouldKeepEmptyValue", "", ""},
+		{"ShouldMaskShortSecretCompletely", "abcdefg", "****"},
+		{"ShouldKeepPrefixOfLongSecret", "azGDORePK8gMaC0QOYAMyEEuzJnyUi", "azGD****"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// WHEN
+			redacted := RedactSecret(tc.secret)
+
+			// THEN
+			if redacted != tc.expected {
+				t.Errorf("Secret \"%s\" redacted to \"%s\", expected \"%s\".", tc.secret, redacted, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRedactFormShouldMaskSecretsAndKeepOriginal(t *testing.T) {
+
+	// GIVEN
+	form := url.Values{}
+	form.Set("token", "azGDORePK8gMaC0QOYAMyEEuzJnyUi")
+	form.Set("user", "uQiRzpo4DXghDmr9QzzfQu27cmVRsG")
+	form.Set("message", "backup finished")
+
+	// WHEN
+	redacted := RedactForm(form)
+
+	// THEN
+	if encoded := redacted.Encode(); strings.Contains(encoded, "azGDORePK8gMaC0QOYAMyEEuzJnyUi") || strings.Contains(encoded, "uQiRzpo4DXghDmr9QzzfQu27cmVRsG") {
+		t.Errorf("Redacted form \"%s\" contains the secrets.", encoded)
+	}
+	if redacted.Get("message") != "backup finished" {
+		t.Errorf("Redacted form message \"%s\", expected the original value.", redacted.Get("message"))
+	}
+	if form.Get("token") != "azGDORePK8gMaC0QOYAMyEEuzJnyUi" {
+		t.Errorf("The original form was modified by the redaction.")
+	}
+}
+
+func TestDumpToStringShouldNotContainSecrets(t *testing.T) {
+
+	// GIVEN
+	message := PushNotification{Token: "azGDORePK8gMaC0QOYAMyEEuzJnyUi", User: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG", Message: "backup finished"}
+
+	// WHEN
+	dump := message.DumpToString()
+
+	// THEN
+	if strings.Contains(dump, message.Token) || strings.Contains(dump, message.User) {
+		t.Errorf("Dump \"%s\" contains the secrets.", dump)
+	}
+}
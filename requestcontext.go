@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// requestContextKey is the type of the keys of the values stored in the request context
+type requestContextKey int
+
+const (
+	clientSubjectKey requestContextKey = iota
+	requestIDKey
+	adminKey
+	parentRequestIDKey
+)
+
+// NewRequestID generates a new random request identifier
+func NewRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithClientSubject returns a copy of the context carrying the subject of the verified client certificate
+func WithClientSubject(ctx context.Context, clientSubject string) context.Context {
+	return context.WithValue(ctx, clientSubjectKey, clientSubject)
+}
+
+// GetClientSubject returns the subject of the verified client certificate or empty string if the client was not authenticated by a certificate
+func GetClientSubject(ctx context.Context) string {
+	clientSubject, _ := ctx.Value(clientSubjectKey).(string)
+	return clientSubject
+}
+
+// WithRequestID returns a copy of the context carrying the request identifier
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// GetRequestID returns the request identifier or empty string if there is none
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithParentRequestID returns a copy of the context carrying the identifier of the request the message was routed from
+func WithParentRequestID(ctx context.Context, parentRequestID string) context.Context {
+	return context.WithValue(ctx, parentRequestIDKey, parentRequestID)
+}
+
+// GetParentRequestID returns the identifier of the request the message was routed from or empty string if the message was not routed
+func GetParentRequestID(ctx context.Context) string {
+	parentRequestID, _ := ctx.Value(parentRequestIDKey).(string)
+	return parentRequestID
+}
+
+// WithAdmin returns a copy of the context carrying the name of the authenticated administrator
+func WithAdmin(ctx context.Context, admin string) context.Context {
+	return context.WithValue(ctx, adminKey, admin)
+}
+
+// GetAdmin returns the name of the authenticated administrator or empty string if the request is not an admin API request
+func GetAdmin(ctx context.Context) string {
+	admin, _ := ctx.Value(adminKey).(string)
+	return admin
+}
+
+// GetLogger returns the default logger with the request identifier, client and administrator attributes of the context
+func GetLogger(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if requestID := GetRequestID(ctx); requestID != "" {
+		logger = logger.With(logKeyRequestID, requestID)
+	}
+	if parentRequestID := GetParentRequestID(ctx); parentRequestID != "" {
+		logger = logger.With(logKeyParentRequestID, parentRequestID)
+	}
+	if clientSubject := GetClientSubject(ctx); clientSubject != "" {
+		logger = logger.With(logKeyClient, clientSubject)
+	}
+	if admin := GetAdmin(ctx); admin != "" {
+		logger = logger.With(logKeyAdmin, admin)
+	}
+	return logger
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Route represents a routing rule expanding the matching messages to the additional recipients
+type Route struct {
+	channel     string // the channel of the message, any channel if empty
+	minPriority *int   // minimal priority of the message, any priority if nil
+	users       []string
+	device      string // device(s) of the users, all the devices if empty
+}
+
+// NewRoute creates a new routing rule. The message matches if it has the channel (any if empty) and at least the minimal
+// priority (any if nil), the matching message is sent to all the users (keys or aliases) on the device (all if empty).
+func NewRoute(channel string, minPriority *int, users []string, device string) *Route {
+	r := new(Route)
+	r.channel = channel
+	r.minPriority = minPriority
+	r.users = users
+	r.device = device
+	return r
+}
+
+// returns true if the rule applies to the message
+func (r *Route) matches(message PushNotification) bool {
+	if r.channel != "" && r.channel != message.Channel {
+		return false
+	}
+	if r.minPriority != nil && message.Priority < *r.minPriority {
+		return false
+	}
+	return true
+}
+
+// routeTarget represents a recipient of the routed message
+type routeTarget struct {
+	user   string
+	device string
+}
+
+// routedResponseBody represents the response body of the message routed to several recipients
+type routedResponseBody struct {
+	Status     int               `json:"status"`
+	Request    string            `json:"request"`
+	Requests   []string          `json:"requests"`
+	Recipients []routedRecipient `json:"recipients"`
+	Errors     []string          `json:"errors,omitempty"`
+}
+
+// routedRecipient represents the result of the message of a single recipient in the routed response body
+type routedRecipient struct {
+	Request    string `json:"request"`
+	StatusCode int    `json:"status_code"` // 200 if delivered, 202 if queued, the failure status code otherwise
+}
+
+// errUnknownGroup is returned if the message is addressed to a group not present in the group repository
+var errUnknownGroup = errors.New("unknown group")
+
+// Router expands every incomming message into one message per recipient by the routing rules and passes them to the message
+// handler (see IncommingPushNotificationMessageHandler). The recipients are the user of the message (if any) and the users of
+// all the matching rules, the groups (group:<name>) are expanded to their members. The messages of several recipients are
+// handled (and queued) separately, each has its own request identifier derived from the request identifier of the incomming message.
+type Router struct {
+	messageHandler  IncommingPushNotificationMessageHandler
+	routes          []*Route
+	groupRepository GroupRepository // nil if the groups are not supported
+}
+
+// NewRouter creates a new router passing the routed messages to the message handler, the groupRepository may be nil
+func NewRouter(messageHandler IncommingPushNotificationMessageHandler, routes []*Route, groupRepository GroupRepository) *Router {
+	r := new(Router)
+	r.messageHandler = messageHandler
+	r.routes = routes
+	r.groupRepository = groupRepository
+	return r
+}
+
+// HandleMessage routes the message to its recipients (see IncommingPushNotificationMessageHandler interface)
+func (r *Router) HandleMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error {
+	requestID := GetRequestID(ctx)
+	if requestID == "" {
+		requestID = NewRequestID()
+		ctx = WithRequestID(ctx, requestID)
+	}
+	ctx, span := getTracer().Start(ctx, "Router.HandleMessage")
+	defer span.End()
+	logger := GetLogger(ctx)
+
+	// collect the recipients
+	targets, err := r.getTargets(message)
+	if errors.Is(err, errUnknownGroup) {
+		logger.Warn("Message addressed to an unknown group.", logKeyError, err)
+		response.responseCode = http.StatusBadRequest
+		response.limits = nil
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"%s\"] }", requestID, err.Error())
+		return nil
+	}
+	if err != nil {
+		return recordSpanError(span, err)
+	}
+	span.SetAttributes(attribute.Int("pushoverbroker.targets", len(targets)))
+	switch len(targets) {
+	case 0:
+		logger.Warn("No route found for the message.", "channel", message.Channel)
+		response.responseCode = http.StatusBadRequest
+		response.limits = nil
+		response.jsonResponseBody = fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\": [\"no recipient of the channel '%s'\"] }", requestID, message.Channel)
+		return nil
+
+	case 1:
+		// the single recipient keeps the request identifier
+		message.User = targets[0].user
+		message.Device = targets[0].device
+		return r.messageHandler.HandleMessage(ctx, response, message)
+	}
+
+	// handle the message of every recipient separately, the response is 200 if all were delivered and 202 if all were
+	// delivered or accepted. If only some of the recipients failed, the response is 200 with the status of every recipient,
+	// so that the client does not repeat the message to the others. The request fails only if no recipient got the message.
+	logger.Info("Routing the message to several recipients.", "targets", len(targets))
+	body := routedResponseBody{Status: 1, Request: requestID}
+	response.responseCode = http.StatusOK
+	response.limits = nil
+	failedResponseCode := 0
+	failures := 0
+	for i, target := range targets {
+		targetRequestID := fmt.Sprintf("%s-%d", requestID, i+1)
+		targetCtx := WithParentRequestID(WithRequestID(ctx, targetRequestID), requestID)
+		targetMessage := message
+		targetMessage.User = target.user
+		targetMessage.Device = target.device
+		body.Requests = append(body.Requests, targetRequestID)
+
+		var targetResponse = PushNotificationHandlingResponse{}
+		err := r.messageHandler.HandleMessage(targetCtx, &targetResponse, targetMessage)
+		if err != nil {
+			logger.Error("Handling of the routed message failed.", "target_request_id", targetRequestID, logKeyError, err)
+			targetResponse.responseCode = http.StatusInternalServerError
+		}
+		if targetResponse.limits != nil {
+			response.limits = targetResponse.limits
+		}
+		body.Recipients = append(body.Recipients, routedRecipient{Request: targetRequestID, StatusCode: targetResponse.responseCode})
+		switch {
+		case targetResponse.responseCode >= 300:
+			body.Errors = append(body.Errors, fmt.Sprintf("%s: status code %d", targetRequestID, targetResponse.responseCode))
+			failures++
+			if failedResponseCode == 0 {
+				failedResponseCode = targetResponse.responseCode
+			}
+		case targetResponse.responseCode == http.StatusAccepted:
+			response.responseCode = http.StatusAccepted
+		}
+	}
+	switch {
+	case failures == len(targets):
+		body.Status = 0
+		response.responseCode = failedResponseCode
+
+	case failures > 0:
+		logger.Warn("The routed message failed for some of the recipients.", "failed_targets", failures)
+		response.responseCode = http.StatusOK
+	}
+	jsonResponseBody, err := json.Marshal(body)
+	if err != nil {
+		return recordSpanError(span, err)
+	}
+	response.jsonResponseBody = string(jsonResponseBody)
+	return nil
+}
+
+// returns the distinct recipients of the message, the user of the message first
+func (r *Router) getTargets(message PushNotification) ([]routeTarget, error) {
+	var targets []routeTarget
+	known := make(map[routeTarget]bool)
+	addTarget := func(target routeTarget) error {
+
+		// expand the group to its members, the device of the member takes precedence
+		if groupName, isGroup := strings.CutPrefix(target.user, groupUserPrefix); isGroup {
+			group, err := r.getGroup(groupName)
+			if err != nil {
+				return err
+			}
+			for _, member := range group.Members {
+				memberTarget := routeTarget{user: member.User, device: target.device}
+				if member.Device != "" {
+					memberTarget.device = member.Device
+				}
+				if !known[memberTarget] {
+					known[memberTarget] = true
+					targets = append(targets, memberTarget)
+				}
+			}
+			return nil
+		}
+		if !known[target] {
+			known[target] = true
+			targets = append(targets, target)
+		}
+		return nil
+	}
+
+	if message.User != "" {
+		err := addTarget(routeTarget{user: message.User, device: message.Device})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range r.routes {
+		if route.matches(message) {
+			for _, user := range route.users {
+				err := addTarget(routeTarget{user: user, device: route.device})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+// returns the group of the name, errUnknownGroup if there is no such group
+func (r *Router) getGroup(name string) (*Group, error) {
+	if r.groupRepository == nil || checkStoreID(name) != nil {
+		return nil, fmt.Errorf("%w %s", errUnknownGroup, name)
+	}
+	group, err := r.groupRepository.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, fmt.Errorf("%w %s", errUnknownGroup, name)
+	}
+	return group, nil
+}
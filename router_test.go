@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRouterShouldExpandMessageToRecipients(t *testing.T) {
+
+	highPriority := priorityHigh
+	routes := []*Route{
+		NewRoute("db-alerts", nil, []string{"alice", "bob"}, "phone"),
+		NewRoute("", &highPriority, []string{"oncall"}, ""),
+	}
+
+	var testcases = []struct {
+		id                   string
+		message              PushNotification
+		userResponseCodes    map[string]int
+		expectedTargets      string // user/device of the handled messages
+		expectedResponseCode int
+	}{
+		{"ShouldPassUnroutedMessage", PushNotification{User: "carol", Device: "tablet", Message: "M"}, nil, "carol/tablet", 200},
+		{"ShouldRouteChannel", PushNotification{Channel: "db-alerts", Message: "M"}, nil, "alice/phone,bob/phone", 200},
+		{"ShouldAddRecipientsByPriority", PushNotification{User: "carol", Message: "M", Priority: priorityEmergency}, nil, "carol/,oncall/", 200},
+		{"ShouldCombineRules", PushNotification{Channel: "db-alerts", Message: "M", Priority: priorityHigh}, nil, "alice/phone,bob/phone,oncall/", 200},
+		{"ShouldNotRepeatRecipient", PushNotification{User: "oncall", Message: "M", Priority: priorityHigh}, nil, "oncall/", 200},
+		{"ShouldRejectUnknownChannel", PushNotification{Channel: "web-alerts", Message: "M"}, nil, "", 400},
+		{"ShouldReturnAcceptedIfAnyQueued", PushNotification{Channel: "db-alerts", Message: "M"}, map[string]int{"bob": 202}, "alice/phone,bob/phone", 202},
+		{"ShouldReturnSuccessIfAnyHandled", PushNotification{Channel: "db-alerts", Message: "M"}, map[string]int{"alice": 202, "bob": 400}, "alice/phone,bob/phone", 200},
+		{"ShouldReturnFirstFailureIfNoneHandled", PushNotification{Channel: "db-alerts", Message: "M"}, map[string]int{"alice": 500, "bob": 400}, "alice/phone,bob/phone", 500},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			messageHandlerMock := NewMessageHandlerMock()
+			messageHandlerMock.userResponseCodes = tc.userResponseCodes
+			router := NewRouter(messageHandlerMock, routes, nil)
+
+			// WHEN
+			var response = PushNotificationHandlingResponse{}
+			err := router.HandleMessage(WithRequestID(context.Background(), "parent"), &response, tc.message)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("Routing failed with error %s.", err)
+			}
+			if response.responseCode != tc.expectedResponseCode {
+				t.Errorf("Response code %d returned, expected %d.", response.responseCode, tc.expectedResponseCode)
+			}
+			var targets []string
+			for _, notification := range messageHandlerMock.notifications {
+				targets = append(targets, notification.User+"/"+notification.Device)
+			}
+			if strings.Join(targets, ",") != tc.expectedTargets {
+				t.Errorf("Messages handled for %v, expected %s.", targets, tc.expectedTargets)
+			}
+		})
+	}
+}
+
+func TestRouterShouldReportRecipientsOfPartialFailure(t *testing.T) {
+
+	// GIVEN
+	messageHandlerMock := NewMessageHandlerMock()
+	messageHandlerMock.userResponseCodes = map[string]int{"bob": 400, "carol": 202}
+	router := NewRouter(messageHandlerMock, []*Route{NewRoute("db-alerts", nil, []string{"alice", "bob", "carol"}, "")}, nil)
+
+	// WHEN
+	var response = PushNotificationHandlingResponse{}
+	err := router.HandleMessage(WithRequestID(context.Background(), "parent"), &response, PushNotification{Channel: "db-alerts", Message: "M"})
+
+	// THEN
+	if err != nil || response.responseCode != 200 {
+		t.Fatalf("Routing returned error %v and response code %d, expected 200.", err, response.responseCode)
+	}
+	var body routedResponseBody
+	err = json.Unmarshal([]byte(response.jsonResponseBody), &body)
+	if err != nil {
+		t.Fatalf("Response body %s failed to decode with error %s.", response.jsonResponseBody, err)
+	}
+	expectedRecipients := []routedRecipient{{"parent-1", 200}, {"parent-2", 400}, {"parent-3", 202}}
+	if body.Status != 1 || !slices.Equal(body.Recipients, expectedRecipients) || len(body.Errors) != 1 {
+		t.Errorf("Response body %s returned, expected the status of every recipient and the error of parent-2.", response.jsonResponseBody)
+	}
+}
+
+func TestRouterShouldQueueRoutedMessagesSeparately(t *testing.T) {
+
+	// GIVEN
+	pcm := NewPushNotificationsSenderMock()
+	pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+	messageRepository := newTestMessageRepository(t)
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+	router := NewRouter(processor, []*Route{NewRoute("db-alerts", nil, []string{"alice", "bob"}, "")}, nil)
+
+	// WHEN
+	var response = PushNotificationHandlingResponse{}
+	err := router.HandleMessage(WithRequestID(context.Background(), "parent"), &response, PushNotification{Token: "<dummy token>", Channel: "db-alerts", Message: "<dummy message>"})
+
+	// THEN
+	if err != nil || response.responseCode != 202 {
+		t.Fatalf("Routing returned error %v and response code %d, expected 202.", err, response.responseCode)
+	}
+	var body routedResponseBody
+	err = json.Unmarshal([]byte(response.jsonResponseBody), &body)
+	if err != nil || body.Request != "parent" || strings.Join(body.Requests, ",") != "parent-1,parent-2" {
+		t.Errorf("Response body %s returned, expected the requests parent-1 and parent-2.", response.jsonResponseBody)
+	}
+	messages, err := messageRepository.List()
+	if err != nil {
+		t.Fatalf("Listing of the queue failed with error %s.", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("%d messages queued, expected 2.", len(messages))
+	}
+	for _, message := range messages {
+		if message.ParentID != "parent" || !strings.HasPrefix(message.ID, "parent-") {
+			t.Errorf("Message %s of the parent %s queued, expected the parent request.", message.ID, message.ParentID)
+		}
+	}
+}
+
+func TestRouterShouldExpandGroups(t *testing.T) {
+
+	var testcases = []struct {
+		id                   string
+		message              PushNotification
+		expectedTargets      string // user/device of the handled messages
+		expectedResponseCode int
+	}{
+		{"ShouldExpandGroupMembers", PushNotification{User: "group:oncall", Message: "M"}, "alice/,bob/phone", 200},
+		{"ShouldPreferMemberDevice", PushNotification{User: "group:oncall", Device: "tablet", Message: "M"}, "alice/tablet,bob/phone", 200},
+		{"ShouldRejectUnknownGroup", PushNotification{User: "group:admins", Message: "M"}, "", 400},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			groupRepository := newTestGroupRepository(t)
+			err := groupRepository.Store(&Group{Name: "oncall", Members: []GroupMember{{User: "alice"}, {User: "bob", Device: "phone"}}})
+			if err != nil {
+				t.Fatalf("Group storing failed with error %s.", err)
+			}
+			messageHandlerMock := NewMessageHandlerMock()
+			router := NewRouter(messageHandlerMock, nil, groupRepository)
+
+			// WHEN
+			var response = PushNotificationHandlingResponse{}
+			err = router.HandleMessage(WithRequestID(context.Background(), "parent"), &response, tc.message)
+
+			// THEN
+			if err != nil {
+				t.Fatalf("Routing failed with error %s.", err)
+			}
+			if response.responseCode != tc.expectedResponseCode {
+				t.Errorf("Response code %d returned, expected %d.", response.responseCode, tc.expectedResponseCode)
+			}
+			var targets []string
+			for _, notification := range messageHandlerMock.notifications {
+				targets = append(targets, notification.User+"/"+notification.Device)
+			}
+			if strings.Join(targets, ",") != tc.expectedTargets {
+				t.Errorf("Messages handled for %v, expected %s.", targets, tc.expectedTargets)
+			}
+		})
+	}
+}
@@ -1,13 +1,25 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"fmt"
 
 	"github.com/gorilla/schema"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Limits represents the values of the message counts limits of the Pushover account
@@ -26,15 +38,29 @@ type PushNotificationHandlingResponse struct {
 
 // IncommingPushNotificationMessageHandler handles message accepted by the REST API
 type IncommingPushNotificationMessageHandler interface {
-	HandleMessage(response *PushNotificationHandlingResponse, message PushNotification) error
+	// HandleMessage handles the message, the context carries the request values (see requestcontext.go)
+	HandleMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error
 }
 
+// the idempotency key of the request is read from the header or the form field
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotencyKeyField     = "idempotency_key"
+	idempotencyKeyMaxLength = 255
+)
+
+// certificateCheckInterval is the period of checking the certificate files for changes
+const certificateCheckInterval = time.Minute
+
 // Server is the REST API server that handles the clients connections
 type Server struct {
 	mux          *http.ServeMux
+	messages     *Post1MessageJSONHTTPHandler
 	server       *http.Server
 	certFilePath string
 	keyFilePath  string
+	clientCAs    *x509.CertPool // CA pool verifying the client certificates, nil if the client certificates are not required
+	listening    atomic.Bool
 }
 
 // NewServer creates a new server. Accepts the messageHandler that will handle all the received messages
@@ -54,6 +80,7 @@ func NewServer(port int, certFilePath string, keyFilePath string, messageHandler
 	h1.decoder.IgnoreUnknownKeys(true)
 
 	s.mux.Handle("/1/messages.json", h1)
+	s.messages = h1
 
 	// create and initialize the HTTP server
 	s.server = new(http.Server)
@@ -63,100 +90,275 @@ func NewServer(port int, certFilePath string, keyFilePath string, messageHandler
 	return s
 }
 
-// Run starts the HTTP server and listens and serves the incoming requests
-func (s *Server) Run() {
-	log.Fatal(s.server.ListenAndServeTLS(s.certFilePath, s.keyFilePath))
+// Run starts the HTTP server and listens and serves the incoming requests. Returns only on failure.
+func (s *Server) Run() error {
+
+	// load the certificate and keep reloading it when rotated
+	certificateReloader, err := NewCertificateReloader(s.certFilePath, s.keyFilePath)
+	if err != nil {
+		return err
+	}
+	go certificateReloader.Watch(certificateCheckInterval)
+
+	// the certificate is provided by the reloader, therefore no files are passed to ListenAndServeTLS
+	s.server.TLSConfig = &tls.Config{GetCertificate: certificateReloader.GetCertificate}
+
+	// if the client certificates are required
+	if s.clientCAs != nil {
+		s.server.TLSConfig.ClientCAs = s.clientCAs
+		s.server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	// open the listener first, so that the readiness is reported only after the port is open
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Starting the HTTPS server.", "address", s.server.Addr, "client_certificates_required", s.clientCAs != nil)
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+	return s.server.ServeTLS(listener, "", "")
+}
+
+// Shutdown stops the server gracefully, the active requests are finished until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// IsListening returns true if the server accepts the connections
+func (s *Server) IsListening() bool {
+	return s.listening.Load()
+}
+
+// Handle registers an additional handler for the given pattern (see http.ServeMux). Must be called before Run.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// SetIdempotencyStore enables the idempotency keys of the messages, the repeated requests with the same key get the response remembered
+// in the store. Must be called before Run.
+func (s *Server) SetIdempotencyStore(idempotencyStore IdempotencyStore) {
+	s.messages.idempotencyStore = idempotencyStore
+}
+
+// SetTemplates sets the message templates selectable by the template form field. Must be called before Run.
+func (s *Server) SetTemplates(templates map[string]*MessageTemplate) {
+	s.messages.templates = templates
+}
+
+// SetValidationRules sets the configuration dependent rules of the message validation. Must be called before Run.
+func (s *Server) SetValidationRules(validationRules ValidationRules) {
+	s.messages.validationRules = validationRules
+}
+
+// RequireClientCertificates configures the server to accept only the clients presenting a certificate issued by one of the CAs
+// in the given PEM bundle. Must be called before Run.
+func (s *Server) RequireClientCertificates(clientCAFilePath string) error {
+
+	// read the CA bundle
+	pemCerts, err := os.ReadFile(clientCAFilePath)
+	if err != nil {
+		return fmt.Errorf("reading of the client CA file %s failed with error %s", clientCAFilePath, err.Error())
+	}
+
+	// construct the CA pool
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pemCerts) {
+		return errors.New("the client CA file " + clientCAFilePath + " does not contain any PEM encoded certificate")
+	}
+	s.clientCAs = clientCAs
+	return nil
+}
+
+// returns the subject of the verified client certificate of the request or empty string if there is none
+func getVerifiedClientSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
 }
 
 // Post1MessageJSONHTTPHandler handles the POST request at /1/messages.json
 type Post1MessageJSONHTTPHandler struct {
-	messageHandler IncommingPushNotificationMessageHandler
-	decoder        *schema.Decoder
+	messageHandler   IncommingPushNotificationMessageHandler
+	decoder          *schema.Decoder
+	idempotencyStore IdempotencyStore            // nil if the idempotency keys are not supported
+	templates        map[string]*MessageTemplate // template name -> message template
+	validationRules  ValidationRules
 }
 
 // WriteJSONResponse writes the response header and JSON body
-func WriteJSONResponse(w http.ResponseWriter, responseCode int, responseBody string) {
-	log.Printf("Writing response with status code %d and body %s.", responseCode, responseBody)
+func WriteJSONResponse(ctx context.Context, w http.ResponseWriter, responseCode int, responseBody string) {
+	GetLogger(ctx).Info("Writing response.", logKeyStatusCode, responseCode, "body", responseBody)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int(traceKeyStatusCode, responseCode))
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(responseCode)
 	w.Write([]byte(responseBody))
 }
 
 // WriteSuccessJSONResponse writes the response header and JSON body
-func WriteSuccessJSONResponse(w http.ResponseWriter, responseCode int, request string) {
+func WriteSuccessJSONResponse(ctx context.Context, w http.ResponseWriter, responseCode int, request string) {
 	responseBody := fmt.Sprintf("{\"status\": 1, \"request\": \"%s\"}", request)
-	WriteJSONResponse(w, responseCode, responseBody)
+	WriteJSONResponse(ctx, w, responseCode, responseBody)
 }
 
 // WriteErrorJSONResponse writes the response header and JSON body with error string
-func WriteErrorJSONResponse(w http.ResponseWriter, responseCode int, request string, errorStr string) {
+func WriteErrorJSONResponse(ctx context.Context, w http.ResponseWriter, responseCode int, request string, errorStr string) {
 	responseBody := fmt.Sprintf("{\"status\": 0, \"request\": \"%s\", \"errors\":[\"%s\"]}", request, errorStr)
-	WriteJSONResponse(w, responseCode, responseBody)
+	WriteJSONResponse(ctx, w, responseCode, responseBody)
 }
 
-// handles the incomming request and forwards it to the message handler
-func (h *Post1MessageJSONHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// decodes the push notification from the request and validates it
+func (h *Post1MessageJSONHTTPHandler) decodeRequest(ctx context.Context, r *http.Request) (PushNotification, error) {
+	_, span := getTracer().Start(ctx, "Post1MessageJSONHTTPHandler.decodeRequest")
+	defer span.End()
 
-	request := "TODO: generate random"
+	var pn PushNotification
 
 	// if the request type is not POST
 	if r.Method != "POST" {
-		WriteErrorJSONResponse(w, 400, request, fmt.Sprintf("Received request of method '%s', expected 'POST'", r.Method))
-		return
+		return pn, recordSpanError(span, fmt.Errorf("Received request of method '%s', expected 'POST'", r.Method))
 	}
 
 	// does the request does not contain the requested content type
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/x-www-form-urlencoded" {
-		WriteErrorJSONResponse(w, 400, request, fmt.Sprintf("Received request with unsupported Content-Type %s, expected application/x-www-form-urlencoded", contentType))
-		return
+		return pn, recordSpanError(span, fmt.Errorf("Received request with unsupported Content-Type %s, expected application/x-www-form-urlencoded", contentType))
 	}
 
 	// parse the form
 	err := r.ParseForm()
 	if err != nil {
-		WriteErrorJSONResponse(w, 400, request, fmt.Sprintf("The POST form parsing failed with error %s", err.Error()))
-		return
+		return pn, recordSpanError(span, fmt.Errorf("The POST form parsing failed with error %s", err.Error()))
 	}
 
 	// decode the POST form
-	var pn PushNotification
 	err = h.decoder.Decode(&pn, r.PostForm)
 	if err != nil {
-		WriteErrorJSONResponse(w, 400, request, fmt.Sprintf("The POST form decoding failed with error %s", err.Error()))
-		return
+		return pn, recordSpanError(span, fmt.Errorf("The POST form decoding failed with error %s", err.Error()))
+	}
+
+	// render the message template selected by the client
+	if templateName := r.PostForm.Get(templateField); templateName != "" {
+		messageTemplate, found := h.templates[templateName]
+		if !found {
+			return pn, recordSpanError(span, fmt.Errorf("Unknown message template \"%s\"", templateName))
+		}
+		pn, err = messageTemplate.Render(pn, r.PostForm)
+		if err != nil {
+			return pn, recordSpanError(span, fmt.Errorf("The message template rendering failed with error %s", err.Error()))
+		}
 	}
-	//defer r.Body.Close()
 
 	// if the message has all the mandatory fields token, user and message non empty
-	err = pn.Validate()
+	err = pn.Validate(h.validationRules)
+	if err != nil {
+		return pn, recordSpanError(span, fmt.Errorf("The POST form decoding failed with error %s. POST form content: '%s'", err.Error(), RedactForm(r.PostForm).Encode()))
+	}
+	return pn, nil
+}
+
+// returns the idempotency key of the request scoped by the token of the message or empty string if the request has none
+func (h *Post1MessageJSONHTTPHandler) getIdempotencyKey(r *http.Request, pn PushNotification) (string, error) {
+	if h.idempotencyStore == nil {
+		return "", nil
+	}
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		key = r.PostForm.Get(idempotencyKeyField)
+	}
+	if key == "" {
+		return "", nil
+	}
+	if len(key) > idempotencyKeyMaxLength {
+		return "", fmt.Errorf("The idempotency key is longer than %d characters", idempotencyKeyMaxLength)
+	}
+	return pn.Token + "/" + key, nil
+}
+
+// writes the response of the message handling with the limits headers
+func writeHandlingResponse(ctx context.Context, w http.ResponseWriter, responseCode int, limits *Limits, jsonResponseBody string) {
+
+	// if limits are provided
+	if limits != nil {
+		// construct the X-Limit-App-XXX headers
+		w.Header().Set("X-Limit-App-Limit", strconv.Itoa(limits.limit))
+		w.Header().Set("X-Limit-App-Remaining", strconv.Itoa(limits.remaining))
+		w.Header().Set("X-Limit-App-Reset", strconv.Itoa(limits.reset))
+	}
+
+	// return the obtained response code and body
+	WriteJSONResponse(ctx, w, responseCode, jsonResponseBody)
+}
+
+// handles the incomming request and forwards it to the message handler
+func (h *Post1MessageJSONHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// identify the request and the client
+	request := NewRequestID()
+	clientSubject := getVerifiedClientSubject(r)
+	ctx := WithClientSubject(WithRequestID(r.Context(), request), clientSubject)
+
+	// continue the trace of the client (if the traceparent header is present)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := getTracer().Start(ctx, "POST /1/messages.json", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attribute.String(traceKeyRequestID, request)))
+	defer span.End()
+
+	// decode and validate the message
+	pn, err := h.decodeRequest(ctx, r)
 	if err != nil {
-		WriteErrorJSONResponse(w, 400, request, fmt.Sprintf("The POST form decoding failed with error %s. POST form content: '%s'", err.Error(), r.PostForm))
+		WriteErrorJSONResponse(ctx, w, 400, request, err.Error())
 		return
 	}
+
 	// log the accepted message
-	log.Printf("Received request with %s.", pn.DumpToString())
+	GetLogger(ctx).Info("Received request.", "notification", pn.DumpToString())
+
+	// a repeated request with a known idempotency key gets the original response, the message is not handled again
+	idempotencyKey, err := h.getIdempotencyKey(r, pn)
+	if err != nil {
+		WriteErrorJSONResponse(ctx, w, 400, request, err.Error())
+		return
+	}
+	if idempotencyKey != "" {
+		original, err := h.idempotencyStore.Begin(idempotencyKey, request, time.Now())
+		if err != nil {
+			WriteErrorJSONResponse(ctx, w, 409, request, err.Error())
+			return
+		}
+		if original != nil {
+			GetLogger(ctx).Info("Repeated request with the known idempotency key, replaying the original response.", "original_request_id", original.RequestID)
+			idempotentReplays.Inc()
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeHandlingResponse(ctx, w, original.ResponseCode, original.Limits, original.JSONResponseBody)
+			return
+		}
+	}
 
 	// handle the message
 	var response = PushNotificationHandlingResponse{}
-	err = h.messageHandler.HandleMessage(&response, pn)
+	err = h.messageHandler.HandleMessage(ctx, &response, pn)
 
 	// if the handling of the message failed
 	if err != nil {
 
+		// the client may repeat the failed request with the same key
+		if idempotencyKey != "" {
+			h.idempotencyStore.Release(idempotencyKey)
+		}
+
 		// report the error
-		WriteErrorJSONResponse(w, 500, request, fmt.Sprintf("Handling of the message %s failed with error %s, response code %d. Returning HTTP 500 (Internal Server Error)", pn.DumpToString(), err.Error(), response.responseCode))
+		WriteErrorJSONResponse(ctx, w, 500, request, fmt.Sprintf("Handling of the message %s failed with error %s, response code %d. Returning HTTP 500 (Internal Server Error)", pn.DumpToString(), err.Error(), response.responseCode))
 		return
 	}
 
-	// if limits are provided
-	if response.limits != nil {
-		// construct the X-Limit-App-XXX headers
-		w.Header().Set("X-Limit-App-Limit", strconv.Itoa(response.limits.limit))
-		w.Header().Set("X-Limit-App-Remaining", strconv.Itoa(response.limits.remaining))
-		w.Header().Set("X-Limit-App-Reset", strconv.Itoa(response.limits.reset))
+	// remember the response of the key, the server errors are not remembered, so that the client may repeat the request
+	if idempotencyKey != "" {
+		if response.responseCode < 500 {
+			h.idempotencyStore.Complete(idempotencyKey, IdempotentResponse{RequestID: request, ResponseCode: response.responseCode, Limits: response.limits, JSONResponseBody: response.jsonResponseBody, StoredAt: time.Now()})
+		} else {
+			h.idempotencyStore.Release(idempotencyKey)
+		}
 	}
 
-	// return the obtained response code and body
-	WriteJSONResponse(w, response.responseCode, response.jsonResponseBody)
+	writeHandlingResponse(ctx, w, response.responseCode, response.limits, response.jsonResponseBody)
 }
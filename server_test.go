@@ -2,14 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"io/ioutil"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -21,6 +31,10 @@ type MessageHandlerMock struct {
 	limits              *Limits
 	handleMessageCalled int
 	notification        PushNotification
+	notifications       []PushNotification // all the messages handled since the last ForceResponse call
+	requestIDs          []string           // request identifiers of the handled messages
+	userResponseCodes   map[string]int     // user -> response code overriding the forced response code
+	clientSubject       string
 }
 
 // NewMessageHandlerMock initializes the mock
@@ -32,16 +46,24 @@ func NewMessageHandlerMock() *MessageHandlerMock {
 	return mh
 }
 
-func (mh *MessageHandlerMock) HandleMessage(response *PushNotificationHandlingResponse, message PushNotification) error {
+func (mh *MessageHandlerMock) HandleMessage(ctx context.Context, response *PushNotificationHandlingResponse, message PushNotification) error {
 	mh.handleMessageCalled++
 	mh.notification = message
+	mh.notifications = append(mh.notifications, message)
+	mh.requestIDs = append(mh.requestIDs, GetRequestID(ctx))
+	mh.clientSubject = GetClientSubject(ctx)
 	response.limits = mh.limits
 	response.responseCode = mh.responseCode
+	if responseCode, found := mh.userResponseCodes[message.User]; found {
+		response.responseCode = responseCode
+	}
 	return mh.responseErr
 }
 
 func (mh *MessageHandlerMock) ForceResponse(responseErr error, reseponseCode int, limits *Limits) {
 	mh.handleMessageCalled = 0
+	mh.notifications = nil
+	mh.requestIDs = nil
 	mh.responseErr = responseErr
 	mh.responseCode = reseponseCode
 	mh.limits = limits
@@ -73,6 +95,7 @@ func TestServer(t *testing.T) {
 
 	// start the server
 	go brokerServer.Run()
+	defer brokerServer.Shutdown(context.Background())
 
 	// give the HTTP server enough time to start listening for the new connections
 	time.Sleep(100 * time.Millisecond)
@@ -266,4 +289,324 @@ func TestServer(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("API1MessageJSONShouldNotReturnSecrets", func(t *testing.T) {
+
+		var testcases = []struct {
+			id          string
+			urlValues   map[string]string
+			responseErr error
+		}{
+			{"ShouldRedactInvalidForm", map[string]string{"token": "azGDORePK8gMaC0QOYAMyEEuzJnyUi", "user": "uQiRzpo4DXghDmr9QzzfQu27cmVRsG"}, nil},
+			{"ShouldRedactInternalError", map[string]string{"token": "azGDORePK8gMaC0QOYAMyEEuzJnyUi", "user": "uQiRzpo4DXghDmr9QzzfQu27cmVRsG", "message": "<dummy message>"}, errors.New("any internal error")},
+		}
+
+		for _, tc := range testcases {
+
+			t.Run(tc.id, func(t *testing.T) {
+
+				// **** WHEN ****
+
+				// encode message into the URL form values
+				form := url.Values{}
+				for name, value := range tc.urlValues {
+					form.Set(name, value)
+				}
+				formStr := form.Encode()
+
+				// Prepare the POST request with form data
+				urlStr := "https://localhost:" + strconv.Itoa(port) + "/1/messages.json"
+				req, err := http.NewRequest("POST", urlStr, bytes.NewBufferString(formStr))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+				// initialize the client that does not check the certificates (for testing purposes only)
+				tlsConfig := tls.Config{InsecureSkipVerify: true}
+				transport := &http.Transport{TLSClientConfig: &tlsConfig}
+				client := &http.Client{Transport: transport}
+
+				messageHandlerMock.ForceResponse(tc.responseErr, 0, nil)
+
+				// post the request
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Errorf("POST request failed with error '%s', but was expected to succeed.", err)
+					return
+				}
+				defer resp.Body.Close()
+
+				// **** THEN ****
+
+				// the error response must not contain the token nor the user key
+				body, _ := ioutil.ReadAll(resp.Body)
+				if resp.StatusCode < 400 {
+					t.Errorf("POST request returned status code %d, expected error.", resp.StatusCode)
+				}
+				if strings.Contains(string(body), tc.urlValues["token"]) || strings.Contains(string(body), tc.urlValues["user"]) {
+					t.Errorf("POST request response body '%s' contains the secrets.", string(body))
+				}
+			})
+		}
+	})
+}
+
+// writes a new CA certificate and a client certificate issued by the CA with the given subject common name into the directory
+func writeTestClientCertificates(t *testing.T, dir string, clientCommonName string) (caFilePath string, clientCertFilePath string, clientKeyFilePath string) {
+
+	// generate the CA
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CA certificate generation failed with error %s", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDer)
+
+	// generate the client certificate
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientTemplate := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: clientCommonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDer, err := x509.CreateCertificate(rand.Reader, &clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("client certificate generation failed with error %s", err)
+	}
+	clientKeyDer, _ := x509.MarshalECPrivateKey(clientKey)
+
+	// write the files
+	caFilePath = path.Join(dir, "clientca.cert.pem")
+	clientCertFilePath = path.Join(dir, "client.cert.pem")
+	clientKeyFilePath = path.Join(dir, "client.key.pem")
+	os.WriteFile(caFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0600)
+	os.WriteFile(clientCertFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDer}), 0600)
+	os.WriteFile(clientKeyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDer}), 0600)
+	return caFilePath, clientCertFilePath, clientKeyFilePath
+}
+
+// TestServerClientCertificates tests the mutual TLS authentication of the clients
+func TestServerClientCertificates(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// get the certificate files path
+	wd, _ := os.Getwd()
+	certFilePath := path.Join(wd, "private", "server.cert.pem")
+	keyFilePath := path.Join(wd, "private", "server.key.pem")
+	caFilePath, clientCertFilePath, clientKeyFilePath := writeTestClientCertificates(t, t.TempDir(), "backup-script")
+
+	// The REST API server requiring the client certificates is initialized and connected to the message handler mock
+	messageHandlerMock := NewMessageHandlerMock()
+	port := 8503
+	brokerServer := NewServer(port, certFilePath, keyFilePath, messageHandlerMock)
+	err := brokerServer.RequireClientCertificates(caFilePath)
+	if err != nil {
+		t.Fatalf("Configuration of the client CA failed with error %s.", err)
+	}
+
+	// start the server
+	go brokerServer.Run()
+	defer brokerServer.Shutdown(context.Background())
+
+	// give the HTTP server enough time to start listening for the new connections
+	time.Sleep(100 * time.Millisecond)
+
+	clientCertificate, err := tls.LoadX509KeyPair(clientCertFilePath, clientKeyFilePath)
+	if err != nil {
+		t.Fatalf("Loading of the client certificate failed with error %s.", err)
+	}
+
+	var testcases = []struct {
+		id                    string
+		clientCertificates    []tls.Certificate
+		expectedSuccess       bool
+		expectedClientSubject string
+	}{
+		{"ShouldRejectClientWithoutCertificate", nil, false, ""},
+		{"ShouldPassClientSubjectToMessageHandler", []tls.Certificate{clientCertificate}, true, "CN=backup-script"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** WHEN ****
+
+			// encode message into the URL form values
+			form := url.Values{}
+			form.Set("token", "<dummy token>")
+			form.Set("user", "<dummy user>")
+			form.Set("message", "<dummy message>")
+			formStr := form.Encode()
+
+			// Prepare the POST request with form data
+			urlStr := "https://localhost:" + strconv.Itoa(port) + "/1/messages.json"
+			req, err := http.NewRequest("POST", urlStr, bytes.NewBufferString(formStr))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			// initialize the client that does not check the server certificate (for testing purposes only)
+			tlsConfig := tls.Config{InsecureSkipVerify: true, Certificates: tc.clientCertificates}
+			transport := &http.Transport{TLSClientConfig: &tlsConfig}
+			client := &http.Client{Transport: transport}
+
+			messageHandlerMock.ForceResponse(nil, 200, nil)
+
+			// post the request
+			resp, err := client.Do(req)
+
+			// **** THEN ****
+
+			if !tc.expectedSuccess {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("POST request without the client certificate succeeded with status code %d, expected failure.", resp.StatusCode)
+				}
+				if messageHandlerMock.handleMessageCalled != 0 {
+					t.Errorf("The message handler was called %d times, expected no call.", messageHandlerMock.handleMessageCalled)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("POST request failed with error '%s', but was expected to succeed.", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				t.Errorf("POST request returned status code %d, expected 200.", resp.StatusCode)
+			}
+			if messageHandlerMock.clientSubject != tc.expectedClientSubject {
+				t.Errorf("The message handler received client subject \"%s\", expected \"%s\".", messageHandlerMock.clientSubject, tc.expectedClientSubject)
+			}
+		})
+	}
+}
+
+// TestServerShouldReplayIdempotentRequests tests whether the repeated requests with the same idempotency key get the original response
+func TestServerShouldReplayIdempotentRequests(t *testing.T) {
+
+	var testcases = []struct {
+		id                     string
+		firstForm              string
+		firstKey               string
+		repeatedForm           string
+		repeatedKey            string
+		responseErr            error
+		expectedHandled        int
+		expectedRepeatedStatus int
+		expectedReplayed       bool
+	}{
+		{"ShouldReplayHeaderKey", "token=A&user=U&message=M", "key1", "token=A&user=U&message=M", "key1", nil, 1, 202, true},
+		{"ShouldReplayFormKey", "token=A&user=U&message=M&idempotency_key=key1", "", "token=A&user=U&message=M&idempotency_key=key1", "", nil, 1, 202, true},
+		{"ShouldHandleDifferentKeys", "token=A&user=U&message=M", "key1", "token=A&user=U&message=M", "key2", nil, 2, 202, false},
+		{"ShouldScopeKeysByToken", "token=A&user=U&message=M", "key1", "token=B&user=U&message=M", "key1", nil, 2, 202, false},
+		{"ShouldHandleRequestsWithoutKey", "token=A&user=U&message=M", "", "token=A&user=U&message=M", "", nil, 2, 202, false},
+		{"ShouldNotRememberFailure", "token=A&user=U&message=M", "key1", "token=A&user=U&message=M", "key1", errors.New("any internal error"), 2, 500, false},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			// the server with the idempotency keys enabled is connected to the message handler mock
+			messageHandlerMock := NewMessageHandlerMock()
+			messageHandlerMock.ForceResponse(tc.responseErr, 202, &Limits{limit: 100, remaining: 50, reset: 123})
+			server := NewServer(0, "", "", messageHandlerMock)
+			server.SetIdempotencyStore(NewIdempotencyStoreImpl(time.Hour))
+			sendRequest := func(form string, key string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest("POST", "/1/messages.json", strings.NewReader(form))
+				request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if key != "" {
+					request.Header.Set("Idempotency-Key", key)
+				}
+				response := httptest.NewRecorder()
+				server.mux.ServeHTTP(response, request)
+				return response
+			}
+			first := sendRequest(tc.firstForm, tc.firstKey)
+
+			// **** WHEN ****
+
+			repeated := sendRequest(tc.repeatedForm, tc.repeatedKey)
+
+			// **** THEN ****
+
+			if messageHandlerMock.handleMessageCalled != tc.expectedHandled {
+				t.Errorf("The message was handled %d times, expected %d.", messageHandlerMock.handleMessageCalled, tc.expectedHandled)
+			}
+			if repeated.Code != tc.expectedRepeatedStatus {
+				t.Errorf("Response code %d received, expected %d.", repeated.Code, tc.expectedRepeatedStatus)
+			}
+			replayed := repeated.Header().Get("Idempotent-Replayed") == "true"
+			if replayed != tc.expectedReplayed {
+				t.Errorf("The response was replayed %t, expected %t.", replayed, tc.expectedReplayed)
+			}
+			if tc.expectedReplayed && (repeated.Body.String() != first.Body.String() || repeated.Header().Get("X-Limit-App-Remaining") != "50") {
+				t.Errorf("Response \"%s\" replayed, expected the original response \"%s\" with the limits.", repeated.Body.String(), first.Body.String())
+			}
+		})
+	}
+}
+
+// TestServerShouldRenderMessageTemplates tests whether the message selected by the template form field is rendered before the validation
+func TestServerShouldRenderMessageTemplates(t *testing.T) {
+
+	var testcases = []struct {
+		id                 string
+		form               string
+		expectedStatusCode int
+		expectedMessage    PushNotification
+	}{
+		{"ShouldRenderTemplate", "token=T&user=U&template=disk&vars.host=nas&vars.usage=91", 200, PushNotification{Token: "T", User: "U", Title: "Disk of nas", Message: "91% used", Priority: priorityHigh}},
+		{"ShouldRejectUnknownTemplate", "token=T&user=U&template=cpu&vars.host=nas", 400, PushNotification{}},
+		{"ShouldRejectMissingVariable", "token=T&user=U&template=disk&vars.host=nas", 400, PushNotification{}},
+		{"ShouldAcceptMessageWithoutTemplate", "token=T&user=U&message=M", 200, PushNotification{Token: "T", User: "U", Message: "M"}},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// **** GIVEN ****
+
+			messageHandlerMock := NewMessageHandlerMock()
+			server := NewServer(0, "", "", messageHandlerMock)
+			highPriority := priorityHigh
+			diskTemplate, err := NewMessageTemplate("disk", "Disk of {{.host}}", "{{.usage}}% used", &highPriority, "", "")
+			if err != nil {
+				t.Fatalf("Parsing of the template failed with error %s.", err)
+			}
+			server.SetTemplates(map[string]*MessageTemplate{"disk": diskTemplate})
+
+			// **** WHEN ****
+
+			request := httptest.NewRequest("POST", "/1/messages.json", strings.NewReader(tc.form))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			response := httptest.NewRecorder()
+			server.mux.ServeHTTP(response, request)
+
+			// **** THEN ****
+
+			if response.Code != tc.expectedStatusCode {
+				t.Fatalf("Response code %d received, expected %d. Body: %s", response.Code, tc.expectedStatusCode, response.Body.String())
+			}
+			if tc.expectedStatusCode == 200 {
+				messageHandlerMock.AssertMessageAcceptedOnce(t, tc.expectedMessage)
+			}
+		})
+	}
 }
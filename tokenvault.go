@@ -0,0 +1,78 @@
+package main
+
+import "errors"
+
+// TokenVault holds the real Pushover application tokens and user keys, so that the clients can refer to them by the alias names
+// or by the broker issued API keys instead of embedding them
+type TokenVault struct {
+	tokens       map[string]string // token alias -> Pushover application token
+	users        map[string]string // user alias -> Pushover user key
+	apiKeys      map[string]string // broker API key -> token alias
+	requireVault bool              // reject the tokens and users not known to the vault
+}
+
+// NewTokenVault creates a new vault. If requireVault is false, the tokens and users not known to the vault are passed unchanged.
+func NewTokenVault(tokens map[string]string, users map[string]string, apiKeys map[string]string, requireVault bool) *TokenVault {
+	tv := new(TokenVault)
+	tv.tokens = tokens
+	tv.users = users
+	tv.apiKeys = apiKeys
+	tv.requireVault = requireVault
+	return tv
+}
+
+// ResolveUser returns the user key of the alias, the user keys and unknown aliases are returned unchanged
+func (tv *TokenVault) ResolveUser(user string) string {
+	if userKey, exists := tv.users[user]; exists {
+		return userKey
+	}
+	return user
+}
+
+// GetTokenAlias returns the alias of the real application token, empty if the token is not known to the vault
+func (tv *TokenVault) GetTokenAlias(token string) string {
+	for tokenAlias, aliasToken := range tv.tokens {
+		if aliasToken == token {
+			return tokenAlias
+		}
+	}
+	return ""
+}
+
+// Resolve returns the message with the token and user aliases (or API key) replaced by the real values and the token alias.
+// The returned alias is empty if the message contained a token not known to the vault.
+func (tv *TokenVault) Resolve(message PushNotification) (PushNotification, string, error) {
+
+	// resolve the token, the API key takes precedence over the alias
+	tokenAlias, isAPIKey := tv.apiKeys[message.Token]
+	if !isAPIKey {
+		tokenAlias = message.Token
+	}
+	token, exists := tv.tokens[tokenAlias]
+	switch {
+	case exists:
+		message.Token = token
+
+	case isAPIKey:
+		return message, "", errors.New("the API key refers to a token alias not present in the vault")
+
+	case tv.requireVault:
+		return message, "", errors.New("the token is neither a known API key nor a token alias")
+
+	default:
+		// pass the real token unchanged
+		tokenAlias = ""
+	}
+
+	// resolve the user
+	user, exists := tv.users[message.User]
+	switch {
+	case exists:
+		message.User = user
+
+	case tv.requireVault:
+		return message, "", errors.New("the user is not a known user alias")
+	}
+
+	return message, tokenAlias, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestTokenVaultResolve(t *testing.T) {
+
+	var testcases = []struct {
+		id                 string
+		requireVault       bool
+		token              string
+		user               string
+		expectedError      bool
+		expectedToken      string
+		expectedUser       string
+		expectedTokenAlias string
+	}{
+		{"ShouldResolveAliases", false, "backup", "martin", false, "<real backup token>", "<real martin key>", "backup"},
+		{"ShouldResolveAPIKey", false, "<api key>", "martin", false, "<real backup token>", "<real martin key>", "backup"},
+		{"ShouldPassUnknownValues", false, "<real other token>", "<real other key>", false, "<real other token>", "<real other key>", ""},
+		{"ShouldRejectUnknownTokenIfRequired", true, "<real other token>", "martin", true, "", "", ""},
+		{"ShouldRejectUnknownUserIfRequired", true, "backup", "<real other key>", true, "", "", ""},
+		{"ShouldRejectAPIKeyOfMissingAlias", false, "<broken api key>", "martin", true, "", "", ""},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			tv := NewTokenVault(
+				map[string]string{"backup": "<real backup token>"},
+				map[string]string{"martin": "<real martin key>"},
+				map[string]string{"<api key>": "backup", "<broken api key>": "missing"},
+				tc.requireVault)
+
+			// WHEN
+			message, tokenAlias, err := tv.Resolve(PushNotification{Token: tc.token, User: tc.user, Message: "<dummy message>"})
+
+			// THEN
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("Resolve succeeded, expected error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Resolve failed with error %s, expected no error.", err)
+				return
+			}
+			if message.Token != tc.expectedToken || message.User != tc.expectedUser || message.Message != "<dummy message>" {
+				t.Errorf("Resolved message %s, expected token \"%s\" and user \"%s\".", message.DumpToString(), tc.expectedToken, tc.expectedUser)
+			}
+			if tokenAlias != tc.expectedTokenAlias {
+				t.Errorf("Token alias \"%s\" returned, expected \"%s\".", tokenAlias, tc.expectedTokenAlias)
+			}
+		})
+	}
+}
+
+func TestTokenVaultShouldGetTokenAlias(t *testing.T) {
+
+	// GIVEN
+	tv := NewTokenVault(map[string]string{"backup": "<real backup token>"}, nil, nil, false)
+
+	// WHEN
+	tokenAlias := tv.GetTokenAlias("<real backup token>")
+	unknownAlias := tv.GetTokenAlias("<real other token>")
+
+	// THEN
+	if tokenAlias != "backup" || unknownAlias != "" {
+		t.Errorf("Aliases \"%s\" and \"%s\" returned, expected \"backup\" and none.", tokenAlias, unknownAlias)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer (the instrumentation scope) of the broker spans
+const tracerName = "github.com/martinjansa/pushoverbroker"
+
+// the names of the common span attributes
+const (
+	traceKeyRequestID  = "pushoverbroker.request_id"
+	traceKeyTokenAlias = "pushoverbroker.token_alias"
+	traceKeyAttempt    = "pushoverbroker.attempt"
+	traceKeyStatusCode = "http.response.status_code"
+)
+
+// returns the tracer of the broker spans. The tracer is obtained on every use, so that it follows the currently installed provider.
+func getTracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// InitTracing installs the global tracer provider exporting the spans by the given exporter ("otlp", "stdout" or empty to disable
+// the tracing) and the W3C trace context propagator. The OTLP exporter sends the spans over HTTP to the endpoint (host:port),
+// if empty the standard OTEL_EXPORTER_OTLP_* environment variables apply. Returns the function flushing and stopping the provider.
+func InitTracing(ctx context.Context, exporterName string, endpoint string) (func(context.Context) error, error) {
+
+	// the trace context is propagated even if the spans are not exported, so that the client traces stay connected
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// create the exporter
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch exporterName {
+	case "":
+		return func(context.Context) error { return nil }, nil
+
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+
+	case "otlp":
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter \"%s\", expected \"otlp\" or \"stdout\"", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creation of the %s tracing exporter failed with error %s", exporterName, err.Error())
+	}
+
+	// describe the service
+	serviceResource, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName("pushoverbroker")), resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, fmt.Errorf("creation of the tracing resource failed with error %s", err.Error())
+	}
+
+	// install the provider
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(serviceResource))
+	otel.SetTracerProvider(tracerProvider)
+	return tracerProvider.Shutdown, nil
+}
+
+// recordSpanError marks the span as failed with the error and returns the error
+func recordSpanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+// injectTraceContext returns the trace context of the current span in the context as a map, so that it can be persisted
+func injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractSpanContext returns the span context persisted by injectTraceContext
+func extractSpanContext(traceContext map[string]string) trace.SpanContext {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(traceContext))
+	return trace.SpanContextFromContext(ctx)
+}
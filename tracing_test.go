@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// installs a tracer provider recording the spans in memory, the previous provider is restored at the end of the test
+func installTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+// returns the ended span of the given name or nil
+func findEndedSpan(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// TestShouldContinueClientTrace tests whether the server spans continue the trace given by the traceparent header
+func TestShouldContinueClientTrace(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the server is connected to the message handler mock and the spans are recorded
+	recorder := installTestTracing(t)
+	server := NewServer(0, "", "", NewMessageHandlerMock())
+
+	// **** WHEN ****
+
+	// the client sends the message within its trace
+	request := httptest.NewRequest("POST", "/1/messages.json", strings.NewReader("token=<dummy token>&user=<dummy user>&message=<dummy message>"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+	server.mux.ServeHTTP(response, request)
+
+	// **** THEN ****
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Response code %d received, expected 200.", response.Code)
+	}
+	serverSpan := findEndedSpan(recorder, "POST /1/messages.json")
+	if serverSpan == nil {
+		t.Fatal("The server span was not recorded.")
+	}
+	if serverSpan.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("The server span belongs to the trace %s, expected the client trace.", serverSpan.SpanContext().TraceID())
+	}
+	if serverSpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("The server span has the parent %s, expected the client span.", serverSpan.Parent().SpanID())
+	}
+	if findEndedSpan(recorder, "Post1MessageJSONHTTPHandler.decodeRequest") == nil {
+		t.Error("The validation span was not recorded.")
+	}
+}
+
+// TestShouldLinkQueuedDeliveryToRequestTrace tests whether the delivery attempts of the queued message are linked to the request trace
+func TestShouldLinkQueuedDeliveryToRequestTrace(t *testing.T) {
+
+	// **** GIVEN ****
+
+	// the message is accepted to the queue while offline within a traced request
+	recorder := installTestTracing(t)
+	pcm := NewPushNotificationsSenderMock()
+	messageRepository := newTestMessageRepository(t)
+	processor := NewProcessor(pcm, NewLimitsCounterImpl(), messageRepository)
+	processor.RetryInterval = 0
+	testMessage := PushNotification{Token: "<dummy token>", User: "<dummy user>", Message: "<dummy message>"}
+
+	ctx, requestSpan := otel.Tracer("test").Start(WithRequestID(context.Background(), "tracedrequest"), "request")
+	pcm.ForceResponse(errors.New("offline"), 0, nil, "")
+	var response = PushNotificationHandlingResponse{}
+	err := processor.HandleMessage(ctx, &response, testMessage)
+	requestSpan.End()
+	if err != nil || response.responseCode != 202 {
+		t.Fatalf("Handling of the message returned error %v and response code %d, expected 202.", err, response.responseCode)
+	}
+
+	// **** WHEN ****
+
+	pcm.ForceResponse(nil, 200, nil, "")
+	processor.processQueue()
+
+	// **** THEN ****
+
+	deliverySpan := findEndedSpan(recorder, "Processor.deliverQueuedMessage")
+	if deliverySpan == nil {
+		t.Fatal("The delivery span was not recorded.")
+	}
+	requestTraceID := requestSpan.SpanContext().TraceID()
+	if deliverySpan.SpanContext().TraceID() == requestTraceID {
+		t.Error("The delivery span belongs to the request trace, expected a new trace.")
+	}
+	links := deliverySpan.Links()
+	if len(links) != 1 || links[0].SpanContext.TraceID() != requestTraceID {
+		t.Errorf("The delivery span has links %v, expected a link to the request trace %s.", links, requestTraceID)
+	}
+}
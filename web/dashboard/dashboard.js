@@ -0,0 +1,270 @@
+// Dashboard of the broker. All the data are loaded from the admin API authenticated by the administrator bearer token,
+// which is kept in the session storage of the browser only.
+"use strict";
+
+const tokenKey = "pushoverbroker-admin-token";
+const refreshInterval = 10000;
+const reconnectInterval = 5000;
+const maxRecentMessages = 50;
+
+let refreshTimer = null;
+let streamController = null;
+const recentMessages = new Map(); // request -> latest event of the message
+
+function getToken() {
+    return sessionStorage.getItem(tokenKey) || "";
+}
+
+function showError(message) {
+    const error = document.getElementById("error");
+    error.textContent = message;
+    error.hidden = !message;
+}
+
+// sends the admin API request, returns the decoded JSON body or null if the endpoint is not available (404 without a body)
+async function adminRequest(method, path) {
+    const response = await fetch(path, {method: method, headers: {"Authorization": "Bearer " + getToken()}});
+    if (response.status === 401) {
+        disconnect();
+        throw new Error("The admin token was rejected.");
+    }
+    if (response.status === 404 && !(response.headers.get("Content-Type") || "").startsWith("application/json")) {
+        return null;
+    }
+    const body = await response.json();
+    if (!response.ok) {
+        throw new Error(method + " " + path + " failed: " + (body.error || response.status));
+    }
+    return body;
+}
+
+function formatTime(value) {
+    if (!value || value.startsWith("0001-")) {
+        return "";
+    }
+    return new Date(value).toLocaleString();
+}
+
+function formatUnixTime(value) {
+    return value ? new Date(value * 1000).toLocaleString() : "";
+}
+
+// appends the row of the text cells and the action buttons to the table body
+function appendRow(tbody, cells, actions) {
+    const row = tbody.insertRow();
+    for (const cell of cells) {
+        const td = row.insertCell();
+        if (typeof cell === "object" && cell !== null) {
+            td.textContent = cell.text;
+            td.className = cell.className || "";
+        } else {
+            td.textContent = cell === undefined || cell === null ? "" : String(cell);
+        }
+    }
+    const td = row.insertCell();
+    for (const [label, action] of actions || []) {
+        const button = document.createElement("button");
+        button.type = "button";
+        button.textContent = label;
+        button.addEventListener("click", () => runAction(action));
+        td.appendChild(button);
+    }
+}
+
+// runs the admin API operation of a button and refreshes the dashboard
+async function runAction(action) {
+    try {
+        await action();
+        showError("");
+    } catch (err) {
+        showError(err.message);
+    }
+    refresh();
+}
+
+function renderQueue(queue) {
+    const tbody = document.getElementById("queue");
+    tbody.replaceChildren();
+    for (const message of queue.messages) {
+        const path = "/1/broker/queue/" + encodeURIComponent(message.id);
+        appendRow(tbody, [
+            message.id, message.token_alias, message.notification.user, message.notification.priority || 0,
+            message.attempts, formatTime(message.next_attempt_at), {text: message.last_error || "", className: "wrap"},
+        ], [
+            ["Retry", () => adminRequest("POST", path + "/retry")],
+            ["Delete", () => confirm("Delete the message " + message.id + "?") && adminRequest("DELETE", path)],
+        ]);
+    }
+    document.getElementById("queue-depth").textContent = queue.count;
+}
+
+function renderDeadLetters(deadLetters) {
+    // the dead letters are not available if the broker does not store them
+    document.getElementById("dead-letters-section").hidden = deadLetters === null;
+    if (deadLetters === null) {
+        document.getElementById("dead-letters-count").textContent = "-";
+        return;
+    }
+    const tbody = document.getElementById("dead-letters");
+    tbody.replaceChildren();
+    for (const deadLetter of deadLetters.dead_letters) {
+        const path = "/1/broker/deadletters/" + encodeURIComponent(deadLetter.id);
+        appendRow(tbody, [
+            deadLetter.id, deadLetter.token_alias, deadLetter.notification.user, {text: deadLetter.state, className: deadLetter.state},
+            formatTime(deadLetter.failed_at), {text: deadLetter.final_error, className: "wrap"},
+        ], [
+            ["Retry", () => adminRequest("POST", path + "/replay")],
+            ["Delete", () => confirm("Delete the dead letter " + deadLetter.id + "?") && adminRequest("DELETE", path)],
+        ]);
+    }
+    document.getElementById("dead-letters-count").textContent = deadLetters.count;
+}
+
+function renderLimits(limits) {
+    const tbody = document.getElementById("limits");
+    tbody.replaceChildren();
+    for (const tokenLimits of limits.limits) {
+        appendRow(tbody, [tokenLimits.token, tokenLimits.limit, tokenLimits.remaining, formatUnixTime(tokenLimits.reset)]);
+    }
+}
+
+function renderHealth(health) {
+    const upstream = document.getElementById("upstream");
+    upstream.textContent = health.upstream.status;
+    upstream.className = "value " + health.upstream.status;
+    const processor = document.getElementById("processor");
+    const running = health.checks.processor === "ok";
+    processor.textContent = running ? "running" : "stopped";
+    processor.className = "value " + (running ? "ok" : "offline");
+}
+
+function renderRecentMessages() {
+    const tbody = document.getElementById("recent");
+    tbody.replaceChildren();
+    const events = [...recentMessages.values()].reverse();
+    for (const event of events) {
+        appendRow(tbody, [
+            event.request, event.token_alias, event.user, event.priority || 0, {text: event.type, className: event.type},
+            event.attempt || "", event.status_code || "", formatTime(event.at),
+        ]);
+    }
+}
+
+function setStreamState(state) {
+    const stream = document.getElementById("stream");
+    stream.textContent = state;
+    stream.className = "value " + (state === "connected" ? "ok" : "offline");
+}
+
+// reloads the queue, dead letters, limits and health
+async function refresh() {
+    clearTimeout(refreshTimer);
+    if (!getToken()) {
+        return;
+    }
+    try {
+        const [queue, scheduled, deadLetters, limits] = await Promise.all([
+            adminRequest("GET", "/1/broker/queue"),
+            adminRequest("GET", "/1/broker/scheduled"),
+            adminRequest("GET", "/1/broker/deadletters"),
+            adminRequest("GET", "/1/broker/limits"),
+        ]);
+        renderQueue(queue);
+        document.getElementById("scheduled").textContent = scheduled.count;
+        renderDeadLetters(deadLetters);
+        renderLimits(limits);
+
+        // the readiness is reported also by 503 (Service Unavailable)
+        const health = await (await fetch("/readyz")).json();
+        renderHealth(health);
+    } catch (err) {
+        showError(err.message);
+    }
+    if (getToken()) {
+        refreshTimer = setTimeout(refresh, refreshInterval);
+    }
+}
+
+// reads the server-sent events of the admin API, the EventSource cannot send the bearer token
+async function streamEvents() {
+    streamController = new AbortController();
+    const controller = streamController;
+    try {
+        const response = await fetch("/1/broker/events", {headers: {"Authorization": "Bearer " + getToken()}, signal: controller.signal});
+        if (!response.ok) {
+            throw new Error("event stream failed with status " + response.status);
+        }
+        setStreamState("connected");
+        const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+        let buffer = "";
+        for (;;) {
+            const {value, done} = await reader.read();
+            if (done) {
+                break;
+            }
+            buffer += value;
+            let end;
+            while ((end = buffer.indexOf("\n\n")) >= 0) {
+                handleStreamBlock(buffer.slice(0, end));
+                buffer = buffer.slice(end + 2);
+            }
+        }
+    } catch (err) {
+        if (controller.signal.aborted) {
+            return;
+        }
+    }
+    setStreamState("disconnected");
+    if (getToken() && controller === streamController) {
+        setTimeout(() => controller === streamController && streamEvents(), reconnectInterval);
+    }
+}
+
+// handles the event block of the stream, the comments are ignored
+function handleStreamBlock(block) {
+    for (const line of block.split("\n")) {
+        if (line.startsWith("data: ")) {
+            const event = JSON.parse(line.slice(6));
+            recentMessages.delete(event.request);
+            recentMessages.set(event.request, event);
+            if (recentMessages.size > maxRecentMessages) {
+                recentMessages.delete(recentMessages.keys().next().value);
+            }
+            renderRecentMessages();
+        }
+    }
+}
+
+function connect() {
+    document.getElementById("dashboard").hidden = false;
+    document.getElementById("logout").hidden = false;
+    document.getElementById("token").hidden = true;
+    refresh();
+    streamEvents();
+}
+
+function disconnect() {
+    sessionStorage.removeItem(tokenKey);
+    clearTimeout(refreshTimer);
+    if (streamController) {
+        streamController.abort();
+        streamController = null;
+    }
+    document.getElementById("dashboard").hidden = true;
+    document.getElementById("logout").hidden = true;
+    document.getElementById("token").hidden = false;
+}
+
+document.getElementById("login").addEventListener("submit", (event) => {
+    event.preventDefault();
+    const token = document.getElementById("token");
+    sessionStorage.setItem(tokenKey, token.value);
+    token.value = "";
+    showError("");
+    connect();
+});
+document.getElementById("logout").addEventListener("click", disconnect);
+
+if (getToken()) {
+    connect();
+}
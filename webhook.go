@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// Webhook represents the subscription of a service to the message lifecycle events
+type Webhook struct {
+	name   string
+	url    string
+	events []string // types of the events sent to the webhook, all if empty
+	secret []byte   // key of the HMAC-SHA256 signature of the events, not signed if empty
+}
+
+// NewWebhook creates a new webhook subscription posting the events of the given types (all if empty) to the http(s) URL. The events
+// are signed by the secret, unless it is empty.
+func NewWebhook(name string, webhookURL string, events []string, secret string) (*Webhook, error) {
+	parsedURL, err := url.Parse(webhookURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("the webhook %s has no absolute http(s) URL", name)
+	}
+	for _, event := range events {
+		if !slices.Contains(messageEventTypes, event) {
+			return nil, fmt.Errorf("unsupported event \"%s\" of the webhook %s, expected accepted, queued, retried, delivered, failed, expired, suppressed or digested", event, name)
+		}
+	}
+	w := new(Webhook)
+	w.name = name
+	w.url = webhookURL
+	w.events = events
+	w.secret = []byte(secret)
+	return w, nil
+}
+
+// returns true if the webhook is subscribed to the event
+func (w *Webhook) matches(event *MessageEvent) bool {
+	return len(w.events) == 0 || slices.Contains(w.events, event.Type)
+}
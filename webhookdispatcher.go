@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// default maximal number of the attempts to deliver an event to the webhook
+const defaultWebhookMaxAttempts = 10
+
+// time limit of the webhook request
+const webhookTimeout = 10 * time.Second
+
+// WebhookDispatcher delivers the message lifecycle events to the subscribed webhooks. The events are stored into the persistent
+// queue first and their delivery is repeated with the doubling delay until accepted or the attempts are exhausted.
+type WebhookDispatcher struct {
+	webhooks      map[string]*Webhook // name -> webhook
+	repository    WebhookRepository
+	client        *http.Client
+	RetryInterval time.Duration // period of processing the queue and the delay before the first repeated attempt
+	MaxRetryDelay time.Duration // maximal delay between two attempts, the delay doubles with every attempt up to this value
+	MaxAttempts   int           // the event is dropped after this number of the failed attempts
+	wakeUp        chan struct{}
+	stop          chan struct{}
+}
+
+// NewWebhookDispatcher creates a new dispatcher of the events to the webhooks, the events waiting for the delivery are kept in the repository
+func NewWebhookDispatcher(webhooks []*Webhook, repository WebhookRepository) *WebhookDispatcher {
+	wd := new(WebhookDispatcher)
+	wd.webhooks = make(map[string]*Webhook)
+	for _, webhook := range webhooks {
+		wd.webhooks[webhook.name] = webhook
+	}
+	wd.repository = repository
+	wd.client = &http.Client{Timeout: webhookTimeout}
+	wd.RetryInterval = defaultRetryInterval
+	wd.MaxRetryDelay = defaultMaxRetryDelay
+	wd.MaxAttempts = defaultWebhookMaxAttempts
+	wd.wakeUp = make(chan struct{}, 1)
+	wd.stop = make(chan struct{})
+	return wd
+}
+
+// HandleEvent stores the event for every subscribed webhook and requests its delivery (see MessageEventListener)
+func (wd *WebhookDispatcher) HandleEvent(event *MessageEvent) {
+	now := time.Now()
+	for _, webhook := range wd.webhooks {
+		if !webhook.matches(event) {
+			continue
+		}
+		delivery := &WebhookDelivery{ID: NewRequestID(), Webhook: webhook.name, Event: *event, CreatedAt: now, NextAttemptAt: now}
+		err := wd.repository.Store(delivery)
+		if err != nil {
+			slog.Error("Storing of the webhook event failed, the event is dropped.", "webhook", webhook.name, logKeyRequestID, event.Request, "event", event.Type, logKeyError, err)
+		}
+	}
+
+	select {
+	case wd.wakeUp <- struct{}{}:
+	default:
+		// the processing has been already requested
+	}
+}
+
+// Run starts the delivery loop, the queue is processed every RetryInterval and whenever a new event arrives. Returns after Stop is called.
+func (wd *WebhookDispatcher) Run() {
+	slog.Info("Starting the webhook deliveries.", "webhooks", len(wd.webhooks))
+	for {
+		nextAttemptAt := wd.processDeliveries()
+
+		// wait for the retry interval, the next attempt or a new event, whichever comes first
+		delay := wd.RetryInterval
+		if !nextAttemptAt.IsZero() {
+			delay = min(delay, time.Until(nextAttemptAt))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-wd.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-wd.wakeUp:
+			timer.Stop()
+		}
+	}
+}
+
+// Stop stops the delivery loop
+func (wd *WebhookDispatcher) Stop() {
+	close(wd.stop)
+}
+
+// attempts to deliver all the due events in the order of their creation, an event waiting for its next attempt holds the later
+// events of the same webhook. Returns the earliest next attempt time of the held events, zero if there is none.
+func (wd *WebhookDispatcher) processDeliveries() time.Time {
+	deliveries, err := wd.repository.List()
+	if err != nil {
+		slog.Error("Listing of the webhook events failed.", logKeyError, err)
+		return time.Time{}
+	}
+
+	now := time.Now()
+	var nextAttemptAt time.Time
+	heldWebhooks := make(map[string]bool)
+	for _, delivery := range deliveries {
+		if heldWebhooks[delivery.Webhook] {
+			continue
+		}
+
+		// the webhook might have been removed from the configuration
+		webhook, found := wd.webhooks[delivery.Webhook]
+		if !found {
+			slog.Warn("The webhook is not configured any more, the event is dropped.", "webhook", delivery.Webhook, logKeyRequestID, delivery.Event.Request)
+			wd.removeDelivery(delivery)
+			continue
+		}
+		if delivery.NextAttemptAt.After(now) || !wd.deliver(webhook, delivery, now) {
+			heldWebhooks[delivery.Webhook] = true
+			if nextAttemptAt.IsZero() || delivery.NextAttemptAt.Before(nextAttemptAt) {
+				nextAttemptAt = delivery.NextAttemptAt
+			}
+		}
+	}
+	return nextAttemptAt
+}
+
+// posts the event to the webhook and updates the queue. Returns true if the event left the queue, i.e. it was delivered or dropped.
+func (wd *WebhookDispatcher) deliver(webhook *Webhook, delivery *WebhookDelivery, now time.Time) bool {
+	delivery.Attempts++
+	logger := slog.With("webhook", webhook.name, logKeyRequestID, delivery.Event.Request, "event", delivery.Event.Type, logKeyAttempt, delivery.Attempts)
+	ctx, span := getTracer().Start(context.Background(), "WebhookDispatcher.deliver", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String(traceKeyRequestID, delivery.Event.Request), attribute.Int(traceKeyAttempt, delivery.Attempts)))
+	defer span.End()
+
+	err := postSignedJSON(ctx, wd.client, webhook.url, webhook.secret, delivery.Event)
+	if err == nil {
+		logger.Info("Event delivered to the webhook.")
+		webhookEventsDelivered.Inc()
+		wd.removeDelivery(delivery)
+		return true
+	}
+	recordSpanError(span, err)
+	if delivery.Attempts >= wd.MaxAttempts {
+		logger.Error("Delivery of the event to the webhook failed permanently, the event is dropped.", logKeyError, err)
+		webhookEventsDropped.Inc()
+		wd.removeDelivery(delivery)
+		return true
+	}
+
+	// keep the event in the queue and schedule the next attempt
+	delivery.LastError = err.Error()
+	delivery.NextAttemptAt = now.Add(getDoublingDelay(wd.RetryInterval, wd.MaxRetryDelay, delivery.Attempts))
+	logger.Warn("Delivery of the event to the webhook failed temporarily.", logKeyError, err, "next_attempt_at", delivery.NextAttemptAt)
+	err = wd.repository.Store(delivery)
+	if err != nil {
+		logger.Error("Updating of the webhook event failed.", logKeyError, err)
+	}
+	return false
+}
+
+// removes the delivery from the queue and logs the failure
+func (wd *WebhookDispatcher) removeDelivery(delivery *WebhookDelivery) {
+	err := wd.repository.Remove(delivery.ID)
+	if err != nil {
+		slog.Error("Removing of the webhook event failed.", "webhook", delivery.Webhook, logKeyError, err)
+	}
+}
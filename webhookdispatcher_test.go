@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// starts a fake service receiving the webhook events, the service answers by the status codes in the order (200 when exhausted)
+func newFakeWebhookService(statusCodes ...int) (*httptest.Server, *[]string) {
+	received := []string{}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event MessageEvent
+		json.Unmarshal(body, &event)
+		received = append(received, r.URL.Path+":"+event.Type)
+		statusCode := 200
+		if len(received) <= len(statusCodes) {
+			statusCode = statusCodes[len(received)-1]
+		}
+		w.WriteHeader(statusCode)
+	}))
+	return service, &received
+}
+
+// creates the webhook failing the test on error
+func newTestWebhook(t *testing.T, name string, url string, events []string) *Webhook {
+	webhook, err := NewWebhook(name, url, events, "webhook-secret")
+	if err != nil {
+		t.Fatalf("Webhook creation failed with error %s.", err)
+	}
+	return webhook
+}
+
+func TestWebhookDispatcherShouldDeliverSubscribedEvents(t *testing.T) {
+
+	// GIVEN
+	service, received := newFakeWebhookService()
+	defer service.Close()
+	webhookRepository := newTestWebhookRepository(t)
+	webhooks := []*Webhook{
+		newTestWebhook(t, "all", service.URL+"/all", nil),
+		newTestWebhook(t, "final", service.URL+"/final", []string{messageEventDelivered, messageEventFailed}),
+	}
+	dispatcher := NewWebhookDispatcher(webhooks, webhookRepository)
+
+	// WHEN
+	dispatcher.HandleEvent(&MessageEvent{ID: "e1", Type: messageEventAccepted, Request: "r1"})
+	dispatcher.HandleEvent(&MessageEvent{ID: "e2", Type: messageEventDelivered, Request: "r1"})
+	nextAttemptAt := dispatcher.processDeliveries()
+
+	// THEN
+	receivedEvents := strings.Join(*received, ",")
+	if !strings.Contains(receivedEvents, "/all:accepted") || !strings.Contains(receivedEvents, "/all:delivered") || !strings.Contains(receivedEvents, "/final:delivered") || len(*received) != 3 {
+		t.Errorf("Events %s received, expected accepted and delivered by all and delivered by final.", receivedEvents)
+	}
+	remaining, _ := webhookRepository.List()
+	if len(remaining) != 0 || !nextAttemptAt.IsZero() {
+		t.Errorf("%d events left in the queue with the next attempt at %s, expected none.", len(remaining), nextAttemptAt)
+	}
+}
+
+func TestWebhookDispatcherShouldRetryEventsInOrder(t *testing.T) {
+
+	var testcases = []struct {
+		id               string
+		maxAttempts      int
+		expectedReceived string
+	}{
+		{"ShouldRepeatFailedEvent", 10, "/hook:queued,/hook:queued,/hook:delivered"},
+		{"ShouldDropEventAfterMaxAttempts", 1, "/hook:queued,/hook:delivered"},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// GIVEN
+			service, received := newFakeWebhookService(http.StatusServiceUnavailable)
+			defer service.Close()
+			webhookRepository := newTestWebhookRepository(t)
+			dispatcher := NewWebhookDispatcher([]*Webhook{newTestWebhook(t, "hook", service.URL+"/hook", nil)}, webhookRepository)
+			dispatcher.MaxAttempts = tc.maxAttempts
+			dispatcher.HandleEvent(&MessageEvent{ID: "e1", Type: messageEventQueued, Request: "r1"})
+			time.Sleep(time.Millisecond)
+			dispatcher.HandleEvent(&MessageEvent{ID: "e2", Type: messageEventDelivered, Request: "r1"})
+
+			// WHEN
+			dispatcher.processDeliveries()
+			deliveries, _ := webhookRepository.List()
+			for _, delivery := range deliveries {
+				delivery.NextAttemptAt = time.Now()
+				webhookRepository.Store(delivery)
+			}
+			dispatcher.processDeliveries()
+
+			// THEN
+			if strings.Join(*received, ",") != tc.expectedReceived {
+				t.Errorf("Events %v received, expected %s.", *received, tc.expectedReceived)
+			}
+			remaining, _ := webhookRepository.List()
+			if len(remaining) != 0 {
+				t.Errorf("%d events left in the queue, expected none.", len(remaining))
+			}
+		})
+	}
+}
+
+func TestWebhookShouldRejectInvalidConfiguration(t *testing.T) {
+
+	var testcases = []struct {
+		id     string
+		url    string
+		events []string
+	}{
+		{"ShouldRejectRelativeURL", "/hook", nil},
+		{"ShouldRejectUnknownEvent", "https://inventory.internal/hook", []string{"opened"}},
+	}
+
+	for _, tc := range testcases {
+
+		t.Run(tc.id, func(t *testing.T) {
+
+			// WHEN
+			_, err := NewWebhook("hook", tc.url, tc.events, "")
+
+			// THEN
+			if err == nil {
+				t.Errorf("Webhook created, expected error.")
+			}
+		})
+	}
+}
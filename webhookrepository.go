@@ -0,0 +1,27 @@
+package main
+
+import "time"
+
+// WebhookDelivery represents the event waiting for the delivery to the webhook
+type WebhookDelivery struct {
+	ID            string       `json:"id"`
+	Webhook       string       `json:"webhook"` // name of the webhook
+	Event         MessageEvent `json:"event"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Attempts      int          `json:"attempts"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	LastError     string       `json:"last_error,omitempty"`
+}
+
+// WebhookRepository represents an interface of the persistent queue of the webhook events
+type WebhookRepository interface {
+
+	// Store adds the delivery to the store or replaces the delivery of the same identifier
+	Store(delivery *WebhookDelivery) error
+
+	// Remove removes the delivery, removing of a delivery not present in the store is not an error
+	Remove(id string) error
+
+	// List returns all the deliveries ordered by the creation time
+	List() ([]*WebhookDelivery, error)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "sort"
+
+// WebhookRepositoryImpl implements the WebhookRepository interface, every delivery is stored in a separate file in the directory
+type WebhookRepositoryImpl struct {
+	store *jsonFileStore
+}
+
+// NewWebhookRepositoryImpl creates a new webhook repository in the given directory
+func NewWebhookRepositoryImpl(dir string) (*WebhookRepositoryImpl, error) {
+	store, err := newJSONFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	wr := new(WebhookRepositoryImpl)
+	wr.store = store
+	return wr, nil
+}
+
+// Store adds the delivery to the store or replaces the delivery of the same identifier
+func (wr *WebhookRepositoryImpl) Store(delivery *WebhookDelivery) error {
+	return wr.store.save(delivery.ID, delivery)
+}
+
+// Remove removes the delivery, removing of a delivery not present in the store is not an error
+func (wr *WebhookRepositoryImpl) Remove(id string) error {
+	return wr.store.remove(id)
+}
+
+// List returns all the deliveries ordered by the creation time
+func (wr *WebhookRepositoryImpl) List() ([]*WebhookDelivery, error) {
+	deliveries, err := loadAllJSON[WebhookDelivery](wr.store)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// creates a new webhook repository in a temporary directory
+func newTestWebhookRepository(t *testing.T) *WebhookRepositoryImpl {
+	webhookRepository, err := NewWebhookRepositoryImpl(t.TempDir())
+	if err != nil {
+		t.Fatalf("Webhook repository creation failed with error %s.", err)
+	}
+	return webhookRepository
+}
+
+func TestWebhookRepositoryShouldKeepDeliveriesAfterReopening(t *testing.T) {
+
+	// GIVEN
+	dir := t.TempDir()
+	webhookRepository, err := NewWebhookRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Webhook repository creation failed with error %s.", err)
+	}
+	now := time.Now()
+	event := MessageEvent{ID: "e1", Type: messageEventDelivered, Request: "r1", At: now}
+	webhookRepository.Store(&WebhookDelivery{ID: "b", Webhook: "inventory", Event: event, CreatedAt: now})
+	webhookRepository.Store(&WebhookDelivery{ID: "a", CreatedAt: now.Add(-time.Minute)})
+	webhookRepository.Store(&WebhookDelivery{ID: "c", CreatedAt: now})
+	webhookRepository.Remove("c")
+
+	// WHEN
+	reopenedRepository, err := NewWebhookRepositoryImpl(dir)
+	if err != nil {
+		t.Fatalf("Webhook repository reopening failed with error %s.", err)
+	}
+	deliveries, err := reopenedRepository.List()
+
+	// THEN
+	if err != nil {
+		t.Fatalf("Listing of the deliveries failed with error %s.", err)
+	}
+	if len(deliveries) != 2 || deliveries[0].ID != "a" || deliveries[1].ID != "b" {
+		t.Fatalf("Deliveries %v listed, expected a and b.", deliveries)
+	}
+	if deliveries[1].Webhook != "inventory" || deliveries[1].Event.Request != "r1" || !deliveries[1].Event.At.Equal(now) {
+		t.Errorf("Delivery %v reloaded, expected the event %v.", deliveries[1], event)
+	}
+}